@@ -0,0 +1,70 @@
+package elasticsearchutil
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// bulkActionRequest decorates a bulk request with action metadata (i.e., dynamic_templates) not
+// supported by the underlying request, merging it into the action line of the request source
+type bulkActionRequest struct {
+	elastic.BulkableRequest
+	meta map[string]interface{}
+}
+
+// withActionMeta returns the given request decorated with the given action metadata, or the
+// request itself when no metadata is provided
+func withActionMeta(req elastic.BulkableRequest, meta map[string]interface{}) elastic.BulkableRequest {
+	if len(meta) == 0 {
+		return req
+	}
+
+	return &bulkActionRequest{
+		BulkableRequest: req,
+		meta:            meta,
+	}
+}
+
+// Source implements elastic.BulkableRequest
+func (r *bulkActionRequest) Source() ([]string, error) {
+	lines, err := r.BulkableRequest.Source()
+	if err != nil {
+		return nil, err
+	}
+
+	var command map[string]map[string]interface{}
+	if err := jsonCodec.Unmarshal([]byte(lines[0]), &command); err != nil {
+		return nil, fmt.Errorf("failed to parse bulk action line; %w", err)
+	}
+
+	for op, params := range command {
+		if params == nil {
+			params = map[string]interface{}{}
+			command[op] = params
+		}
+		for key, val := range r.meta {
+			params[key] = val
+		}
+	}
+
+	actionLine, err := jsonCodec.Marshal(command)
+	if err != nil {
+		return nil, err
+	}
+
+	source := make([]string, len(lines))
+	copy(source, lines)
+	source[0] = string(actionLine)
+	return source, nil
+}
+
+// String implements fmt.Stringer
+func (r *bulkActionRequest) String() string {
+	lines, err := r.Source()
+	if err != nil {
+		return fmt.Sprintf("error: %v", err)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,123 @@
+package elasticsearchutil
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/olivere/elastic/v7"
+)
+
+func TestIndexerSendsDynamicTemplatesInActionMetadata(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	templated := testMessage("events", "1", `{"location":"1,2"}`)
+	templated.Header.DynamicTemplates = map[string]string{"location": "geo_point"}
+	enqueueAll(t, indexer, 2, templated, testMessage("events", "2", `{"a":2}`))
+	waitIdle(t, indexer)
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 2 {
+		t.Fatalf("expected 2 bulk actions; got %d", len(commands))
+	}
+
+	expected := map[string]interface{}{"location": "geo_point"}
+	if templates := commands[0].meta["dynamic_templates"]; !reflect.DeepEqual(templates, expected) {
+		t.Errorf("expected dynamic templates %v; got %v", expected, templates)
+	}
+	if commands[0].meta["_id"] != "1" || commands[0].meta["_index"] != "events" || string(commands[0].source) != `{"location":"1,2"}` {
+		t.Errorf("expected the action metadata and source to be retained; got %v %s", commands[0].meta, commands[0].source)
+	}
+	if _, ok := commands[1].meta["dynamic_templates"]; ok {
+		t.Errorf("expected no dynamic templates for a message without them")
+	}
+}
+
+func TestWithActionMetaMergesIntoActionLine(t *testing.T) {
+	req := elastic.NewBulkIndexRequest().Index("events").Id("1").Doc(map[string]interface{}{"a": 1})
+	if withActionMeta(req, nil) != elastic.BulkableRequest(req) {
+		t.Errorf("expected the request itself when no metadata is provided")
+	}
+
+	lines, err := withActionMeta(req, map[string]interface{}{"require_alias": true}).Source()
+	if err != nil {
+		t.Fatalf("failed to build bulk request source; %s", err.Error())
+	}
+	if len(lines) != 2 || lines[1] != `{"a":1}` {
+		t.Fatalf("expected the source line to be retained; got %v", lines)
+	}
+
+	var command map[string]map[string]interface{}
+	if err := jsonCodec.Unmarshal([]byte(lines[0]), &command); err != nil {
+		t.Fatalf("failed to parse action line; %s", err.Error())
+	}
+	if params := command[OpIndex]; params["require_alias"] != true || params["_id"] != "1" {
+		t.Errorf("expected the metadata to be merged with the action parameters; got %s", lines[0])
+	}
+}
+
+func TestWithActionMetaUsesConfiguredCodec(t *testing.T) {
+	codec := &fakeCodec{}
+	restore := useCodec(codec)
+	defer restore()
+
+	req := elastic.NewBulkIndexRequest().Index("events").Id("1").Doc(`{"a":1}`)
+	if _, err := withActionMeta(req, map[string]interface{}{"require_alias": true}).Source(); err != nil {
+		t.Fatalf("failed to build bulk request source; %s", err.Error())
+	}
+
+	codec.mutex.Lock()
+	defer codec.mutex.Unlock()
+	if codec.marshaled != 1 {
+		t.Errorf("expected the action line to be produced using the configured codec; got %d marshal call(s)", codec.marshaled)
+	}
+}
+
+func TestIndexerSendsRequireAlias(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	aliased := testMessage("events-write", "1", `{"a":1}`)
+	aliased.Header.RequireAlias = true
+	enqueueAll(t, indexer, 2, aliased, testMessage("events", "2", `{"a":2}`))
+	waitIdle(t, indexer)
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 2 {
+		t.Fatalf("expected 2 bulk actions; got %d", len(commands))
+	}
+	if commands[0].meta["require_alias"] != true {
+		t.Errorf("expected require_alias for the message requiring it; got %v", commands[0].meta)
+	}
+	if _, ok := commands[1].meta["require_alias"]; ok {
+		t.Errorf("expected no require_alias for other messages")
+	}
+}
+
+func TestWithRequireAliasAppliesToEveryMessage(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithRequireAlias())
+	stop := runIndexer(indexer)
+	defer stop()
+
+	create := testMessage("events-write", "2", `{"a":2}`)
+	create.Header.OpType = stringOrNil(OpCreate)
+	del := testMessage("events-write", "3", "")
+	del.Header.Op = stringOrNil(OpDelete)
+	enqueueAll(t, indexer, 3, testMessage("events-write", "1", `{"a":1}`), create, del)
+	waitIdle(t, indexer)
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 3 {
+		t.Fatalf("expected 3 bulk actions; got %d", len(commands))
+	}
+	for i, command := range commands[:2] {
+		if command.meta["require_alias"] != true {
+			t.Errorf("expected require_alias for %s action %d; got %v", command.op, i, command.meta)
+		}
+	}
+	if _, ok := commands[2].meta["require_alias"]; ok || commands[2].op != OpDelete {
+		t.Errorf("expected no require_alias for the delete action; got %s %v", commands[2].op, commands[2].meta)
+	}
+}
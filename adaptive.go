@@ -0,0 +1,69 @@
+package elasticsearchutil
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// adaptiveBatchSize bounds the batch size in bytes tuned from the latency and throttling of bulk requests
+type adaptiveBatchSize struct {
+	minBytes      int64
+	maxBytes      int64
+	targetLatency time.Duration
+}
+
+// batchSizeLimit returns the size in bytes at which the current batch is flushed; in adaptive mode this
+// is the current adaptive batch size rather than the configured max batch size
+func (indexer *Indexer) batchSizeLimit() int {
+	if indexer.adaptiveBatchSize != nil {
+		return int(atomic.LoadInt64(&indexer.stats.AdaptiveBatchSizeBytes))
+	}
+	return indexer.maxBatchSizeBytes
+}
+
+// adaptBatchSize halves the adaptive batch size when a bulk request was throttled (429) or slower than the
+// target latency, and grows it by a quarter when the request took less than half the target latency
+func (indexer *Indexer) adaptBatchSize(latency time.Duration, response *elastic.BulkResponse, err error) {
+	adaptive := indexer.adaptiveBatchSize
+	if adaptive == nil {
+		return
+	}
+
+	throttled := elastic.IsStatusCode(err, http.StatusTooManyRequests)
+	if response != nil {
+		for _, items := range response.Items {
+			for _, item := range items {
+				if item.Status == http.StatusTooManyRequests {
+					throttled = true
+				}
+			}
+		}
+	}
+
+	for {
+		size := atomic.LoadInt64(&indexer.stats.AdaptiveBatchSizeBytes)
+		next := size
+		if throttled || latency > adaptive.targetLatency {
+			next = size / 2
+		} else if latency < adaptive.targetLatency/2 {
+			next = size + size/4
+		}
+
+		if next < adaptive.minBytes {
+			next = adaptive.minBytes
+		} else if next > adaptive.maxBytes {
+			next = adaptive.maxBytes
+		}
+
+		if next == size {
+			return
+		}
+		if atomic.CompareAndSwapInt64(&indexer.stats.AdaptiveBatchSizeBytes, size, next) {
+			log.Debugf("indexer (%v) adapted batch size from %d to %d bytes after %v bulk request (throttled: %v)", indexer.identifier, size, next, latency, throttled)
+			return
+		}
+	}
+}
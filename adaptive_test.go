@@ -0,0 +1,93 @@
+package elasticsearchutil
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+func TestAdaptiveBatchSizeIsClampedToBounds(t *testing.T) {
+	indexer, _ := newStubIndexer(t, nil, WithFlushThresholds(64, 0, 0), WithAdaptiveBatchSize(1024, 4096, time.Second))
+	if size := indexer.Stats().AdaptiveBatchSizeBytes; size != 1024 {
+		t.Errorf("expected the initial size to be clamped to the min bytes; got %d", size)
+	}
+	if limit := indexer.batchSizeLimit(); limit != 1024 {
+		t.Errorf("expected the adaptive size to be the batch size limit; got %d", limit)
+	}
+
+	unbounded, _ := newStubIndexer(t, nil, WithFlushThresholds(64, 0, 0))
+	if limit := unbounded.batchSizeLimit(); limit != 64 {
+		t.Errorf("expected the configured max batch size without adaptive mode; got %d", limit)
+	}
+}
+
+func TestAdaptBatchSizeFromLatencyAndThrottling(t *testing.T) {
+	indexer, _ := newStubIndexer(t, nil, WithFlushThresholds(2048, 0, 0), WithAdaptiveBatchSize(1024, 4096, time.Second))
+	size := func() int64 { return indexer.Stats().AdaptiveBatchSizeBytes }
+
+	indexer.adaptBatchSize(100*time.Millisecond, nil, nil)
+	if size() != 2560 {
+		t.Errorf("expected a fast request to grow the size by a quarter; got %d", size())
+	}
+	indexer.adaptBatchSize(700*time.Millisecond, nil, nil)
+	if size() != 2560 {
+		t.Errorf("expected a request within the target latency not to change the size; got %d", size())
+	}
+	indexer.adaptBatchSize(2*time.Second, nil, nil)
+	if size() != 1280 {
+		t.Errorf("expected a slow request to halve the size; got %d", size())
+	}
+
+	throttled := &elastic.BulkResponse{Items: []map[string]*elastic.BulkResponseItem{
+		{"index": {Status: http.StatusCreated}},
+		{"index": {Status: http.StatusTooManyRequests}},
+	}}
+	indexer.adaptBatchSize(time.Millisecond, throttled, nil)
+	if size() != 1024 {
+		t.Errorf("expected a throttled request to halve the size, clamped to the min bytes; got %d", size())
+	}
+
+	for i := 0; i < 10; i++ {
+		indexer.adaptBatchSize(time.Millisecond, nil, nil)
+	}
+	if size() != 4096 {
+		t.Errorf("expected the size to be clamped to the max bytes; got %d", size())
+	}
+}
+
+func TestWithAdaptiveBatchSizeShrinksThrottledBatches(t *testing.T) {
+	handler := func(req *stubRequest) (int, string) {
+		if strings.HasSuffix(req.Path, "/_bulk") {
+			return stubBulkResponse(t, req, func(i int, command *bulkCommand) stubItem {
+				return stubItem{status: http.StatusTooManyRequests, errType: "es_rejected_execution_exception", reason: "rejected execution"}
+			})
+		}
+		return http.StatusOK, "{}"
+	}
+	indexer, _ := newStubIndexer(t, handler, WithFlushThresholds(4096, 0, 0), WithAdaptiveBatchSize(1024, 4096, time.Minute), WithMaxRetries(0))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueAll(t, indexer, 1, testMessage("events", "1", `{"a":1}`))
+	waitIdle(t, indexer)
+
+	if size := indexer.Stats().AdaptiveBatchSizeBytes; size != 2048 {
+		t.Errorf("expected the throttled request to halve the batch size; got %d", size)
+	}
+}
+
+func TestWithAdaptiveBatchSizeValidatesBounds(t *testing.T) {
+	invalid := []IndexerOption{
+		WithAdaptiveBatchSize(0, 1024, time.Second),
+		WithAdaptiveBatchSize(2048, 1024, time.Second),
+		WithAdaptiveBatchSize(1024, 2048, 0),
+	}
+	for _, opt := range invalid {
+		if _, err := newIndexer(nil, "", opt); err == nil {
+			t.Errorf("expected invalid adaptive batch size to be rejected")
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// AssertIndexed refreshes the given index and returns an error describing each difference between
+// the source of the document with the given id and the expected document, or nil when they are equal;
+// it is intended as a read-your-writes convenience for integration tests
+func AssertIndexed(ctx context.Context, index, id string, expected json.RawMessage) error {
+	if err := Refresh(ctx, index); err != nil {
+		return err
+	}
+
+	result, err := Get(ctx, index, id)
+	if err != nil {
+		return err
+	}
+
+	if !result.Found {
+		return fmt.Errorf("document %s not found in elasticsearch index %s", id, index)
+	}
+
+	var expectedDoc, actualDoc interface{}
+	if err := jsonCodec.Unmarshal(expected, &expectedDoc); err != nil {
+		return fmt.Errorf("failed to parse expected document; %w", err)
+	}
+	if err := jsonCodec.Unmarshal(result.Source, &actualDoc); err != nil {
+		return fmt.Errorf("failed to parse source of document %s in elasticsearch index %s; %w", id, index, err)
+	}
+
+	diffs := diffJSON("", expectedDoc, actualDoc)
+	if len(diffs) > 0 {
+		return fmt.Errorf("document %s in elasticsearch index %s does not match expected document; %s", id, index, strings.Join(diffs, "; "))
+	}
+
+	return nil
+}
+
+// diffJSON returns a description of each difference between the given unmarshaled json values,
+// identifying nested object fields using dotted paths
+func diffJSON(path string, expected, actual interface{}) []string {
+	expectedObj, expectedIsObj := expected.(map[string]interface{})
+	actualObj, actualIsObj := actual.(map[string]interface{})
+	if !expectedIsObj || !actualIsObj {
+		if reflect.DeepEqual(expected, actual) {
+			return nil
+		}
+		if path == "" {
+			path = "."
+		}
+		return []string{fmt.Sprintf("%s: expected %v, got %v", path, expected, actual)}
+	}
+
+	keys := make([]string, 0, len(expectedObj)+len(actualObj))
+	for key := range expectedObj {
+		keys = append(keys, key)
+	}
+	for key := range actualObj {
+		if _, ok := expectedObj[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	diffs := make([]string, 0)
+	for _, key := range keys {
+		fieldPath := key
+		if path != "" {
+			fieldPath = fmt.Sprintf("%s.%s", path, key)
+		}
+
+		expectedVal, expectedOK := expectedObj[key]
+		actualVal, actualOK := actualObj[key]
+		if !actualOK {
+			diffs = append(diffs, fmt.Sprintf("%s: expected %v, missing", fieldPath, expectedVal))
+		} else if !expectedOK {
+			diffs = append(diffs, fmt.Sprintf("%s: unexpected %v", fieldPath, actualVal))
+		} else {
+			diffs = append(diffs, diffJSON(fieldPath, expectedVal, actualVal)...)
+		}
+	}
+
+	return diffs
+}
@@ -0,0 +1,76 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// getHandler returns a handler responding to get requests for the given document with the given
+// source, and to refresh requests
+func getHandler(index, id, source string) stubHandler {
+	return func(req *stubRequest) (int, string) {
+		switch {
+		case strings.HasSuffix(req.Path, "/_refresh"):
+			return http.StatusOK, `{"_shards":{"total":1,"successful":1,"failed":0}}`
+		case req.Method == http.MethodGet && req.Path == "/"+index+"/_doc/"+id:
+			return http.StatusOK, `{"_index":"` + index + `","_id":"` + id + `","found":true,"_source":` + source + `}`
+		case req.Method == http.MethodGet:
+			return http.StatusNotFound, `{"_index":"` + index + `","found":false}`
+		}
+		return http.StatusNotFound, `{}`
+	}
+}
+
+func TestAssertIndexedRefreshesAndMatchesDocument(t *testing.T) {
+	transport, restore := useStubClient(t, getHandler("events", "1", `{"a":1,"b":{"c":[1,2]}}`))
+	defer restore()
+
+	if err := AssertIndexed(context.Background(), "events", "1", json.RawMessage(`{"b":{"c":[1,2]},"a":1}`)); err != nil {
+		t.Errorf("expected the document to match; got %s", err.Error())
+	}
+	if refreshes := transport.find(http.MethodPost, "/events/_refresh"); len(refreshes) != 1 {
+		t.Errorf("expected the index to be refreshed; got %d refresh requests", len(refreshes))
+	}
+}
+
+func TestAssertIndexedDescribesDifferences(t *testing.T) {
+	_, restore := useStubClient(t, getHandler("events", "1", `{"a":2,"b":{"c":"x"},"extra":true}`))
+	defer restore()
+
+	err := AssertIndexed(context.Background(), "events", "1", json.RawMessage(`{"a":1,"b":{"c":"x","d":"y"}}`))
+	if err == nil {
+		t.Fatalf("expected the differences to be returned")
+	}
+	for _, diff := range []string{"a: expected 1, got 2", "b.d: expected y, missing", "extra: unexpected true"} {
+		if !strings.Contains(err.Error(), diff) {
+			t.Errorf("expected %q to be described; got %s", diff, err.Error())
+		}
+	}
+}
+
+func TestAssertIndexedReturnsErrorForMissingDocument(t *testing.T) {
+	_, restore := useStubClient(t, getHandler("events", "1", `{}`))
+	defer restore()
+
+	if err := AssertIndexed(context.Background(), "events", "2", json.RawMessage(`{}`)); err == nil || !strings.Contains(err.Error(), "document 2") {
+		t.Errorf("expected the missing document to be described; got %v", err)
+	}
+	if err := AssertIndexed(context.Background(), "events", "1", json.RawMessage(`{`)); err == nil || !strings.Contains(err.Error(), "failed to parse expected document") {
+		t.Errorf("expected an invalid expected document to be rejected; got %v", err)
+	}
+}
+
+func TestDiffJSONComparesNonObjects(t *testing.T) {
+	if diffs := diffJSON("", []interface{}{float64(1)}, []interface{}{float64(1)}); len(diffs) != 0 {
+		t.Errorf("expected equal arrays not to differ; got %v", diffs)
+	}
+
+	expected := []string{".: expected [1], got map[]"}
+	if diffs := diffJSON("", []interface{}{float64(1)}, map[string]interface{}{}); !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("expected %v; got %v", expected, diffs)
+	}
+}
@@ -0,0 +1,88 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// catNodesColumns are the columns requested of the _cat/nodes api, corresponding to CatNodesResponseRow
+const catNodesColumns = "ip,heap.percent,ram.percent,cpu,load_1m,load_5m,load_15m,node.role,master,name"
+
+// CatNodesResponseRow is a single node row of the _cat/nodes api; values are reported by elasticsearch as strings
+type CatNodesResponseRow struct {
+	IP          string `json:"ip"`
+	HeapPercent string `json:"heap.percent"`
+	RAMPercent  string `json:"ram.percent"`
+	CPU         string `json:"cpu"`
+	Load1m      string `json:"load_1m"`
+	Load5m      string `json:"load_5m"`
+	Load15m     string `json:"load_15m"`
+	NodeRole    string `json:"node.role"`
+	Master      string `json:"master"` // * for the elected master node
+	Name        string `json:"name"`
+}
+
+// CatIndices returns a row for each index of the cluster, including its health, document count and store size
+func CatIndices(ctx context.Context) ([]elastic.CatIndicesResponseRow, error) {
+	client, err := GetClient()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := client.CatIndices().Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cat elasticsearch indices; %w", err)
+	}
+
+	return rows, nil
+}
+
+// CatNodes returns a row for each node of the cluster, including its roles and resource utilization
+func CatNodes(ctx context.Context) ([]CatNodesResponseRow, error) {
+	client, err := GetClient()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method: "GET",
+		Path:   "/_cat/nodes",
+		Params: url.Values{
+			"format": []string{"json"},
+			"h":      []string{catNodesColumns},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to cat elasticsearch nodes; %w", err)
+	}
+
+	var rows []CatNodesResponseRow
+	if err := jsonCodec.Unmarshal(resp.Body, &rows); err != nil {
+		return nil, fmt.Errorf("failed to parse elasticsearch nodes; %w", err)
+	}
+
+	return rows, nil
+}
+
+// CatShards returns a row for each shard of the given index, or of all indices when the index is empty
+func CatShards(ctx context.Context, index string) ([]elastic.CatShardsResponseRow, error) {
+	client, err := GetClient()
+	if err != nil {
+		return nil, err
+	}
+
+	svc := client.CatShards()
+	if index != "" {
+		svc = svc.Index(index)
+	}
+
+	rows, err := svc.Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cat elasticsearch shards for index %s; %w", index, err)
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,91 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// catHandler returns a handler responding to _cat requests with fixed rows
+func catHandler() stubHandler {
+	return func(req *stubRequest) (int, string) {
+		switch {
+		case strings.HasPrefix(req.Path, "/_cat/indices"):
+			return http.StatusOK, `[{"health":"green","status":"open","index":"logs","docs.count":"42","store.size":"1kb"}]`
+		case req.Path == "/_cat/nodes":
+			return http.StatusOK, `[{"ip":"10.0.0.1","heap.percent":"42","node.role":"dim","master":"*","name":"es-1"},{"ip":"10.0.0.2","master":"-","name":"es-2"}]`
+		case strings.HasPrefix(req.Path, "/_cat/shards"):
+			return http.StatusOK, `[{"index":"logs","shard":"0","prirep":"p","state":"STARTED","node":"es-1"}]`
+		}
+		return http.StatusNotFound, `{}`
+	}
+}
+
+func TestCatIndices(t *testing.T) {
+	_, restore := useStubClient(t, catHandler())
+	defer restore()
+
+	rows, err := CatIndices(context.Background())
+	if err != nil {
+		t.Fatalf("failed to cat indices; %s", err.Error())
+	}
+	if len(rows) != 1 || rows[0].Index != "logs" || rows[0].Health != "green" || rows[0].DocsCount != 42 {
+		t.Errorf("expected the index row to be parsed; got %+v", rows)
+	}
+}
+
+func TestCatNodesRequestsColumnsAndParsesRows(t *testing.T) {
+	transport, restore := useStubClient(t, catHandler())
+	defer restore()
+
+	rows, err := CatNodes(context.Background())
+	if err != nil {
+		t.Fatalf("failed to cat nodes; %s", err.Error())
+	}
+	if len(rows) != 2 || rows[0].Name != "es-1" || rows[0].Master != "*" || rows[0].HeapPercent != "42" || rows[0].NodeRole != "dim" {
+		t.Errorf("expected the node rows to be parsed; got %+v", rows)
+	}
+
+	reqs := transport.find(http.MethodGet, "/_cat/nodes")
+	if len(reqs) != 1 {
+		t.Fatalf("expected 1 cat nodes request; got %d", len(reqs))
+	}
+	if reqs[0].Query.Get("format") != "json" || reqs[0].Query.Get("h") != catNodesColumns {
+		t.Errorf("expected json rows of the node columns to be requested; got %v", reqs[0].Query)
+	}
+}
+
+func TestCatShardsOfIndex(t *testing.T) {
+	transport, restore := useStubClient(t, catHandler())
+	defer restore()
+
+	rows, err := CatShards(context.Background(), "logs")
+	if err != nil {
+		t.Fatalf("failed to cat shards; %s", err.Error())
+	}
+	if len(rows) != 1 || rows[0].Index != "logs" || rows[0].Prirep != "p" || rows[0].State != "STARTED" {
+		t.Errorf("expected the shard row to be parsed; got %+v", rows)
+	}
+	if reqs := transport.find(http.MethodGet, "/_cat/shards/logs"); len(reqs) != 1 {
+		t.Errorf("expected the shards of index logs to be requested")
+	}
+
+	if _, err := CatShards(context.Background(), ""); err != nil {
+		t.Fatalf("failed to cat shards of all indices; %s", err.Error())
+	}
+	if reqs := transport.find(http.MethodGet, "/_cat/shards"); len(reqs) != 1 {
+		t.Errorf("expected the shards of all indices to be requested when no index is given")
+	}
+}
+
+func TestCatNodesReturnsFailures(t *testing.T) {
+	_, restore := useStubClient(t, func(req *stubRequest) (int, string) {
+		return http.StatusForbidden, `{"error":{"type":"security_exception","reason":"unauthorized"},"status":403}`
+	})
+	defer restore()
+
+	if _, err := CatNodes(context.Background()); err == nil || !strings.Contains(err.Error(), "failed to cat elasticsearch nodes") {
+		t.Errorf("expected the failure to be returned; got %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// CheckpointStore persists the cursor of the last acknowledged (i.e., indexed, rejected or dead-lettered)
+// message, i.e., an offset of the source from which messages are consumed, such that unacknowledged
+// messages can be replayed from the source after a restart; cursors are positive, and zero is loaded
+// when none is stored
+type CheckpointStore interface {
+	Load(ctx context.Context) (int64, error)
+	Store(ctx context.Context, cursor int64) error
+}
+
+// memoryCheckpointStore is the default CheckpointStore, which does not survive a restart
+type memoryCheckpointStore struct {
+	mutex  *sync.Mutex
+	cursor int64
+}
+
+// NewMemoryCheckpointStore returns a CheckpointStore which holds the cursor in memory
+func NewMemoryCheckpointStore() CheckpointStore {
+	return &memoryCheckpointStore{
+		mutex: &sync.Mutex{},
+	}
+}
+
+// Load returns the cursor last stored
+func (store *memoryCheckpointStore) Load(ctx context.Context) (int64, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return store.cursor, nil
+}
+
+// Store replaces the cursor
+func (store *memoryCheckpointStore) Store(ctx context.Context, cursor int64) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.cursor = cursor
+	return nil
+}
+
+// checkpointTracker advances the checkpoint of an indexer to the greatest cursor for which the
+// message with that cursor, and every message enqueued with a lesser cursor, has been acknowledged
+type checkpointTracker struct {
+	mutex      *sync.Mutex
+	store      CheckpointStore
+	checkpoint int64
+	pending    []int64        // cursors enqueued but not yet committed, in ascending order
+	acked      map[int64]bool // cursors acknowledged but not yet committed
+}
+
+func newCheckpointTracker(store CheckpointStore) *checkpointTracker {
+	return &checkpointTracker{
+		mutex: &sync.Mutex{},
+		store: store,
+		acked: map[int64]bool{},
+	}
+}
+
+// load restores the checkpoint from the store
+func (tracker *checkpointTracker) load(ctx context.Context) error {
+	checkpoint, err := tracker.store.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	tracker.checkpoint = checkpoint
+	return nil
+}
+
+// track records the enqueue of a message with the given cursor, returning false if the cursor was
+// already committed, i.e., the message is being replayed but was acknowledged before the restart
+func (tracker *checkpointTracker) track(cursor int64) bool {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	if cursor <= tracker.checkpoint {
+		return false
+	}
+
+	i := sort.Search(len(tracker.pending), func(i int) bool { return tracker.pending[i] >= cursor })
+	if i < len(tracker.pending) && tracker.pending[i] == cursor {
+		return true
+	}
+	tracker.pending = append(tracker.pending, 0)
+	copy(tracker.pending[i+1:], tracker.pending[i:])
+	tracker.pending[i] = cursor
+	return true
+}
+
+// untrack forgets the enqueue of the message with the given cursor, i.e., as it was not enqueued after all,
+// such that it does not hold back the checkpoint
+func (tracker *checkpointTracker) untrack(cursor int64) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	i := sort.Search(len(tracker.pending), func(i int) bool { return tracker.pending[i] >= cursor })
+	if i < len(tracker.pending) && tracker.pending[i] == cursor {
+		tracker.pending = append(tracker.pending[:i], tracker.pending[i+1:]...)
+	}
+}
+
+// ack records the acknowledgement of the message with the given cursor, storing the checkpoint
+// once it advances
+func (tracker *checkpointTracker) ack(cursor int64) error {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	if cursor <= tracker.checkpoint {
+		return nil
+	}
+	tracker.acked[cursor] = true
+
+	checkpoint := tracker.checkpoint
+	for len(tracker.pending) > 0 && tracker.acked[tracker.pending[0]] {
+		checkpoint = tracker.pending[0]
+		delete(tracker.acked, checkpoint)
+		tracker.pending = tracker.pending[1:]
+	}
+
+	if checkpoint == tracker.checkpoint {
+		return nil
+	}
+
+	// stored while locked such that the stored checkpoint never regresses
+	tracker.checkpoint = checkpoint
+	return tracker.store.Store(context.TODO(), checkpoint)
+}
+
+// Checkpoint returns the cursor of the last acknowledged message, from which the source should be
+// replayed after a restart; messages enqueued with a cursor at or before the checkpoint are skipped
+func (indexer *Indexer) Checkpoint() int64 {
+	indexer.checkpoints.mutex.Lock()
+	defer indexer.checkpoints.mutex.Unlock()
+	return indexer.checkpoints.checkpoint
+}
+
+// acknowledge advances the checkpoint past the given message, if it was enqueued with a cursor
+func (indexer *Indexer) acknowledge(msg *Message) {
+	if msg == nil || msg.Header == nil || msg.Header.Cursor == nil {
+		return
+	}
+
+	if err := indexer.checkpoints.ack(*msg.Header.Cursor); err != nil {
+		log.Warningf("indexer (%v) failed to store checkpoint at cursor %d; %s", indexer.identifier, *msg.Header.Cursor, err.Error())
+	}
+}
@@ -0,0 +1,152 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// fakeCheckpointStore is a CheckpointStore recording each stored cursor, optionally failing loads
+type fakeCheckpointStore struct {
+	mutex   sync.Mutex
+	cursor  int64
+	stored  []int64
+	loadErr error
+}
+
+func (store *fakeCheckpointStore) Load(ctx context.Context) (int64, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.loadErr != nil {
+		return 0, store.loadErr
+	}
+	return store.cursor, nil
+}
+
+func (store *fakeCheckpointStore) Store(ctx context.Context, cursor int64) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.cursor = cursor
+	store.stored = append(store.stored, cursor)
+	return nil
+}
+
+// storedCursors returns each cursor stored, in order
+func (store *fakeCheckpointStore) storedCursors() []int64 {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return append([]int64{}, store.stored...)
+}
+
+// cursorMessage returns a message for the given index and id enqueued at the given cursor
+func cursorMessage(index, id string, cursor int64) *Message {
+	msg := testMessage(index, id, `{"a":1}`)
+	msg.Header.Cursor = &cursor
+	return msg
+}
+
+func TestCheckpointTrackerAdvancesPastContiguousAcknowledgements(t *testing.T) {
+	store := &fakeCheckpointStore{}
+	tracker := newCheckpointTracker(store)
+
+	for _, cursor := range []int64{1, 2, 3} {
+		if !tracker.track(cursor) {
+			t.Fatalf("expected cursor %d to be tracked", cursor)
+		}
+	}
+
+	tracker.ack(2)
+	if tracker.checkpoint != 0 || len(store.storedCursors()) != 0 {
+		t.Errorf("expected the checkpoint to be held back by the unacknowledged cursor 1; got %d", tracker.checkpoint)
+	}
+	tracker.ack(1)
+	tracker.ack(3)
+
+	if stored := store.storedCursors(); len(stored) != 2 || stored[0] != 2 || stored[1] != 3 {
+		t.Errorf("expected checkpoints 2 then 3 to be stored; got %v", stored)
+	}
+	if tracker.track(3) {
+		t.Errorf("expected a committed cursor not to be tracked")
+	}
+}
+
+func TestCheckpointTrackerUntrackDoesNotHoldBackCheckpoint(t *testing.T) {
+	store := &fakeCheckpointStore{}
+	tracker := newCheckpointTracker(store)
+
+	tracker.track(1)
+	tracker.track(2)
+	tracker.untrack(1)
+	tracker.ack(2)
+
+	if tracker.checkpoint != 2 {
+		t.Errorf("expected the checkpoint to advance past the untracked cursor; got %d", tracker.checkpoint)
+	}
+}
+
+func TestIndexerCheckpointsAcknowledgedCursors(t *testing.T) {
+	var dead deadLetters
+	store := &fakeCheckpointStore{}
+	indexer, _ := newStubIndexer(t, rejectingBulkHandler(t, "2"), WithCheckpointStore(store), WithDeadLetterHandler(dead.handler()))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueAll(t, indexer, 3, cursorMessage("events", "1", 1), cursorMessage("events", "2", 2), cursorMessage("events", "3", 3))
+	waitIdle(t, indexer)
+
+	if dead.len() != 1 {
+		t.Fatalf("expected document 2 to be dead-lettered; got %d dead-lettered", dead.len())
+	}
+	if checkpoint := indexer.Checkpoint(); checkpoint != 3 {
+		t.Errorf("expected the checkpoint to advance past the indexed and dead-lettered documents; got %d", checkpoint)
+	}
+	if stored := store.storedCursors(); len(stored) == 0 || stored[len(stored)-1] != 3 {
+		t.Errorf("expected checkpoint 3 to be stored; got %v", stored)
+	}
+}
+
+func TestIndexerSkipsReplayedMessagesAtOrBeforeCheckpoint(t *testing.T) {
+	store := &fakeCheckpointStore{cursor: 2}
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithCheckpointStore(store))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	if checkpoint := indexer.Checkpoint(); checkpoint != 2 {
+		t.Fatalf("expected the stored checkpoint to be loaded; got %d", checkpoint)
+	}
+
+	replayed, acks := ackedMessage("events", "2", `{"a":1}`)
+	cursor := int64(2)
+	replayed.Header.Cursor = &cursor
+	enqueueAll(t, indexer, 1, cursorMessage("events", "1", 1), replayed, cursorMessage("events", "3", 3))
+	waitIdle(t, indexer)
+
+	if err := <-acks; err != nil {
+		t.Errorf("expected the replayed message to be acknowledged; got %s", err.Error())
+	}
+	if commands := sentCommands(t, transport); len(commands) != 1 || commands[0].meta["_id"] != "3" {
+		t.Errorf("expected only the message after the checkpoint to be sent; got %v", commands)
+	}
+	if checkpoint := indexer.Checkpoint(); checkpoint != 3 {
+		t.Errorf("expected the checkpoint to advance to 3; got %d", checkpoint)
+	}
+}
+
+func TestIndexerToleratesCheckpointLoadFailures(t *testing.T) {
+	store := &fakeCheckpointStore{cursor: 5, loadErr: errors.New("store unavailable")}
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithCheckpointStore(store))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueAll(t, indexer, 1, cursorMessage("events", "1", 1))
+	waitIdle(t, indexer)
+
+	if len(transport.find(http.MethodPost, "/_bulk")) != 1 {
+		t.Errorf("expected no message to be skipped without a loaded checkpoint")
+	}
+	if _, err := newIndexer(nil, "", WithCheckpointStore(nil)); err == nil {
+		t.Errorf("expected nil checkpoint store to be rejected")
+	}
+}
@@ -0,0 +1,65 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// GetClusterSettings returns the persistent and transient cluster settings (i.e., to inspect the
+// cluster.blocks.read_only_allow_delete flood-stage flag), keyed by persistent and transient
+func GetClusterSettings(ctx context.Context) (map[string]interface{}, error) {
+	client, err := GetClient()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method: "GET",
+		Path:   "/_cluster/settings",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get elasticsearch cluster settings; %w", err)
+	}
+
+	settings := map[string]interface{}{}
+	if err := jsonCodec.Unmarshal(resp.Body, &settings); err != nil {
+		return nil, fmt.Errorf("failed to parse elasticsearch cluster settings; %w", err)
+	}
+
+	return settings, nil
+}
+
+// WaitForIndexStatus blocks until the given indices reach at least the given health status
+// (i.e., yellow, once the primary shards of freshly created indices are allocated); the wait is
+// bounded by the deadline of the given context, if any, or the default cluster health timeout
+func WaitForIndexStatus(ctx context.Context, status string, indices ...string) error {
+	if status != "green" && status != "yellow" && status != "red" {
+		return fmt.Errorf("invalid elasticsearch health status %s; must be green, yellow or red", status)
+	}
+
+	client, err := GetClient()
+	if err != nil {
+		return err
+	}
+
+	svc := client.ClusterHealth().Index(indices...).WaitForStatus(status)
+	if deadline, ok := ctx.Deadline(); ok {
+		if timeout := time.Until(deadline); timeout > 0 {
+			svc = svc.Timeout(formatKeepAlive(timeout))
+		}
+	}
+
+	resp, err := svc.Do(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to wait for %s health status of elasticsearch indices %v; %w", status, indices, err)
+	}
+
+	if resp.TimedOut {
+		return fmt.Errorf("timed out waiting for %s health status of elasticsearch indices %v; current status %s", status, indices, resp.Status)
+	}
+
+	return nil
+}
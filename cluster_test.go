@@ -0,0 +1,98 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetClusterSettings(t *testing.T) {
+	transport, restore := useStubClient(t, func(req *stubRequest) (int, string) {
+		if req.Method == http.MethodGet && req.Path == "/_cluster/settings" {
+			return http.StatusOK, `{"persistent":{"cluster":{"blocks":{"read_only_allow_delete":"true"}}},"transient":{}}`
+		}
+		return http.StatusNotFound, `{}`
+	})
+	defer restore()
+
+	settings, err := GetClusterSettings(context.Background())
+	if err != nil {
+		t.Fatalf("failed to get cluster settings; %s", err.Error())
+	}
+	if len(transport.find(http.MethodGet, "/_cluster/settings")) != 1 {
+		t.Errorf("expected 1 cluster settings request")
+	}
+
+	persistent, _ := settings["persistent"].(map[string]interface{})
+	cluster, _ := persistent["cluster"].(map[string]interface{})
+	blocks, _ := cluster["blocks"].(map[string]interface{})
+	if blocks["read_only_allow_delete"] != "true" {
+		t.Errorf("expected the persistent flood-stage block; got %v", settings)
+	}
+	if _, ok := settings["transient"]; !ok {
+		t.Errorf("expected the transient settings; got %v", settings)
+	}
+}
+
+// clusterHealthHandler returns a handler responding to cluster health requests with the given status
+func clusterHealthHandler(status string, timedOut bool) stubHandler {
+	return func(req *stubRequest) (int, string) {
+		if req.Method == http.MethodGet && strings.HasPrefix(req.Path, "/_cluster/health") {
+			return http.StatusOK, fmt.Sprintf(`{"cluster_name":"test","status":"%s","timed_out":%t}`, status, timedOut)
+		}
+		return http.StatusNotFound, `{}`
+	}
+}
+
+func TestWaitForIndexStatus(t *testing.T) {
+	transport, restore := useStubClient(t, clusterHealthHandler("yellow", false))
+	defer restore()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := WaitForIndexStatus(ctx, "yellow", "logs", "events"); err != nil {
+		t.Fatalf("failed to wait for index status; %s", err.Error())
+	}
+
+	reqs := transport.find(http.MethodGet, "/_cluster/health/logs,events")
+	if len(reqs) != 1 {
+		t.Fatalf("expected 1 cluster health request for the given indices; got %d", len(reqs))
+	}
+	if status := reqs[0].Query.Get("wait_for_status"); status != "yellow" {
+		t.Errorf("expected to wait for yellow status; got %s", status)
+	}
+	if timeout := reqs[0].Query.Get("timeout"); !strings.HasSuffix(timeout, "ms") || timeout == "0ms" {
+		t.Errorf("expected the timeout to be bounded by the context deadline; got %q", timeout)
+	}
+
+	if err := WaitForIndexStatus(context.Background(), "green", "logs"); err != nil {
+		t.Fatalf("failed to wait for index status; %s", err.Error())
+	}
+	if reqs := transport.find(http.MethodGet, "/_cluster/health/logs"); len(reqs) != 1 || reqs[0].Query.Get("timeout") != "" {
+		t.Errorf("expected the default timeout without a context deadline")
+	}
+}
+
+func TestWaitForIndexStatusReportsTimeout(t *testing.T) {
+	_, restore := useStubClient(t, clusterHealthHandler("red", true))
+	defer restore()
+
+	if err := WaitForIndexStatus(context.Background(), "yellow", "logs"); err == nil || !strings.Contains(err.Error(), "current status red") {
+		t.Errorf("expected the timeout to be reported with the current status; got %v", err)
+	}
+}
+
+func TestWaitForIndexStatusValidatesStatus(t *testing.T) {
+	transport, restore := useStubClient(t, clusterHealthHandler("green", false))
+	defer restore()
+
+	if err := WaitForIndexStatus(context.Background(), "blue", "logs"); err == nil {
+		t.Errorf("expected an invalid status to be rejected")
+	}
+	if len(transport.find(http.MethodGet, "/logs")) != 0 {
+		t.Errorf("expected no cluster health request")
+	}
+}
@@ -0,0 +1,47 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// CreateDataStream creates the named data stream; a matching index template with data streams enabled must exist
+func CreateDataStream(ctx context.Context, name string) error {
+	client, err := GetClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = client.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method: "PUT",
+		Path:   fmt.Sprintf("/_data_stream/%s", url.PathEscape(name)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create elasticsearch data stream %s; %w", name, err)
+	}
+
+	log.Debugf("created elasticsearch data stream %s", name)
+	return nil
+}
+
+// DeleteDataStream deletes the named data stream and its backing indices
+func DeleteDataStream(ctx context.Context, name string) error {
+	client, err := GetClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = client.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method: "DELETE",
+		Path:   fmt.Sprintf("/_data_stream/%s", url.PathEscape(name)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete elasticsearch data stream %s; %w", name, err)
+	}
+
+	log.Debugf("deleted elasticsearch data stream %s", name)
+	return nil
+}
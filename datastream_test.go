@@ -0,0 +1,69 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/olivere/elastic/v7"
+)
+
+func TestCreateDataStream(t *testing.T) {
+	transport, restore := useStubClient(t, func(req *stubRequest) (int, string) {
+		return http.StatusOK, `{"acknowledged":true}`
+	})
+	defer restore()
+
+	if err := CreateDataStream(context.Background(), "logs-app"); err != nil {
+		t.Fatalf("failed to create data stream; %s", err.Error())
+	}
+	if len(transport.find(http.MethodPut, "/_data_stream/logs-app")) != 1 {
+		t.Errorf("expected 1 create data stream request")
+	}
+}
+
+func TestDeleteDataStreamWrapsErrors(t *testing.T) {
+	_, restore := useStubClient(t, func(req *stubRequest) (int, string) {
+		return http.StatusNotFound, `{"error":{"type":"index_not_found_exception","reason":"no such index [logs-app]"},"status":404}`
+	})
+	defer restore()
+
+	err := DeleteDataStream(context.Background(), "logs-app")
+	var esErr *elastic.Error
+	if !errors.As(err, &esErr) || esErr.Status != http.StatusNotFound {
+		t.Errorf("expected wrapped *elastic.Error; got %v", err)
+	}
+}
+
+func TestIndexerSendsCreateOpsToDataStreams(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	msg := testMessage("logs-app", "", `{"@timestamp":"2020-01-01T00:00:00Z"}`)
+	msg.Header.DataStream = true
+	if err := indexer.Q(msg); err != nil {
+		t.Fatalf("failed to enqueue message; %s", err.Error())
+	}
+	waitIdle(t, indexer)
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 1 {
+		t.Fatalf("expected 1 bulk action; got %d", len(commands))
+	}
+	if commands[0].op != OpCreate {
+		t.Errorf("expected %s op; got %s", OpCreate, commands[0].op)
+	}
+}
+
+func TestBulkRequestRejectsIndexOpsForDataStreams(t *testing.T) {
+	indexer, _ := newStubIndexer(t, nil)
+
+	msg := testMessage("logs-app", "1", `{"a":1}`)
+	msg.Header.DataStream = true
+	msg.Header.Op = stringOrNil(OpIndex)
+	if _, err := indexer.bulkRequest(msg); err == nil {
+		t.Errorf("expected %s op targeting a data stream to be rejected", OpIndex)
+	}
+}
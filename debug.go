@@ -0,0 +1,52 @@
+package elasticsearchutil
+
+import (
+	"bytes"
+)
+
+// LastBulkBody returns the ndjson body of the most recent bulk request sent by the indexer, truncated
+// to the max bytes configured using WithDebugBodies; nil is returned unless debug bodies are enabled
+func (indexer *Indexer) LastBulkBody() []byte {
+	indexer.debugMutex.Lock()
+	defer indexer.debugMutex.Unlock()
+
+	if indexer.lastBulkBody == nil {
+		return nil
+	}
+
+	body := make([]byte, len(indexer.lastBulkBody))
+	copy(body, indexer.lastBulkBody)
+	return body
+}
+
+// recordBulkBody retains the ndjson body of the given batch, when debug bodies are enabled
+func (indexer *Indexer) recordBulkBody(batch *bulkBatch) {
+	if indexer.debugBodyMaxBytes <= 0 {
+		return
+	}
+
+	var body bytes.Buffer
+	for _, action := range batch.pending {
+		lines, err := action.req.Source()
+		if err != nil {
+			log.Debugf("indexer (%v) failed to serialize bulk action for debugging; %s", indexer.identifier, err.Error())
+			continue
+		}
+		for _, line := range lines {
+			body.WriteString(line)
+			body.WriteByte('\n')
+		}
+		if body.Len() >= indexer.debugBodyMaxBytes {
+			break
+		}
+	}
+
+	recorded := body.Bytes()
+	if len(recorded) > indexer.debugBodyMaxBytes {
+		recorded = recorded[:indexer.debugBodyMaxBytes]
+	}
+
+	indexer.debugMutex.Lock()
+	defer indexer.debugMutex.Unlock()
+	indexer.lastBulkBody = recorded
+}
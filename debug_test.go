@@ -0,0 +1,57 @@
+package elasticsearchutil
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLastBulkBodyReturnsSentBody(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithDebugBodies(1024))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	if indexer.LastBulkBody() != nil {
+		t.Errorf("expected no body before a bulk request is sent")
+	}
+
+	enqueueAll(t, indexer, 2, testMessage("events", "1", `{"a":1}`), testMessage("events", "2", `{"a":2}`))
+	waitIdle(t, indexer)
+
+	reqs := transport.bulkRequests()
+	if len(reqs) != 1 {
+		t.Fatalf("expected 1 bulk request; got %d", len(reqs))
+	}
+	if body := indexer.LastBulkBody(); !bytes.Equal(body, reqs[0].Body) {
+		t.Errorf("expected the sent body; got %s, sent %s", body, reqs[0].Body)
+	}
+}
+
+func TestLastBulkBodyIsTruncatedToMaxBytes(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithDebugBodies(16))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueAll(t, indexer, 1, testMessage("events", "1", `{"a":1}`))
+	waitIdle(t, indexer)
+
+	body := indexer.LastBulkBody()
+	if len(body) != 16 || !bytes.HasPrefix(transport.bulkRequests()[0].Body, body) {
+		t.Errorf("expected the first 16 bytes of the sent body; got %q", body)
+	}
+}
+
+func TestLastBulkBodyIsNilUnlessEnabled(t *testing.T) {
+	indexer, _ := newStubIndexer(t, okBulkHandler(t))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueAll(t, indexer, 1, testMessage("events", "1", `{"a":1}`))
+	waitIdle(t, indexer)
+
+	if body := indexer.LastBulkBody(); body != nil {
+		t.Errorf("expected no body without debug bodies; got %s", body)
+	}
+	if _, err := newIndexer(nil, "", WithDebugBodies(0)); err == nil {
+		t.Errorf("expected non-positive debug body max bytes to be rejected")
+	}
+}
@@ -0,0 +1,91 @@
+package elasticsearchutil
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// dedupeKey returns the key identifying the document targeted by the given message within a batch,
+// or an empty string when the message does not target a known document id
+func dedupeKey(msg *Message) string {
+	if msg.Header.ID == nil {
+		return ""
+	}
+
+	routing := ""
+	if msg.Header.Routing != nil {
+		routing = *msg.Header.Routing
+	}
+
+	return fmt.Sprintf("%s/%s/%s", *msg.Header.Index, routing, *msg.Header.ID)
+}
+
+// isCollapsibleOp returns true for ops replacing the entire document; a create or partial
+// update depends upon the preceding op targeting the document, which cannot be collapsed
+func isCollapsibleOp(msg *Message) bool {
+	op := messageOp(msg)
+	return op == OpIndex || op == OpDelete
+}
+
+// deduplicate collapses the given action into a buffered action targeting the same document, when
+// deduplication is enabled, returning true if collapsed; the latest op replaces the earlier one in place,
+// retaining the superseded message until the outcome of the replacing action is known
+func (indexer *Indexer) deduplicate(action *queuedAction) bool {
+	if !indexer.dedupe {
+		return false
+	}
+
+	key := dedupeKey(action.msg)
+	if key == "" {
+		return false
+	}
+
+	if indexer.dedupeKeys == nil {
+		indexer.dedupeKeys = map[string]int{}
+	}
+
+	if !isCollapsibleOp(action.msg) {
+		delete(indexer.dedupeKeys, key)
+		return false
+	}
+
+	i, ok := indexer.dedupeKeys[key]
+	if !ok {
+		indexer.dedupeKeys[key] = len(indexer.pending)
+		return false
+	}
+
+	superseded := indexer.pending[i]
+	indexer.pending[i] = action
+	indexer.queueSizeInBytes += action.size - superseded.size
+
+	atomic.AddInt64(&indexer.stats.Deduplicated, 1)
+	atomic.AddInt64(&indexer.stats.DeduplicatedBytes, int64(superseded.size))
+	log.Tracef("indexer (%v) collapsed buffered action for document %s", indexer.identifier, key)
+
+	// the superseded message is settled with the outcome of the action replacing it
+	action.superseded = append(action.superseded, superseded.superseded...)
+	action.superseded = append(action.superseded, superseded.msg)
+	return true
+}
+
+// rebuildDedupeKeys reindexes the positions of the buffered actions after they are reordered
+func (indexer *Indexer) rebuildDedupeKeys() {
+	if !indexer.dedupe {
+		return
+	}
+
+	indexer.dedupeKeys = map[string]int{}
+	for i, action := range indexer.pending {
+		key := dedupeKey(action.msg)
+		if key == "" {
+			continue
+		}
+
+		if isCollapsibleOp(action.msg) {
+			indexer.dedupeKeys[key] = i
+		} else {
+			delete(indexer.dedupeKeys, key)
+		}
+	}
+}
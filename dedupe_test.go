@@ -0,0 +1,138 @@
+package elasticsearchutil
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// enqueueAll enqueues the given messages to the given running indexer, waiting until the queue is
+// consumed and the given number of actions remain buffered
+func enqueueAll(t *testing.T, indexer *Indexer, buffered int, msgs ...*Message) {
+	t.Helper()
+	for _, msg := range msgs {
+		if err := indexer.Q(msg); err != nil {
+			t.Fatalf("failed to enqueue message; %s", err.Error())
+		}
+	}
+	waitFor(t, "messages to be buffered", func() bool {
+		return len(indexer.q) == 0 && atomic.LoadInt64(&indexer.bufferedActions) == int64(buffered)
+	})
+}
+
+func TestWithDeduplicationCollapsesActionsTargetingSameDocument(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithDeduplication())
+	stop := runIndexer(indexer)
+	defer stop()
+
+	del := testMessage("events", "1", "")
+	del.Header.Op = stringOrNil(OpDelete)
+	enqueueAll(t, indexer, 2,
+		testMessage("events", "1", `{"v":1}`),
+		testMessage("events", "2", `{"v":1}`),
+		del,
+		testMessage("events", "1", `{"v":3}`),
+	)
+	waitIdle(t, indexer)
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 2 {
+		t.Fatalf("expected 2 bulk actions; got %d", len(commands))
+	}
+	if commands[0].op != OpIndex || commands[0].meta["_id"] != "1" || string(commands[0].source) != `{"v":3}` {
+		t.Errorf("expected the latest op for document 1 in place of the first; got %s %v %s", commands[0].op, commands[0].meta, commands[0].source)
+	}
+
+	stats := indexer.Stats()
+	if stats.Deduplicated != 2 || stats.DeduplicatedBytes != 7 {
+		t.Errorf("expected 2 collapsed actions of 7 bytes; got %d of %d bytes", stats.Deduplicated, stats.DeduplicatedBytes)
+	}
+}
+
+func TestWithDeduplicationDoesNotCollapseAcrossNonCollapsibleOps(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithDeduplication())
+	stop := runIndexer(indexer)
+	defer stop()
+
+	update := testMessage("events", "1", `{"v":2}`)
+	update.Header.Op = stringOrNil(OpUpdate)
+	routed := testMessage("events", "1", `{"v":4}`)
+	routed.Header.Routing = stringOrNil("tenant-1")
+	enqueueAll(t, indexer, 4,
+		testMessage("events", "1", `{"v":1}`),
+		update,
+		testMessage("events", "1", `{"v":3}`),
+		routed,
+	)
+	waitIdle(t, indexer)
+
+	if commands := sentCommands(t, transport); len(commands) != 4 {
+		t.Errorf("expected the actions on either side of the update, and the routed action, not to be collapsed; got %d bulk actions", len(commands))
+	}
+	if stats := indexer.Stats(); stats.Deduplicated != 0 {
+		t.Errorf("expected no collapsed actions; got %d", stats.Deduplicated)
+	}
+}
+
+func TestIndexerDoesNotDeduplicateByDefault(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueAll(t, indexer, 2, testMessage("events", "1", `{"v":1}`), testMessage("events", "1", `{"v":2}`))
+	waitIdle(t, indexer)
+
+	if commands := sentCommands(t, transport); len(commands) != 2 {
+		t.Errorf("expected 2 bulk actions; got %d", len(commands))
+	}
+}
+
+func TestWithDeduplicationSettlesSupersededMessagesWithOutcomeOfReplacement(t *testing.T) {
+	indexer, _ := newStubIndexer(t, rejectingBulkHandler(t, "1"), WithDeduplication())
+	stop := runIndexer(indexer)
+	defer stop()
+
+	superseded, supersededAcks := ackedMessage("events", "1", `{"a":1}`)
+	replacement, replacementAcks := ackedMessage("events", "1", `{"a":2}`)
+	enqueueAll(t, indexer, 1, superseded, replacement)
+
+	select {
+	case err := <-supersededAcks:
+		t.Fatalf("expected the superseded message not to be settled until its replacement is; got %v", err)
+	default:
+	}
+	waitIdle(t, indexer)
+
+	replacementErr := <-replacementAcks
+	if replacementErr == nil {
+		t.Fatalf("expected the replacement to be rejected")
+	}
+	if err := <-supersededAcks; err != replacementErr {
+		t.Errorf("expected the superseded message to be settled with the outcome of its replacement; got %v", err)
+	}
+}
+
+func TestWithDeduplicationSettlesSupersededMessagesOnceReplacementIsRetried(t *testing.T) {
+	indexer, transport := newStubIndexer(t, failingBulkHandler(t, http.StatusTooManyRequests, 1),
+		WithDeduplication(),
+		WithRetryBackoff(time.Millisecond, time.Millisecond),
+	)
+	stop := runIndexer(indexer)
+	defer stop()
+
+	superseded, supersededAcks := ackedMessage("events", "1", `{"a":1}`)
+	replacement, replacementAcks := ackedMessage("events", "1", `{"a":2}`)
+	enqueueAll(t, indexer, 1, superseded, replacement)
+	waitIdle(t, indexer)
+
+	if len(transport.bulkRequests()) != 2 {
+		t.Fatalf("expected the replacement to be retried; got %d bulk requests", len(transport.bulkRequests()))
+	}
+	if err := <-replacementAcks; err != nil {
+		t.Errorf("expected the retried replacement to be indexed; got %s", err.Error())
+	}
+	if err := <-supersededAcks; err != nil {
+		t.Errorf("expected the superseded message to be settled once its replacement was indexed; got %s", err.Error())
+	}
+}
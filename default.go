@@ -0,0 +1,36 @@
+package elasticsearchutil
+
+import (
+	"sync"
+)
+
+var (
+	defaultIndexer     *Indexer
+	defaultIndexerOnce sync.Once
+)
+
+// DefaultIndexer returns the shared indexer, which is initialized from the environment and run in
+// the background upon the first call; elasticsearch is required from the environment at that time
+// unless RequireElasticsearch was already called. Every call returns the same instance.
+func DefaultIndexer() *Indexer {
+	defaultIndexerOnce.Do(func() {
+		if len(elasticClients) == 0 {
+			RequireElasticsearch()
+		}
+
+		indexer, err := NewIndexer()
+		if err != nil {
+			log.Panicf("failed to initialize default indexer; %s", err.Error())
+		}
+
+		defaultIndexer = indexer
+		go defaultIndexer.Run()
+	})
+
+	return defaultIndexer
+}
+
+// QDefault enqueues the given message using the shared indexer returned by DefaultIndexer
+func QDefault(msg *Message) error {
+	return DefaultIndexer().Q(msg)
+}
@@ -0,0 +1,37 @@
+package elasticsearchutil
+
+import (
+	"sync"
+	"testing"
+)
+
+// resetDefaultIndexer stops the shared indexer, if any, such that the next call to DefaultIndexer
+// initializes a new instance
+func resetDefaultIndexer() {
+	if defaultIndexer != nil {
+		defaultIndexer.Stop()
+	}
+	defaultIndexer = nil
+	defaultIndexerOnce = sync.Once{}
+}
+
+func TestDefaultIndexerReturnsSharedInstance(t *testing.T) {
+	transport, restore := useStubClient(t, okBulkHandler(t))
+	defer restore()
+	defer resetDefaultIndexer()
+
+	indexer := DefaultIndexer()
+	if indexer == nil || DefaultIndexer() != indexer {
+		t.Fatalf("expected every call to return the same indexer")
+	}
+
+	if err := QDefault(testMessage("events", "1", `{"a":1}`)); err != nil {
+		t.Fatalf("failed to enqueue message; %s", err.Error())
+	}
+	waitIdle(t, indexer)
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 1 || commands[0].meta["_id"] != "1" {
+		t.Errorf("expected the message to be indexed by the running shared indexer; got %d bulk actions", len(commands))
+	}
+}
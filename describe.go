@@ -0,0 +1,57 @@
+package elasticsearchutil
+
+import (
+	"fmt"
+)
+
+// Describe returns the effective configuration of the indexer, i.e., to confirm the environment was
+// parsed as expected; credentials are redacted, and durations are described in their string form
+func (indexer *Indexer) Describe() map[string]interface{} {
+	authMode := "none"
+	if elasticUsername != nil || elasticPassword != nil {
+		authMode = "basic"
+	}
+
+	hosts := make([]string, len(elasticHosts))
+	for i, host := range elasticHosts {
+		hosts[i] = redactURL(host)
+	}
+
+	pipeline := ""
+	if elasticDefaultPipeline != nil {
+		pipeline = *elasticDefaultPipeline
+	}
+
+	return map[string]interface{}{
+		"identifier":             indexer.identifier,
+		"url":                    redactURL(indexer.clientURL),
+		"hosts":                  hosts,
+		"auth_mode":              authMode,
+		"timeout":                fmt.Sprintf("%ds", elasticTimeout),
+		"gzip_enabled":           elasticGzipEnabled,
+		"gzip_threshold_bytes":   elasticGzipThresholdBytes,
+		"gzip_level":             elasticGzipLevel,
+		"default_pipeline":       pipeline,
+		"buffer_size":            cap(indexer.q),
+		"retry_buffer_size":      cap(indexer.retryQ),
+		"max_retries":            indexer.maxRetries,
+		"retry_backoff":          indexer.retryBackoff.String(),
+		"max_retry_backoff":      indexer.maxRetryBackoff.String(),
+		"max_batch_size_bytes":   indexer.maxBatchSizeBytes,
+		"max_batch_actions":      indexer.maxBatchActions,
+		"max_batch_interval":     indexer.maxBatchInterval.String(),
+		"min_batch_actions":      indexer.minBatchActions,
+		"max_document_age":       indexer.maxDocumentAge.String(),
+		"max_document_bytes":     indexer.maxDocumentBytes,
+		"max_in_flight_bytes":    indexer.maxInFlightBytes,
+		"max_buffered_bytes":     indexer.maxBufferedBytes,
+		"flush_workers":          indexer.flushWorkers,
+		"flush_jitter":           indexer.flushJitter,
+		"shutdown_flush_timeout": indexer.shutdownFlushTimeout.String(),
+		"wait_for_active_shards": indexer.waitForActiveShards,
+		"deduplication":          indexer.dedupe,
+		"homogeneous_batches":    indexer.homogeneousBatches,
+		"load_mode":              indexer.loadMode,
+		"require_alias":          indexer.requireAlias,
+	}
+}
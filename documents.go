@@ -0,0 +1,149 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// UpdateByQuery runs the given painless script against each document in the given index matching
+// the given query, returning the number of documents updated; the update is aborted when a version
+// conflict is encountered
+func UpdateByQuery(ctx context.Context, index string, query elastic.Query, script string, params map[string]interface{}) (int64, error) {
+	return updateByQuery(ctx, index, query, script, params, false)
+}
+
+// UpdateByQueryProceedOnConflicts runs the given painless script against each document in the given
+// index matching the given query, returning the number of documents updated; documents which were
+// modified concurrently (i.e., version conflicts) are skipped rather than aborting the update
+func UpdateByQueryProceedOnConflicts(ctx context.Context, index string, query elastic.Query, script string, params map[string]interface{}) (int64, error) {
+	return updateByQuery(ctx, index, query, script, params, true)
+}
+
+func updateByQuery(ctx context.Context, index string, query elastic.Query, script string, params map[string]interface{}, proceedOnConflicts bool) (int64, error) {
+	client, err := GetClient()
+	if err != nil {
+		return 0, err
+	}
+
+	svc := client.UpdateByQuery(index).
+		Query(query).
+		Script(elastic.NewScript(script).Lang("painless").Params(params))
+	if proceedOnConflicts {
+		svc.ProceedOnVersionConflict()
+	}
+
+	response, err := svc.Do(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update documents by query in elasticsearch index %s; %w", index, err)
+	}
+
+	if len(response.Failures) > 0 {
+		return response.Updated, fmt.Errorf("failed to update %d document(s) by query in elasticsearch index %s", len(response.Failures), index)
+	}
+
+	log.Debugf("updated %d document(s) by query in elasticsearch index %s; %d version conflict(s)", response.Updated, index, response.VersionConflicts)
+	return response.Updated, nil
+}
+
+// NewUpdateMessageFromHit builds an OpUpdate message merging the given partial document into the
+// document of the given search hit, which fails if the document changed since it was read; the hit
+// must have been returned by a search using WithSeqNoPrimaryTerm
+func NewUpdateMessageFromHit(hit *elastic.SearchHit, doc []byte) (*Message, error) {
+	if hit.SeqNo == nil || hit.PrimaryTerm == nil {
+		return nil, fmt.Errorf("failed to build update message for document %s in index %s; hit has no seq_no or primary_term", hit.Id, hit.Index)
+	}
+
+	op := OpUpdate
+	index := hit.Index
+	id := hit.Id
+	seqNo := *hit.SeqNo
+	primaryTerm := *hit.PrimaryTerm
+
+	header := &MessageHeader{
+		ID:            &id,
+		Index:         &index,
+		Op:            &op,
+		IfSeqNo:       &seqNo,
+		IfPrimaryTerm: &primaryTerm,
+	}
+	header.Routing = stringOrNil(hit.Routing)
+
+	return &Message{
+		Header:  header,
+		Payload: doc,
+	}, nil
+}
+
+// BulkDelete deletes the documents with the given ids from the given index in a single bulk request,
+// using the routing mapped to each id, if any; the response is returned for inspection of per-id results
+func BulkDelete(ctx context.Context, index string, ids []string, routing map[string]string) (*elastic.BulkResponse, error) {
+	client, err := GetClient()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("failed to bulk delete documents in elasticsearch index %s; no ids provided", index)
+	}
+
+	svc := client.Bulk()
+	for _, id := range ids {
+		req := elastic.NewBulkDeleteRequest().Index(index).Id(id)
+		if r, ok := routing[id]; ok && r != "" {
+			req.Routing(r)
+		}
+		svc.Add(req)
+	}
+
+	response, err := svc.Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bulk delete %d document(s) in elasticsearch index %s; %w", len(ids), index, err)
+	}
+
+	log.Debugf("bulk deleted %d of %d document(s) in elasticsearch index %s", len(response.Deleted()), len(ids), index)
+	return response, nil
+}
+
+// Get returns the document with the given id in the given index; an error is returned when the document is not found
+func Get(ctx context.Context, index, id string) (*elastic.GetResult, error) {
+	client, err := GetClient()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.Get().Index(index).Id(id).Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document %s in elasticsearch index %s; %w", id, index, err)
+	}
+
+	return result, nil
+}
+
+// BulkUpsert upserts each of the given documents, keyed by id, into the given index in a single bulk
+// request, merging each document into the existing document or creating it when none exists; the
+// response is returned for inspection of per-id results
+func BulkUpsert(ctx context.Context, index string, docs map[string]map[string]interface{}) (*elastic.BulkResponse, error) {
+	client, err := GetClient()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("failed to bulk upsert documents in elasticsearch index %s; no documents provided", index)
+	}
+
+	svc := client.Bulk()
+	for id, doc := range docs {
+		svc.Add(elastic.NewBulkUpdateRequest().Index(index).Id(id).Doc(doc).DocAsUpsert(true))
+	}
+
+	response, err := svc.Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bulk upsert %d document(s) in elasticsearch index %s; %w", len(docs), index, err)
+	}
+
+	log.Debugf("bulk upserted %d of %d document(s) in elasticsearch index %s", len(response.Succeeded()), len(docs), index)
+	return response, nil
+}
@@ -0,0 +1,218 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// updateByQueryHandler returns a handler responding to update by query requests with the given response body
+func updateByQueryHandler(response string) stubHandler {
+	return func(req *stubRequest) (int, string) {
+		if req.Method == http.MethodPost && req.Path == "/logs/_update_by_query" {
+			return http.StatusOK, response
+		}
+		return http.StatusNotFound, `{}`
+	}
+}
+
+func TestUpdateByQuerySendsPainlessScript(t *testing.T) {
+	transport, restore := useStubClient(t, updateByQueryHandler(`{"updated":3,"failures":[]}`))
+	defer restore()
+
+	updated, err := UpdateByQuery(context.Background(), "logs", elastic.NewTermQuery("level", "warn"), "ctx._source.level = params.level", map[string]interface{}{"level": "warning"})
+	if err != nil {
+		t.Fatalf("failed to update by query; %s", err.Error())
+	}
+	if updated != 3 {
+		t.Errorf("expected 3 documents updated; got %d", updated)
+	}
+
+	reqs := transport.find(http.MethodPost, "/logs/_update_by_query")
+	if len(reqs) != 1 {
+		t.Fatalf("expected 1 update by query request; got %d", len(reqs))
+	}
+	if conflicts := reqs[0].Query.Get("conflicts"); conflicts != "" {
+		t.Errorf("expected the update to abort on conflicts; got conflicts=%s", conflicts)
+	}
+
+	var body struct {
+		Script struct {
+			Source string                 `json:"source"`
+			Lang   string                 `json:"lang"`
+			Params map[string]interface{} `json:"params"`
+		} `json:"script"`
+	}
+	if err := jsonCodec.Unmarshal(reqs[0].Body, &body); err != nil {
+		t.Fatalf("failed to parse update by query body; %s", err.Error())
+	}
+	if body.Script.Lang != "painless" || body.Script.Source != "ctx._source.level = params.level" || body.Script.Params["level"] != "warning" {
+		t.Errorf("expected painless script with params to be sent; got %s", reqs[0].Body)
+	}
+}
+
+func TestUpdateByQueryProceedOnConflicts(t *testing.T) {
+	transport, restore := useStubClient(t, updateByQueryHandler(`{"updated":1,"version_conflicts":2,"failures":[]}`))
+	defer restore()
+
+	if _, err := UpdateByQueryProceedOnConflicts(context.Background(), "logs", elastic.NewMatchAllQuery(), "ctx._source.n++", nil); err != nil {
+		t.Fatalf("failed to update by query; %s", err.Error())
+	}
+
+	reqs := transport.find(http.MethodPost, "/logs/_update_by_query")
+	if len(reqs) != 1 || reqs[0].Query.Get("conflicts") != "proceed" {
+		t.Errorf("expected conflicts=proceed")
+	}
+}
+
+func TestUpdateByQueryReturnsFailures(t *testing.T) {
+	_, restore := useStubClient(t, updateByQueryHandler(`{"updated":1,"failures":[{"index":"logs","id":"2","cause":{"type":"script_exception","reason":"runtime error"},"status":400}]}`))
+	defer restore()
+
+	updated, err := UpdateByQuery(context.Background(), "logs", elastic.NewMatchAllQuery(), "ctx._source.n++", nil)
+	if err == nil {
+		t.Fatalf("expected failures to be returned as an error")
+	}
+	if updated != 1 {
+		t.Errorf("expected the number of documents updated to be returned; got %d", updated)
+	}
+}
+
+func TestNewUpdateMessageFromHitUsesSeqNoAndPrimaryTerm(t *testing.T) {
+	hits := `[{"_index":"orders","_id":"1","_routing":"customer-1","_seq_no":7,"_primary_term":2,"_source":{"a":1}}]`
+	transport, restore := useStubClient(t, searchHandler(hits))
+	defer restore()
+
+	result, err := Search(context.Background(), "orders", nil, WithSeqNoPrimaryTerm())
+	if err != nil {
+		t.Fatalf("failed to search; %s", err.Error())
+	}
+	if param := transport.find(http.MethodPost, "/orders/_search")[0].Query.Get("seq_no_primary_term"); param != "true" {
+		t.Errorf("expected seq_no_primary_term to be requested; got %q", param)
+	}
+
+	msg, err := NewUpdateMessageFromHit(result.Hits.Hits[0], []byte(`{"b":2}`))
+	if err != nil {
+		t.Fatalf("failed to build update message; %s", err.Error())
+	}
+	if *msg.Header.Op != OpUpdate || *msg.Header.ID != "1" || *msg.Header.Routing != "customer-1" {
+		t.Errorf("expected routed update of document 1; got %+v", msg.Header)
+	}
+
+	indexer, bulkTransport := newStubIndexer(t, okBulkHandler(t))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	if err := indexer.Q(msg); err != nil {
+		t.Fatalf("failed to enqueue message; %s", err.Error())
+	}
+	waitIdle(t, indexer)
+
+	commands := sentCommands(t, bulkTransport)
+	if len(commands) != 1 {
+		t.Fatalf("expected 1 bulk action; got %d", len(commands))
+	}
+	if commands[0].meta["if_seq_no"] != float64(7) || commands[0].meta["if_primary_term"] != float64(2) {
+		t.Errorf("expected the update to be conditioned on seq_no 7 and primary_term 2; got %v", commands[0].meta)
+	}
+}
+
+func TestNewUpdateMessageFromHitRequiresSeqNoAndPrimaryTerm(t *testing.T) {
+	if _, err := NewUpdateMessageFromHit(&elastic.SearchHit{Index: "orders", Id: "1"}, []byte(`{"b":2}`)); err == nil {
+		t.Errorf("expected a hit without seq_no and primary_term to be rejected")
+	}
+}
+
+func TestBulkDeleteRoutesEachID(t *testing.T) {
+	transport, restore := useStubClient(t, okBulkHandler(t))
+	defer restore()
+
+	response, err := BulkDelete(context.Background(), "orders", []string{"1", "2"}, map[string]string{"2": "customer-2"})
+	if err != nil {
+		t.Fatalf("failed to bulk delete; %s", err.Error())
+	}
+	if len(response.Deleted()) != 2 {
+		t.Errorf("expected 2 deleted documents; got %d", len(response.Deleted()))
+	}
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 2 {
+		t.Fatalf("expected 2 bulk actions; got %d", len(commands))
+	}
+	for _, command := range commands {
+		if command.op != OpDelete || command.meta["_index"] != "orders" {
+			t.Errorf("expected delete from index orders; got %s %v", command.op, command.meta)
+		}
+	}
+	if _, ok := commands[0].meta["routing"]; ok {
+		t.Errorf("expected no routing for document 1; got %v", commands[0].meta)
+	}
+	if commands[1].meta["routing"] != "customer-2" {
+		t.Errorf("expected document 2 to be routed to customer-2; got %v", commands[1].meta)
+	}
+}
+
+func TestBulkDeleteRequiresIDs(t *testing.T) {
+	transport, restore := useStubClient(t, okBulkHandler(t))
+	defer restore()
+
+	if _, err := BulkDelete(context.Background(), "orders", nil, nil); err == nil {
+		t.Errorf("expected bulk delete without ids to be rejected")
+	}
+	if len(transport.bulkRequests()) != 0 {
+		t.Errorf("expected no bulk request")
+	}
+}
+
+func TestBulkUpsertSendsDocAsUpsert(t *testing.T) {
+	transport, restore := useStubClient(t, okBulkHandler(t))
+	defer restore()
+
+	response, err := BulkUpsert(context.Background(), "orders", map[string]map[string]interface{}{
+		"1": {"status": "paid"},
+		"2": {"status": "shipped"},
+	})
+	if err != nil {
+		t.Fatalf("failed to bulk upsert; %s", err.Error())
+	}
+	if len(response.Updated()) != 2 {
+		t.Errorf("expected 2 updated documents; got %d", len(response.Updated()))
+	}
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 2 {
+		t.Fatalf("expected 2 bulk actions; got %d", len(commands))
+	}
+	statuses := map[interface{}]interface{}{}
+	for _, command := range commands {
+		if command.op != OpUpdate || command.meta["_index"] != "orders" {
+			t.Errorf("expected update of index orders; got %s %v", command.op, command.meta)
+		}
+		var source map[string]interface{}
+		if err := jsonCodec.Unmarshal(command.source, &source); err != nil {
+			t.Fatalf("failed to parse update source; %s", err.Error())
+		}
+		if source["doc_as_upsert"] != true {
+			t.Errorf("expected the document to be upserted; got %s", command.source)
+		}
+		doc, _ := source["doc"].(map[string]interface{})
+		statuses[command.meta["_id"]] = doc["status"]
+	}
+	if statuses["1"] != "paid" || statuses["2"] != "shipped" {
+		t.Errorf("expected each document to be keyed by its id; got %v", statuses)
+	}
+}
+
+func TestBulkUpsertRequiresDocuments(t *testing.T) {
+	transport, restore := useStubClient(t, okBulkHandler(t))
+	defer restore()
+
+	if _, err := BulkUpsert(context.Background(), "orders", nil); err == nil {
+		t.Errorf("expected bulk upsert without documents to be rejected")
+	}
+	if len(transport.bulkRequests()) != 0 {
+		t.Errorf("expected no bulk request")
+	}
+}
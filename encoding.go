@@ -0,0 +1,49 @@
+package elasticsearchutil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// EncodingGzip indicates the message payload is gzip-compressed JSON, decompressed prior to indexing
+const EncodingGzip = "gzip"
+
+// decodePayload decompresses the message payload in place according to the encoding of its header;
+// the header encoding is cleared once decoded, such that a retried message is not decoded twice. When
+// max bytes is positive, decompression stops once it is exceeded, failing rather than inflating the payload
+func decodePayload(msg *Message, maxBytes int) error {
+	if msg.Header.Encoding == nil {
+		return nil
+	}
+
+	switch *msg.Header.Encoding {
+	case EncodingGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(msg.Payload))
+		if err != nil {
+			return fmt.Errorf("failed to decompress %d-byte gzip payload; %s", len(msg.Payload), err.Error())
+		}
+		defer reader.Close()
+
+		var src io.Reader = reader
+		if maxBytes > 0 {
+			src = io.LimitReader(reader, int64(maxBytes)+1)
+		}
+
+		payload, err := ioutil.ReadAll(src)
+		if err != nil {
+			return fmt.Errorf("failed to decompress %d-byte gzip payload; %s", len(msg.Payload), err.Error())
+		}
+		if maxBytes > 0 && len(payload) > maxBytes {
+			return fmt.Errorf("failed to decompress %d-byte gzip payload; decompressed document exceeds configured max %d-byte document size", len(msg.Payload), maxBytes)
+		}
+		msg.Payload = payload
+	default:
+		return fmt.Errorf("unsupported payload encoding %s", *msg.Header.Encoding)
+	}
+
+	msg.Header.Encoding = nil
+	return nil
+}
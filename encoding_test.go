@@ -0,0 +1,89 @@
+package elasticsearchutil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+)
+
+// gzipPayload returns the given payload gzip-compressed
+func gzipPayload(t *testing.T, payload string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write([]byte(payload)); err != nil {
+		t.Fatalf("failed to compress payload; %s", err.Error())
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to compress payload; %s", err.Error())
+	}
+	return buf.Bytes()
+}
+
+// gzipMessage returns a message for the given index and id with the given payload gzip-encoded
+func gzipMessage(t *testing.T, index, id, payload string) *Message {
+	msg := testMessage(index, id, "")
+	msg.Payload = gzipPayload(t, payload)
+	msg.Header.Encoding = stringOrNil(EncodingGzip)
+	return msg
+}
+
+func TestIndexerDecompressesGzipPayloads(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueAll(t, indexer, 1, gzipMessage(t, "events", "1", `{"a":1}`))
+	waitIdle(t, indexer)
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 1 || string(commands[0].source) != `{"a":1}` {
+		t.Errorf("expected the decompressed payload to be indexed; got %v", commands)
+	}
+}
+
+func TestIndexerDeadLettersUndecodablePayloads(t *testing.T) {
+	var dead deadLetters
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithDeadLetterHandler(dead.handler()))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	corrupt := testMessage("events", "1", `{"a":1}`)
+	corrupt.Header.Encoding = stringOrNil(EncodingGzip)
+	unsupported := testMessage("events", "2", `{"a":2}`)
+	unsupported.Header.Encoding = stringOrNil("br")
+	enqueueAll(t, indexer, 0, corrupt, unsupported)
+	waitIdle(t, indexer)
+
+	if dead.len() != 2 {
+		t.Fatalf("expected both messages to be dead-lettered; got %d", dead.len())
+	}
+	if !strings.Contains(dead.reasons[0].Error(), "failed to decompress") || !strings.Contains(dead.reasons[1].Error(), "unsupported payload encoding br") {
+		t.Errorf("expected the decoding failures to be provided; got %v", dead.reasons)
+	}
+	if len(transport.bulkRequests()) != 0 {
+		t.Errorf("expected no bulk request")
+	}
+}
+
+func TestDecodePayloadIsBoundedByMaxBytes(t *testing.T) {
+	payload := `{"a":"` + strings.Repeat("a", 1024) + `"}`
+
+	msg := gzipMessage(t, "events", "1", payload)
+	if err := decodePayload(msg, 64); err == nil || !strings.Contains(err.Error(), "exceeds configured max 64-byte document size") {
+		t.Errorf("expected decompression beyond max bytes to fail; got %v", err)
+	}
+
+	msg = gzipMessage(t, "events", "1", payload)
+	if err := decodePayload(msg, len(payload)); err != nil {
+		t.Fatalf("failed to decode payload of exactly max bytes; %s", err.Error())
+	}
+	if string(msg.Payload) != payload || msg.Header.Encoding != nil {
+		t.Errorf("expected the payload to be decoded and its encoding cleared")
+	}
+	if err := decodePayload(msg, len(payload)); err != nil || string(msg.Payload) != payload {
+		t.Errorf("expected a decoded payload not to be decoded again; got %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package elasticsearchutil
 
 import (
 	"os"
+	"time"
 
 	logger "github.com/kthomas/go-logger"
 	"github.com/olivere/elastic/v7"
@@ -14,6 +15,15 @@ var (
 	// elasticClients is an array of configured elasticsearch clients
 	elasticClients []*elastic.Client
 
+	// elasticURLs is an array of the urls used to configure each of the elasticClients
+	elasticURLs []string
+
+	// elasticConnectionConfig holds the connection options provided to RequireElasticsearch
+	elasticConnectionConfig *connectionConfig
+
+	// elasticClientHealth tracks the health of each of the elasticClients when configured using WithHealthyClientSelection
+	elasticClientHealth *clientHealth
+
 	// elasticHosts is an array of <host>:<port> strings
 	elasticHosts []string
 
@@ -26,6 +36,33 @@ var (
 	// When true, self-signed certificates are accepted when connecting to elasticsearch via https
 	elasticAcceptSelfSignedCertificate bool
 
+	// When true, the document type provided in a message header is sent with bulk index requests; only legacy (6.x) clusters support document types
+	elasticDocumentTypesSupported bool
+
+	// The ingest pipeline applied to bulk index requests for which the message header does not provide a pipeline
+	elasticDefaultPipeline *string
+
+	// When true, elasticsearch request bodies meeting or exceeding elasticGzipThresholdBytes are gzip-compressed
+	elasticGzipEnabled bool
+
+	// The minimum request body size in bytes which will be gzip-compressed when gzip is enabled
+	elasticGzipThresholdBytes int
+
+	// The gzip compression level (1-9) applied to compressed request bodies
+	elasticGzipLevel int
+
+	// The maximum number of idle (keep-alive) connections across all elasticsearch hosts
+	elasticMaxIdleConns int
+
+	// The maximum number of idle (keep-alive) connections to each elasticsearch host
+	elasticMaxIdleConnsPerHost int
+
+	// The duration an idle (keep-alive) connection to elasticsearch remains open before closing itself
+	elasticIdleConnTimeout time.Duration
+
+	// The number of workers which may concurrently send bulk requests on behalf of each indexer
+	elasticFlushWorkers int
+
 	// The maximum batch size in bytes for a single elasticsearch bulk index request
 	elasticMaxBatchSizeBytes int
 
@@ -0,0 +1,134 @@
+package elasticsearchutil
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/olivere/elastic/v7"
+)
+
+var (
+	// ErrNoClient is returned when no elasticsearch client is configured, i.e., RequireElasticsearch was not called
+	ErrNoClient = errors.New("no elasticsearch client configured")
+
+	// ErrNoHeader is returned when a message is provided without a header
+	ErrNoHeader = errors.New("no header provided")
+
+	// ErrNoIndex is returned when a message is provided without an index in its header
+	ErrNoIndex = errors.New("no index provided in header")
+
+	// ErrQueueFull is returned, or provided to the dead-letter handler, when a message cannot be buffered
+	ErrQueueFull = errors.New("queue full")
+
+	// ErrIndexNotPermitted is provided to the dead-letter handler when a message targets an index to which writes are not permitted
+	ErrIndexNotPermitted = errors.New("index not permitted")
+
+	// ErrStopped is returned, or provided to the dead-letter handler, when the indexer is draining or stopped
+	ErrStopped = errors.New("indexer is draining or stopped")
+)
+
+// BulkItemError describes a single action which failed within an otherwise successful bulk request
+type BulkItemError struct {
+	Op     string `json:"op"`
+	Index  string `json:"index"`
+	ID     string `json:"id,omitempty"`
+	Status int    `json:"status"`
+	Type   string `json:"type,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Error implements error
+func (e *BulkItemError) Error() string {
+	return fmt.Sprintf("%s of document %s in index %s failed with status %d; %s: %s", e.Op, e.ID, e.Index, e.Status, e.Type, e.Reason)
+}
+
+// BulkErrors aggregates the failed actions of a bulk request which succeeded at the http level;
+// it is returned by flushes of indexers configured with WithStrictBulkErrors
+type BulkErrors struct {
+	Items []*BulkItemError `json:"items"`
+}
+
+// Error implements error
+func (e *BulkErrors) Error() string {
+	msgs := make([]string, 0, len(e.Items))
+	for _, item := range e.Items {
+		msgs = append(msgs, item.Error())
+	}
+	return fmt.Sprintf("%d bulk item(s) failed; %s", len(e.Items), strings.Join(msgs, "; "))
+}
+
+// newBulkItemError returns the error describing the given failed bulk response item
+func newBulkItemError(op string, item *elastic.BulkResponseItem) *BulkItemError {
+	itemErr := &BulkItemError{
+		Op:     op,
+		Index:  item.Index,
+		ID:     item.Id,
+		Status: item.Status,
+	}
+	if item.Error != nil {
+		itemErr.Type = item.Error.Type
+		itemErr.Reason = item.Error.Reason
+	}
+	return itemErr
+}
+
+// newBulkErrors returns the aggregate of the failed items in the given response, or nil when none failed
+func newBulkErrors(response *elastic.BulkResponse) *BulkErrors {
+	if response == nil || !response.Errors {
+		return nil
+	}
+
+	bulkErrs := &BulkErrors{Items: make([]*BulkItemError, 0)}
+	for _, items := range response.Items {
+		for op, item := range items {
+			if item.Error == nil && item.Status < 300 {
+				continue
+			}
+
+			bulkErrs.Items = append(bulkErrs.Items, newBulkItemError(op, item))
+		}
+	}
+
+	if len(bulkErrs.Items) == 0 {
+		return nil
+	}
+	return bulkErrs
+}
+
+// ReadOnlyIndexError indicates an action failed because its index is blocked from writes, i.e.,
+// after the flood-stage disk watermark was exceeded; it is the reason provided to the dead-letter
+// handler for such actions, such that callers can alert on it using errors.As
+type ReadOnlyIndexError struct {
+	Index  string `json:"index"`
+	Status int    `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Error implements error
+func (e *ReadOnlyIndexError) Error() string {
+	return fmt.Sprintf("index %s is read-only; bulk item failed with status %d; %s", e.Index, e.Status, e.Reason)
+}
+
+// queueFullError is the reason provided to the dead-letter handler when a message could not be requeued
+// for retry; it matches ErrQueueFull using errors.Is while keeping the failure which prompted the retry
+// available to errors.Is and errors.As
+type queueFullError struct {
+	buffer string
+	reason error
+}
+
+// Error implements error
+func (e *queueFullError) Error() string {
+	return fmt.Sprintf("%s %s; %s", e.buffer, ErrQueueFull.Error(), e.reason.Error())
+}
+
+// Is reports whether the target is ErrQueueFull
+func (e *queueFullError) Is(target error) bool {
+	return target == ErrQueueFull
+}
+
+// Unwrap returns the failure which prompted the retry
+func (e *queueFullError) Unwrap() error {
+	return e.reason
+}
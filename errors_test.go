@@ -0,0 +1,117 @@
+package elasticsearchutil
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/olivere/elastic/v7"
+)
+
+func TestGetClientReturnsErrNoClient(t *testing.T) {
+	clients := elasticClients
+	elasticClients = nil
+	defer func() { elasticClients = clients }()
+
+	if _, err := GetClient(); !errors.Is(err, ErrNoClient) {
+		t.Errorf("expected ErrNoClient; got %v", err)
+	}
+}
+
+func TestQRejectsMessagesWithoutHeaderOrIndex(t *testing.T) {
+	indexer, _ := newStubIndexer(t, nil)
+
+	if err := indexer.Q(&Message{Payload: []byte(`{}`)}); !errors.Is(err, ErrNoHeader) {
+		t.Errorf("expected ErrNoHeader; got %v", err)
+	}
+	if err := indexer.Q(&Message{Header: &MessageHeader{}, Payload: []byte(`{}`)}); !errors.Is(err, ErrNoIndex) {
+		t.Errorf("expected ErrNoIndex; got %v", err)
+	}
+	if len(indexer.q) != 0 {
+		t.Errorf("expected the rejected messages not to be enqueued; got %d", len(indexer.q))
+	}
+}
+
+func TestQueueFullErrorWrapsRetryReason(t *testing.T) {
+	reason := &BulkItemError{Op: OpIndex, Index: "events", ID: "1", Status: http.StatusTooManyRequests, Type: "es_rejected_execution_exception", Reason: "rejected"}
+	err := error(&queueFullError{buffer: "retry buffer", reason: reason})
+
+	if !errors.Is(err, ErrQueueFull) {
+		t.Errorf("expected ErrQueueFull; got %v", err)
+	}
+	if errors.Is(err, ErrStopped) {
+		t.Errorf("expected no match for other sentinels")
+	}
+
+	var itemErr *BulkItemError
+	if !errors.As(err, &itemErr) || itemErr != reason {
+		t.Errorf("expected the failure which prompted the retry to be available; got %v", err)
+	}
+	if !strings.HasPrefix(err.Error(), "retry buffer queue full; ") {
+		t.Errorf("expected the buffer to be described; got %s", err.Error())
+	}
+}
+
+func TestNewBulkItemErrorDescribesItem(t *testing.T) {
+	itemErr := newBulkItemError(OpUpdate, &elastic.BulkResponseItem{
+		Index:  "events",
+		Id:     "1",
+		Status: http.StatusConflict,
+		Error:  &elastic.ErrorDetails{Type: "version_conflict_engine_exception", Reason: "version conflict"},
+	})
+	if itemErr.Op != OpUpdate || itemErr.Index != "events" || itemErr.ID != "1" || itemErr.Status != http.StatusConflict {
+		t.Errorf("expected the item to be described; got %+v", itemErr)
+	}
+	if itemErr.Type != "version_conflict_engine_exception" || itemErr.Reason != "version conflict" {
+		t.Errorf("expected the item error to be described; got %+v", itemErr)
+	}
+
+	if itemErr := newBulkItemError(OpIndex, &elastic.BulkResponseItem{Status: http.StatusInternalServerError}); itemErr.Type != "" || itemErr.Status != http.StatusInternalServerError {
+		t.Errorf("expected an item without error details to be described by status; got %+v", itemErr)
+	}
+}
+
+func TestIndexerDeadLettersBulkItemErrors(t *testing.T) {
+	var dead deadLetters
+	indexer, _ := newStubIndexer(t, rejectingBulkHandler(t, "1"), WithDeadLetterHandler(dead.handler()))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	if err := indexer.Q(testMessage("events", "1", `{"a":1}`)); err != nil {
+		t.Fatalf("failed to enqueue message; %s", err.Error())
+	}
+	waitIdle(t, indexer)
+
+	if dead.len() != 1 {
+		t.Fatalf("expected 1 dead-lettered document; got %d", dead.len())
+	}
+	var itemErr *BulkItemError
+	if !errors.As(dead.reasons[0], &itemErr) || itemErr.ID != "1" || itemErr.Status != http.StatusBadRequest || itemErr.Op != OpIndex {
+		t.Errorf("expected *BulkItemError for document 1; got %v", dead.reasons[0])
+	}
+}
+
+func TestNewBulkErrorsAggregatesFailedItems(t *testing.T) {
+	response := &elastic.BulkResponse{
+		Errors: true,
+		Items: []map[string]*elastic.BulkResponseItem{
+			{"index": {Index: "events", Id: "1", Status: http.StatusCreated}},
+			{"create": {Index: "events", Id: "2", Status: http.StatusBadRequest, Error: &elastic.ErrorDetails{Type: "mapper_parsing_exception", Reason: "failed to parse field [a]"}}},
+		},
+	}
+
+	bulkErrs := newBulkErrors(response)
+	if bulkErrs == nil || len(bulkErrs.Items) != 1 {
+		t.Fatalf("expected the failed action to be aggregated; got %v", bulkErrs)
+	}
+	if item := bulkErrs.Items[0]; item.Op != "create" || item.ID != "2" || item.Status != http.StatusBadRequest || item.Type != "mapper_parsing_exception" {
+		t.Errorf("expected the failed create of document 2; got %+v", item)
+	}
+	if !strings.Contains(bulkErrs.Error(), "failed to parse field [a]") {
+		t.Errorf("expected the error to describe the failed action; got %s", bulkErrs.Error())
+	}
+	if newBulkErrors(&elastic.BulkResponse{Items: response.Items[:1]}) != nil {
+		t.Errorf("expected no errors for a response without failed actions")
+	}
+}
@@ -0,0 +1,93 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// flushIndexRequest asks the run loop to detach the buffered actions targeting an index, or every
+// buffered action when all is set
+type flushIndexRequest struct {
+	index string
+	all   bool
+	batch chan *bulkBatch
+}
+
+// Flush synchronously sends every buffered action as a single bulk request; when configured
+// WithStrictBulkErrors, a *BulkErrors is returned if any action within the request fails. nil is
+// returned without error when nothing is buffered
+func (indexer *Indexer) Flush(ctx context.Context) (*elastic.BulkResponse, error) {
+	return indexer.flushBuffered(ctx, &flushIndexRequest{
+		all:   true,
+		batch: make(chan *bulkBatch, 1),
+	})
+}
+
+// FlushIndex synchronously sends the buffered actions targeting the given index as a single bulk
+// request (i.e., to make a critical index searchable quickly), leaving the actions buffered for
+// other indices in place; nil is returned without error when nothing is buffered for the index
+func (indexer *Indexer) FlushIndex(ctx context.Context, index string) (*elastic.BulkResponse, error) {
+	return indexer.flushBuffered(ctx, &flushIndexRequest{
+		index: index,
+		batch: make(chan *bulkBatch, 1),
+	})
+}
+
+// flushBuffered asks the run loop to detach the buffered actions described by the given request,
+// then sends them as a single bulk request
+func (indexer *Indexer) flushBuffered(ctx context.Context, req *flushIndexRequest) (*elastic.BulkResponse, error) {
+	target := fmt.Sprintf("index %s", req.index)
+	if req.all {
+		target = "buffered actions"
+	}
+
+	select {
+	case indexer.flushIndex <- req:
+	case <-indexer.done:
+		return nil, fmt.Errorf("failed to flush %s; %w", target, ErrStopped)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	// the run loop always replies, as it alone mutates the buffered actions
+	batch := <-req.batch
+	if batch == nil {
+		log.Tracef("indexer (%v) attempted to flush %s, but nothing was queued", indexer.identifier, target)
+		return nil, nil
+	}
+
+	return indexer.sendBatch(ctx, batch)
+}
+
+// detachIndexBatch hands off the queued actions targeting the given index, retaining the rest;
+// nil is returned when nothing is queued for the index
+func (indexer *Indexer) detachIndexBatch(index string) *bulkBatch {
+	indexer.flushMutex.Lock()
+	defer indexer.flushMutex.Unlock()
+
+	detached := make([]*queuedAction, 0)
+	retained := make([]*queuedAction, 0, len(indexer.pending))
+	size := 0
+	for _, action := range indexer.pending {
+		if *action.msg.Header.Index == index {
+			detached = append(detached, action)
+			size += action.size
+		} else {
+			retained = append(retained, action)
+		}
+	}
+
+	if len(detached) == 0 {
+		return nil
+	}
+
+	indexer.pending = retained
+	indexer.queueSizeInBytes -= size
+	atomic.StoreInt64(&indexer.bufferedActions, int64(len(retained)))
+	indexer.rebuildDedupeKeys()
+
+	return indexer.newBatch(detached, size)
+}
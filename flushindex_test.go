@@ -0,0 +1,163 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// rejectingBulkHandler returns a handler failing the bulk actions for the document with the given id as unparseable
+func rejectingBulkHandler(t *testing.T, id string) stubHandler {
+	return func(req *stubRequest) (int, string) {
+		if !strings.HasSuffix(req.Path, "/_bulk") {
+			return http.StatusOK, "{}"
+		}
+		return stubBulkResponse(t, req, func(i int, command *bulkCommand) stubItem {
+			if command.meta["_id"] == id {
+				return stubItem{status: http.StatusBadRequest, reason: "failed to parse field [a]"}
+			}
+			return stubItem{}
+		})
+	}
+}
+
+// bufferN enqueues the given number of documents to the given running indexer, waiting for them to be buffered
+func bufferN(t *testing.T, indexer *Indexer, n int) {
+	t.Helper()
+	enqueueN(t, indexer, n)
+	waitFor(t, "messages to be buffered", func() bool { return atomic.LoadInt64(&indexer.bufferedActions) == int64(n) })
+}
+
+func TestFlushWithStrictBulkErrorsReturnsFailedItems(t *testing.T) {
+	indexer, _ := newStubIndexer(t, rejectingBulkHandler(t, "1"), WithStrictBulkErrors())
+	stop := runIndexer(indexer)
+	defer stop()
+
+	bufferN(t, indexer, 2)
+
+	response, err := indexer.Flush(context.Background())
+	var bulkErrs *BulkErrors
+	if !errors.As(err, &bulkErrs) {
+		t.Fatalf("expected *BulkErrors; got %v", err)
+	}
+	if len(bulkErrs.Items) != 1 || bulkErrs.Items[0].ID != "1" || bulkErrs.Items[0].Status != http.StatusBadRequest {
+		t.Errorf("expected the failed action of document 1; got %v", bulkErrs.Items)
+	}
+	if !strings.Contains(err.Error(), "failed to parse field [a]") {
+		t.Errorf("expected the error to describe the failed action; got %s", err.Error())
+	}
+	if response == nil || len(response.Items) != 2 {
+		t.Errorf("expected the bulk response to be returned")
+	}
+}
+
+func TestFlushWithoutStrictBulkErrorsIgnoresFailedItems(t *testing.T) {
+	indexer, transport := newStubIndexer(t, rejectingBulkHandler(t, "1"))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	bufferN(t, indexer, 2)
+
+	response, err := indexer.Flush(context.Background())
+	if err != nil {
+		t.Fatalf("expected partial failures not to be returned; got %s", err.Error())
+	}
+	if response == nil || len(transport.bulkRequests()) != 1 {
+		t.Errorf("expected the buffered actions to be sent as a single bulk request")
+	}
+}
+
+func TestFlushWithNothingBuffered(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	response, err := indexer.Flush(context.Background())
+	if response != nil || err != nil {
+		t.Errorf("expected nil response and error; got %v, %v", response, err)
+	}
+	if len(transport.bulkRequests()) != 0 {
+		t.Errorf("expected no bulk request")
+	}
+}
+
+func TestFlushIndexSendsOnlyActionsForIndex(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueAll(t, indexer, 3, testMessage("events", "1", `{"a":1}`), testMessage("logs", "1", `{"a":1}`), testMessage("events", "2", `{"a":2}`))
+
+	response, err := indexer.FlushIndex(context.Background(), "events")
+	if err != nil {
+		t.Fatalf("failed to flush index; %s", err.Error())
+	}
+	if response == nil || len(response.Items) != 2 {
+		t.Fatalf("expected the bulk response for the 2 events actions")
+	}
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 2 || commands[0].meta["_index"] != "events" || commands[1].meta["_index"] != "events" {
+		t.Fatalf("expected only the events actions to be sent; got %d bulk actions", len(commands))
+	}
+	if buffered := atomic.LoadInt64(&indexer.bufferedActions); buffered != 1 {
+		t.Errorf("expected the logs action to remain buffered; got %d", buffered)
+	}
+
+	waitIdle(t, indexer)
+	if commands := sentCommands(t, transport); len(commands) != 3 || commands[2].meta["_index"] != "logs" {
+		t.Errorf("expected the retained logs action to be sent by the next flush")
+	}
+}
+
+func TestFlushIndexWithNothingBufferedForIndex(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueAll(t, indexer, 1, testMessage("logs", "1", `{"a":1}`))
+
+	response, err := indexer.FlushIndex(context.Background(), "events")
+	if response != nil || err != nil {
+		t.Errorf("expected nil, nil; got %v, %v", response, err)
+	}
+	if reqs := transport.bulkRequests(); len(reqs) != 0 {
+		t.Errorf("expected no bulk request; got %d", len(reqs))
+	}
+}
+
+func TestFlushIndexRebuildsDedupeKeysOfRetainedActions(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithDeduplication())
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueAll(t, indexer, 2, testMessage("events", "1", `{"v":1}`), testMessage("logs", "1", `{"v":1}`))
+	if _, err := indexer.FlushIndex(context.Background(), "events"); err != nil {
+		t.Fatalf("failed to flush index; %s", err.Error())
+	}
+
+	// collapsed into the logs action, now the first buffered action
+	enqueueAll(t, indexer, 1, testMessage("logs", "1", `{"v":2}`))
+	waitIdle(t, indexer)
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 2 || commands[1].meta["_index"] != "logs" || string(commands[1].source) != `{"v":2}` {
+		t.Fatalf("expected the latest logs action in place of the retained action; got %d bulk actions", len(commands))
+	}
+	if stats := indexer.Stats(); stats.Deduplicated != 1 {
+		t.Errorf("expected 1 collapsed action; got %d", stats.Deduplicated)
+	}
+}
+
+func TestFlushIndexAfterStop(t *testing.T) {
+	indexer, _ := newStubIndexer(t, okBulkHandler(t))
+	stop := runIndexer(indexer)
+	stop()
+
+	if _, err := indexer.FlushIndex(context.Background(), "events"); !errors.Is(err, ErrStopped) {
+		t.Errorf("expected ErrStopped; got %v", err)
+	}
+}
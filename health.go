@@ -0,0 +1,102 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// WithHealthyClientSelection distributes requests across the configured clients (one per host) in
+// round-robin order, skipping clients whose host failed the most recent health check; hosts are
+// checked every given interval. The first client is returned should no client be healthy.
+func WithHealthyClientSelection(interval time.Duration) ConnectionOption {
+	return func(config *connectionConfig) {
+		config.healthCheckInterval = interval
+	}
+}
+
+// clientHealth tracks the outcome of the most recent health check of each configured client
+type clientHealth struct {
+	healthy []int32
+	next    uint32
+	done    chan struct{}
+}
+
+// startClientHealthChecks begins periodically checking the health of the configured clients,
+// stopping the checks of any clients previously configured
+func startClientHealthChecks(interval time.Duration) {
+	if elasticClientHealth != nil {
+		close(elasticClientHealth.done)
+		elasticClientHealth = nil
+	}
+
+	if interval <= 0 || len(elasticClients) < 2 {
+		return
+	}
+
+	health := &clientHealth{
+		healthy: make([]int32, len(elasticClients)),
+		done:    make(chan struct{}),
+	}
+	for i := range health.healthy {
+		health.healthy[i] = 1
+	}
+	elasticClientHealth = health
+
+	go health.monitor(elasticClients, elasticURLs, interval)
+}
+
+// monitor checks the health of the given clients every interval until done
+func (health *clientHealth) monitor(clients []*elastic.Client, urls []string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for i, client := range clients {
+				health.check(i, client, urls[i], interval)
+			}
+		case <-health.done:
+			return
+		}
+	}
+}
+
+// check pings the host of the given client, recording whether it is healthy
+func (health *clientHealth) check(i int, client *elastic.Client, url string, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	_, _, err := client.Ping(url).Do(ctx)
+
+	healthy := int32(1)
+	if err != nil {
+		healthy = 0
+	}
+
+	if atomic.SwapInt32(&health.healthy[i], healthy) == healthy {
+		return
+	}
+
+	if err != nil {
+		log.Warningf("elasticsearch host %s failed health check; skipping its client; %s", redactURL(url), redactErr(err, url))
+	} else {
+		log.Infof("elasticsearch host %s passed health check; resuming selection of its client", redactURL(url))
+	}
+}
+
+// selectClient returns the next healthy client in round-robin order, or the first client should none be healthy
+func (health *clientHealth) selectClient(clients []*elastic.Client) *elastic.Client {
+	n := uint32(len(clients))
+	start := atomic.AddUint32(&health.next, 1)
+	for i := uint32(0); i < n; i++ {
+		j := (start + i) % n
+		if atomic.LoadInt32(&health.healthy[j]) == 1 {
+			return clients[j]
+		}
+	}
+	return clients[0]
+}
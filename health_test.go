@@ -0,0 +1,129 @@
+package elasticsearchutil
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// useStubClients configures a stub client per given handler as the elasticsearch clients, starting
+// health checks every given interval, and returns a func stopping the checks and restoring the
+// previously configured clients
+func useStubClients(t *testing.T, interval time.Duration, handlers ...stubHandler) ([]*elastic.Client, []*stubTransport, func()) {
+	clients, urls, health := elasticClients, elasticURLs, elasticClientHealth
+
+	elasticClients = make([]*elastic.Client, 0, len(handlers))
+	elasticURLs = make([]string, 0, len(handlers))
+	elasticClientHealth = nil
+	transports := make([]*stubTransport, 0, len(handlers))
+	for _, handler := range handlers {
+		client, transport := newStubClient(t, handler)
+		elasticClients = append(elasticClients, client)
+		elasticURLs = append(elasticURLs, mockElasticsearchURL)
+		transports = append(transports, transport)
+	}
+	startClientHealthChecks(interval)
+
+	return elasticClients, transports, func() {
+		startClientHealthChecks(0)
+		elasticClients, elasticURLs, elasticClientHealth = clients, urls, health
+	}
+}
+
+// unreachableHandler fails every request with a connection error
+func unreachableHandler(req *stubRequest) (int, string) {
+	return 0, ""
+}
+
+func TestClientHealthSelectsHealthyClientsInRoundRobinOrder(t *testing.T) {
+	clients := []*elastic.Client{new(elastic.Client), new(elastic.Client), new(elastic.Client)}
+	health := &clientHealth{healthy: []int32{1, 0, 1}}
+
+	selected := map[*elastic.Client]int{}
+	for i := 0; i < 6; i++ {
+		selected[health.selectClient(clients)]++
+	}
+	if selected[clients[0]] == 0 || selected[clients[2]] == 0 || selected[clients[1]] != 0 {
+		t.Errorf("expected only the healthy clients to be selected; got %d, %d, %d", selected[clients[0]], selected[clients[1]], selected[clients[2]])
+	}
+
+	health.healthy = []int32{0, 0, 0}
+	if health.selectClient(clients) != clients[0] {
+		t.Errorf("expected the first client should no client be healthy")
+	}
+}
+
+func TestClientHealthCheckRecordsPingOutcome(t *testing.T) {
+	client, transport := newStubClient(t, unreachableHandler)
+	health := &clientHealth{healthy: []int32{1}}
+
+	health.check(0, client, mockElasticsearchURL, time.Second)
+	if atomic.LoadInt32(&health.healthy[0]) != 0 {
+		t.Errorf("expected the unreachable host to be unhealthy")
+	}
+
+	transport.setHandler(func(req *stubRequest) (int, string) {
+		return http.StatusOK, `{"name":"n1","cluster_name":"es","version":{"number":"7.10.2"}}`
+	})
+	health.check(0, client, mockElasticsearchURL, time.Second)
+	if atomic.LoadInt32(&health.healthy[0]) != 1 {
+		t.Errorf("expected the reachable host to be healthy")
+	}
+}
+
+func TestWithHealthyClientSelectionSkipsUnhealthyClients(t *testing.T) {
+	clients, _, restore := useStubClients(t, 5*time.Millisecond, okBulkHandler(t), unreachableHandler)
+	defer restore()
+
+	if elasticClientHealth == nil {
+		t.Fatalf("expected health checks to be started")
+	}
+	waitFor(t, "the unreachable client to fail its health check", func() bool {
+		return atomic.LoadInt32(&elasticClientHealth.healthy[1]) == 0
+	})
+	for i := 0; i < 4; i++ {
+		if client, err := GetClient(); err != nil || client != clients[0] {
+			t.Fatalf("expected the healthy client to be returned; got %v", err)
+		}
+	}
+}
+
+func TestWithHealthyClientSelectionDistributesBulkRequests(t *testing.T) {
+	_, transports, restore := useStubClients(t, time.Hour, okBulkHandler(t), okBulkHandler(t))
+	defer restore()
+
+	indexer, err := NewIndexer()
+	if err != nil {
+		t.Fatalf("failed to initialize indexer; %s", err.Error())
+	}
+	if !indexer.selectClients {
+		t.Fatalf("expected the indexer to select among the healthy clients")
+	}
+	stop := runIndexer(indexer)
+	defer stop()
+
+	for _, id := range []string{"1", "2"} {
+		if err := indexer.Q(testMessage("events", id, `{"a":1}`)); err != nil {
+			t.Fatalf("failed to enqueue message; %s", err.Error())
+		}
+		waitIdle(t, indexer)
+	}
+
+	for i, transport := range transports {
+		if reqs := len(transport.bulkRequests()); reqs != 1 {
+			t.Errorf("expected 1 bulk request sent by client %d; got %d", i, reqs)
+		}
+	}
+}
+
+func TestStartClientHealthChecksRequiresMultipleClients(t *testing.T) {
+	_, _, restore := useStubClients(t, time.Millisecond, okBulkHandler(t))
+	defer restore()
+
+	if elasticClientHealth != nil {
+		t.Errorf("expected no health checks for a single client")
+	}
+}
@@ -0,0 +1,17 @@
+package elasticsearchutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// IDGenerator returns the document id to assign to a message queued without an id; an empty
+// string leaves the id to be auto-generated by elasticsearch
+type IDGenerator func(msg *Message) string
+
+// PayloadHashIDGenerator returns the hex-encoded sha256 digest of the message payload, such that
+// re-ingesting an identical document overwrites rather than duplicates it
+func PayloadHashIDGenerator(msg *Message) string {
+	digest := sha256.Sum256(msg.Payload)
+	return hex.EncodeToString(digest[:])
+}
@@ -0,0 +1,107 @@
+package elasticsearchutil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func TestWithIDGeneratorAssignsIDsToMessagesWithoutOne(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithIDGenerator(PayloadHashIDGenerator))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	generated := testMessage("events", "", `{"a":1}`)
+	for _, msg := range []*Message{generated, testMessage("events", "provided", `{"a":2}`)} {
+		if err := indexer.Q(msg); err != nil {
+			t.Fatalf("failed to enqueue message; %s", err.Error())
+		}
+	}
+	waitIdle(t, indexer)
+
+	digest := sha256.Sum256([]byte(`{"a":1}`))
+	expected := hex.EncodeToString(digest[:])
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 2 {
+		t.Fatalf("expected 2 bulk actions; got %d", len(commands))
+	}
+	if commands[0].meta["_id"] != expected {
+		t.Errorf("expected the payload digest %s as id; got %v", expected, commands[0].meta["_id"])
+	}
+	if commands[1].meta["_id"] != "provided" {
+		t.Errorf("expected the provided id to be retained; got %v", commands[1].meta["_id"])
+	}
+	// assigned on the header, such that a retry of the message reuses the generated id
+	if generated.Header.ID == nil || *generated.Header.ID != expected {
+		t.Errorf("expected the generated id to be assigned on the header")
+	}
+}
+
+func TestWithIDGeneratorHashesDecodedPayloads(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithIDGenerator(PayloadHashIDGenerator))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	// the same document compressed at different times, such that the encoded payloads differ
+	for _, modTime := range []time.Time{time.Unix(1000000000, 0), time.Unix(1500000000, 0)} {
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		writer.ModTime = modTime
+		if _, err := writer.Write([]byte(`{"a":1}`)); err != nil {
+			t.Fatalf("failed to compress payload; %s", err.Error())
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatalf("failed to compress payload; %s", err.Error())
+		}
+
+		msg := testMessage("events", "", "")
+		msg.Payload = buf.Bytes()
+		msg.Header.Encoding = stringOrNil(EncodingGzip)
+		if err := indexer.Q(msg); err != nil {
+			t.Fatalf("failed to enqueue message; %s", err.Error())
+		}
+	}
+	waitIdle(t, indexer)
+
+	digest := sha256.Sum256([]byte(`{"a":1}`))
+	expected := hex.EncodeToString(digest[:])
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 2 {
+		t.Fatalf("expected 2 bulk actions; got %d", len(commands))
+	}
+	for _, command := range commands {
+		if command.meta["_id"] != expected {
+			t.Errorf("expected the digest %s of the decoded payload as id; got %v", expected, command.meta["_id"])
+		}
+	}
+}
+
+func TestWithIDGeneratorLeavesEmptyIDsToElasticsearch(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithIDGenerator(func(msg *Message) string { return "" }))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	if err := indexer.Q(testMessage("events", "", `{"a":1}`)); err != nil {
+		t.Fatalf("failed to enqueue message; %s", err.Error())
+	}
+	waitIdle(t, indexer)
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 1 {
+		t.Fatalf("expected 1 bulk action; got %d", len(commands))
+	}
+	if id, ok := commands[0].meta["_id"]; ok {
+		t.Errorf("expected no id to be sent; got %v", id)
+	}
+}
+
+func TestWithIDGeneratorRejectsNil(t *testing.T) {
+	if _, err := newIndexer(nil, "", WithIDGenerator(nil)); err == nil {
+		t.Errorf("expected nil id generator to be rejected")
+	}
+}
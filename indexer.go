@@ -3,199 +3,1104 @@ package elasticsearchutil
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	uuid "github.com/kthomas/go.uuid"
 	"github.com/olivere/elastic/v7"
 )
 
+// OpIndex indexes the document, replacing any existing document with the same id
+const OpIndex = "index"
+
+// OpCreate indexes the document only if a document with the same id does not already exist; data streams require this op
+const OpCreate = "create"
+
+// OpUpdate partially updates the document with the id provided in the header, merging the payload into its source
+const OpUpdate = "update"
+
+// OpDelete deletes the document with the id provided in the header; the payload is ignored
+const OpDelete = "delete"
+
 const defaultElasticsearchIndexerBufferedChannelSize = 64
 const defaultElasticsearchIndexerMaxBatchIntervalMillis = 10000
 const defaultElasticsearchIndexerMaxBatchSizeBytes = 1024 * 10
+const defaultElasticsearchIndexerShutdownFlushTimeoutMillis = 5000
+const defaultElasticsearchIndexerMaxDocumentBytes = 100 * 1024 * 1024
 const defaultElasticsearchIndexerSleepIntervalMillis = 1000
+const defaultElasticsearchIndexerEnsureIndexTimeoutMillis = 5000
+const defaultElasticsearchIndexerLoadModeTimeoutMillis = 5000
+const defaultElasticsearchIndexerFlushTimeoutMillis = 30000
 
 // Indexer instances buffer bulk indexing transactions
 type Indexer struct {
+	stats    Stats // accessed atomically; must remain the first field for 64-bit alignment
+	retrying int64 // accessed atomically; messages awaiting retry, bounded by the retry buffer size
+
+	bufferedActions int64 // accessed atomically
+	outstanding     int64 // accessed atomically; messages enqueued but not yet indexed, rejected or dead-lettered
+	admittedBytes   int64 // accessed atomically; payload bytes of the outstanding messages
+	draining        int32 // accessed atomically
+
+	maxBufferedBytes int64
+
 	client           *elastic.Client
+	clientURL        string
+	selectClients    bool
 	identifier       string
-	esBulkService    *elastic.BulkService
+	pending          []*queuedAction
+	dedupeKeys       map[string]int
+	dedupe           bool
+	idGenerator      IDGenerator
+	fieldRedactor    *fieldRedactor
+	preprocessors    []Preprocessor
+	checkpoints      *checkpointTracker
+	routingField     []string
+	metaField        string
+	maxDocumentBytes int
+	clearReadOnly    bool
+	routedIndices    map[string]bool
 	flushMutex       *sync.Mutex
+	qMutex           *sync.RWMutex
+	reportMutex      *sync.Mutex
+	shutdownFailures []*ShutdownFailure
 	q                chan *Message
+	retryQ           chan *Message
+	retryBacklog     []*Message // retried messages awaiting their backoff; owned by the run loop
 	queueFlushTicker *time.Ticker
+	queueFlushC      <-chan time.Time
 	queueSizeInBytes int
 	sleepInterval    time.Duration
 
-	shutdown chan bool
+	maxBatchSizeBytes int
+	adaptiveBatchSize *adaptiveBatchSize
+	maxBatchActions   int
+	maxBatchInterval  time.Duration
+	minBatchActions   int
+	flushJitter       float64
+	batchStartedAt    time.Time // enqueue time of the first action of the current batch
+	maxDocumentAge    time.Duration
+
+	maxDocumentAgeTimer *time.Timer
+	maxDocumentAgeC     <-chan time.Time
+
+	flushNow     chan struct{}
+	flushIndex   chan *flushIndexRequest
+	flushQ       chan *bulkBatch
+	flushWorkers int
+	flushWG      *sync.WaitGroup
+	flushCtx     context.Context // cancelled once the indexer stops, abandoning bulk requests still in flight
+	cancelFlush  context.CancelFunc
+	flushTimeout time.Duration // bounds each bulk request beyond the elasticsearch timeout of its indices
+
+	inFlightCond     *sync.Cond
+	maxInFlightBytes int64
+
+	requestLimiter *tokenBucket
+	byteLimiter    *tokenBucket
+
+	done                 chan struct{}
+	gracefulSignals      bool
+	shutdown             chan bool
+	stopped              chan struct{}
+	shutdownFlushTimeout time.Duration
+
+	connFailures int
+	reconnecting bool
+	reconnected  chan *elastic.Client
+	ownsClient   bool // set once the client is rebuilt by the connection monitor, rather than shared
+
+	indexPolicies  []*indexPolicyRule
+	indexDenylist  []string
+	indexAllowlist []string
+	indexTimeouts  []*indexTimeoutRule
+	indexShards    map[string]int
+
+	timeBasedIndices map[string]*timeBasedIndex
+
+	autoCreateIndex map[string]interface{}
+	createdIndices  map[string]bool
+
+	loadMode        bool
+	loadModeIndices map[string]*loadModeIndex
+
+	deadLetterHandler DeadLetterHandler
+	failureSpool      *failureSpool
+	resultHandler     ResultHandler
+	responseRecorder  ResponseRecorder
+	recorderWG        *sync.WaitGroup
+	strictBulkErrors  bool
+	maxRetries        int
+	retryBackoff      time.Duration
+	maxRetryBackoff   time.Duration
+	retryClassifier   RetryClassifier
+
+	waitForActiveShards string
+	requireAlias        bool
+	homogeneousBatches  bool
+	bulkContentType     string
+
+	debugMutex        *sync.Mutex
+	debugBodyMaxBytes int
+	lastBulkBody      []byte
 }
 
 // Message is injested by indexer, routing `payload` to the elasticsearch index specified in `header`
 type Message struct {
 	Header  *MessageHeader `json:"header,omitempty"`
 	Payload []byte         `json:"payload"`
+
+	// invoked once the message is settled: with nil once its document is indexed, or with the reason
+	// it was rejected or dead-lettered; invoked by the goroutine settling it, so it must not block
+	Ack func(err error) `json:"-"`
+
+	attempts      int
+	notBefore     time.Time  // retried no sooner than, per the retry backoff
+	admittedBytes int        // payload size when enqueued, released once the message is settled
+	superseded    []*Message // collapsed into this message by deduplication, settled with it once retried
 }
 
 // MessageHeader allows metadata about the payload to be provided; this metadata contains parameters related to elasticsearch
 type MessageHeader struct {
-	ID    *string `json:"id,omitempty"`
-	Index *string `json:"index,omitempty"`
+	ID          *string `json:"id,omitempty"`
+	Index       *string `json:"index,omitempty"`
+	Type        *string `json:"type,omitempty"`    // honored only when ELASTICSEARCH_DOCUMENT_TYPES_SUPPORTED=true
+	Op          *string `json:"op,omitempty"`      // defaults to OpIndex, or OpCreate when targeting a data stream
+	OpType      *string `json:"op_type,omitempty"` // explicitly OpIndex (overwrite) or OpCreate (fail if the document exists)
+	Routing     *string `json:"routing,omitempty"`
+	Pipeline    *string `json:"pipeline,omitempty"` // overrides ELASTICSEARCH_DEFAULT_PIPELINE; _none skips the default pipeline
+	Encoding    *string `json:"encoding,omitempty"` // EncodingGzip to decompress the payload prior to indexing
+	DataStream  bool    `json:"data_stream,omitempty"`
+	FetchSource bool    `json:"fetch_source,omitempty"` // return the updated source in the response item of an OpUpdate
+
+	// fails an OpIndex or OpCreate unless the index is an alias, rather than creating a concrete index
+	RequireAlias bool `json:"require_alias,omitempty"`
+
+	// maps fields of the document to dynamic templates of the index mapping; requires elasticsearch 7.13+
+	DynamicTemplates map[string]string `json:"dynamic_templates,omitempty"`
+
+	// metadata (i.e., provenance such as the source system) merged into the document under the
+	// configured meta field, which defaults to meta; see WithMetaField
+	Meta map[string]interface{} `json:"meta,omitempty"`
+
+	// optimistic concurrency control; the op fails unless the document is unchanged since it was read
+	IfSeqNo       *int64 `json:"if_seq_no,omitempty"`
+	IfPrimaryTerm *int64 `json:"if_primary_term,omitempty"`
+
+	// position of the message in its source (i.e., an offset), checkpointed once the message and
+	// every message enqueued with a lesser cursor is acknowledged; see CheckpointStore
+	Cursor *int64 `json:"cursor,omitempty"`
+}
+
+// ResultHandler is invoked with each message sent in a bulk request along with its response item,
+// which includes the updated source for OpUpdate messages requesting FetchSource
+type ResultHandler func(msg *Message, item *elastic.BulkResponseItem)
+
+// ResponseRecorder is invoked asynchronously with the response of each successful bulk request, i.e., to persist an audit trail
+type ResponseRecorder func(ctx context.Context, response *elastic.BulkResponse)
+
+// bulkBatch is a set of queued actions detached from the indexer to be sent as a single bulk request
+type bulkBatch struct {
+	client      *elastic.Client
+	service     *elastic.BulkService
+	pending     []*queuedAction // in the order added to the service, correlating response items with their messages
+	sizeInBytes int
+	opaqueID    string // sent as the X-Opaque-Id header, correlating the request with elasticsearch tasks and slow logs
+}
+
+// queuedAction pairs a bulk action with the message from which it was built
+type queuedAction struct {
+	msg        *Message
+	req        elastic.BulkableRequest
+	size       int
+	superseded []*Message // collapsed into this action by deduplication, settled with the outcome of msg
+}
+
+// NewIndexer convenience method to initialize a new in-memory `Indexer` instance; an error
+// is returned if no elasticsearch client is configured, i.e., RequireElasticsearch was not called,
+// or if any of the given options is invalid
+func NewIndexer(opts ...IndexerOption) (*Indexer, error) {
+	client, err := GetClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize indexer; %w", err)
+	}
+
+	clientURL := ""
+	if len(elasticURLs) > 0 {
+		clientURL = elasticURLs[0]
+	}
+
+	indexer, err := newIndexer(client, clientURL, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize indexer; %w", err)
+	}
+	indexer.selectClients = elasticClientHealth != nil
+	return indexer, nil
 }
 
-// NewIndexer convenience method to initialize a new in-memory `Indexer` instance
-func NewIndexer() (indexer *Indexer) {
+// newIndexer initializes a new `Indexer` instance using the given client; the client url
+// is used to rebuild the client when connectivity is lost and may be empty; an error is returned
+// by the first of the given options which is invalid
+func newIndexer(client *elastic.Client, clientURL string, opts ...IndexerOption) (indexer *Indexer, err error) {
 	indexer = new(Indexer)
 
 	instanceID, _ := uuid.NewV4()
 	indexer.identifier = base64.RawURLEncoding.EncodeToString(instanceID.Bytes())
 
-	indexer.client, _ = GetClient()
+	indexer.client = client
+	indexer.clientURL = clientURL
 	indexer.flushMutex = &sync.Mutex{}
+	indexer.qMutex = &sync.RWMutex{}
+	indexer.reportMutex = &sync.Mutex{}
+	indexer.debugMutex = &sync.Mutex{}
+	indexer.flushWG = &sync.WaitGroup{}
+	indexer.flushCtx, indexer.cancelFlush = context.WithCancel(context.Background())
+	indexer.flushTimeout = time.Millisecond * time.Duration(defaultElasticsearchIndexerFlushTimeoutMillis)
+	indexer.recorderWG = &sync.WaitGroup{}
+	indexer.flushNow = make(chan struct{}, 1)
+	indexer.flushIndex = make(chan *flushIndexRequest)
+	indexer.inFlightCond = sync.NewCond(&sync.Mutex{})
+	indexer.flushWorkers = elasticFlushWorkers
+	if indexer.flushWorkers < 1 {
+		indexer.flushWorkers = defaultElasticsearchFlushWorkers
+	}
 	indexer.q = make(chan *Message, defaultElasticsearchIndexerBufferedChannelSize)
+	indexer.retryQ = make(chan *Message, defaultElasticsearchIndexerRetryBufferSize)
+	indexer.maxRetries = defaultElasticsearchIndexerMaxRetries
+	indexer.retryBackoff = time.Millisecond * time.Duration(defaultElasticsearchIndexerRetryBackoffMillis)
+	indexer.maxRetryBackoff = time.Millisecond * time.Duration(defaultElasticsearchIndexerMaxRetryBackoffMillis)
+	indexer.retryClassifier = DefaultRetryClassifier
 
 	indexer.queueSizeInBytes = 0
+	indexer.maxBatchSizeBytes = defaultElasticsearchIndexerMaxBatchSizeBytes
+	indexer.maxBatchInterval = time.Millisecond * time.Duration(defaultElasticsearchIndexerMaxBatchIntervalMillis)
+	indexer.routedIndices = map[string]bool{}
+	indexer.createdIndices = map[string]bool{}
+	indexer.loadModeIndices = map[string]*loadModeIndex{}
 	indexer.sleepInterval = time.Millisecond * time.Duration(defaultElasticsearchIndexerSleepIntervalMillis)
+	indexer.maxDocumentBytes = defaultElasticsearchIndexerMaxDocumentBytes
+	indexer.metaField = defaultElasticsearchIndexerMetaField
+
+	indexer.done = make(chan struct{})
+	indexer.shutdown = make(chan bool)
+	indexer.stopped = make(chan struct{})
+	indexer.reconnected = make(chan *elastic.Client)
+	indexer.shutdownFlushTimeout = time.Millisecond * time.Duration(defaultElasticsearchIndexerShutdownFlushTimeoutMillis)
+
+	indexer.checkpoints = newCheckpointTracker(NewMemoryCheckpointStore())
 
-	indexer.setupBulkIndexer()
+	for _, opt := range opts {
+		if err := opt(indexer); err != nil {
+			indexer.cancelFlush()
+			return nil, fmt.Errorf("invalid option provided to indexer (%v); %w", indexer.identifier, err)
+		}
+	}
 
-	return indexer
+	if adaptive := indexer.adaptiveBatchSize; adaptive != nil {
+		size := int64(indexer.maxBatchSizeBytes)
+		if size < adaptive.minBytes {
+			size = adaptive.minBytes
+		} else if size > adaptive.maxBytes {
+			size = adaptive.maxBytes
+		}
+		atomic.StoreInt64(&indexer.stats.AdaptiveBatchSizeBytes, size)
+	}
+
+	if err := indexer.checkpoints.load(context.TODO()); err != nil {
+		log.Warningf("indexer (%v) failed to load checkpoint; no enqueued messages will be skipped as replayed; %s", indexer.identifier, err.Error())
+	}
+
+	return indexer, nil
 }
 
 // Run the indexer instance
 func (indexer *Indexer) Run() error {
 	log.Infof("running elasticsearch indexer instance %v", indexer.identifier)
-	indexer.queueFlushTicker = time.NewTicker(time.Millisecond * time.Duration(defaultElasticsearchIndexerMaxBatchIntervalMillis))
+	if indexer.maxBatchInterval > 0 {
+		indexer.queueFlushTicker = time.NewTicker(indexer.flushInterval())
+		indexer.queueFlushC = indexer.queueFlushTicker.C
+	}
+	if indexer.maxDocumentAge > 0 {
+		indexer.maxDocumentAgeTimer = time.NewTimer(indexer.maxDocumentAge)
+		indexer.maxDocumentAgeTimer.Stop()
+		indexer.maxDocumentAgeC = indexer.maxDocumentAgeTimer.C
+	}
+	indexer.startFlushWorkers()
+	defer close(indexer.stopped)
+
+	if indexer.gracefulSignals {
+		indexer.handleSignals()
+	}
 
 	for {
+		indexer.handleDueRetries()
+
+		// retries are preferred over new deliveries so they are not starved by a busy queue
+		select {
+		case msg := <-indexer.retryQ:
+			indexer.handleRetry(msg)
+			continue
+		default:
+		}
+
 		select {
 		case msg, ok := <-indexer.q:
 			if ok {
 				log.Debugf("received %d-byte delivery on inbound channel for indexer: %s", len(msg.Payload), indexer.identifier)
-
-				if msg.Header.Index != nil {
-					log.Debugf("attempting to index %d-byte document delivered for index %s", len(msg.Payload), *msg.Header.Index)
-					indexer.index(msg)
-				} else {
-					log.Warningf("skipped indexing %d-byte document delivered with invalid headers", len(msg.Payload))
-					// this is an implicit rejection of the delivery
-				}
+				indexer.handle(msg)
 			} else {
 				log.Debug("closed consumer channel")
 				// return nil
 			}
 
-		case t := <-indexer.queueFlushTicker.C:
+		case msg := <-indexer.retryQ:
+			indexer.handleRetry(msg)
+
+		case t := <-indexer.queueFlushC:
 			log.Tracef("indexer (%v) queue flush timer invoked at %v", indexer.identifier, t)
-			indexer.esBulkServiceFlush()
+			if indexer.flushJitter > 0 {
+				indexer.queueFlushTicker.Reset(indexer.flushInterval())
+			}
+			if indexer.deferTimerFlush() {
+				log.Tracef("indexer (%v) deferring timer flush of %d action(s); below configured min batch size of %d actions", indexer.identifier, len(indexer.pending), indexer.minBatchActions)
+				continue
+			}
+			indexer.dispatchFlush()
+
+		case <-indexer.maxDocumentAgeC:
+			indexer.handleMaxDocumentAge()
+
+		case req := <-indexer.flushIndex:
+			if req.all {
+				req.batch <- indexer.detachBatch()
+			} else {
+				req.batch <- indexer.detachIndexBatch(req.index)
+			}
+
+		case <-indexer.flushNow:
+			log.Tracef("indexer (%v) flush requested", indexer.identifier)
+			indexer.dispatchFlush()
+
+		case client := <-indexer.reconnected:
+			indexer.swapClient(client)
 
 		case <-indexer.shutdown:
 			log.Debugf("shutting down indexer (%v)", indexer.identifier)
 			indexer.cleanup()
-			indexer.esBulkServiceFlush()
+			indexer.stopFlushWorkers()
+			indexer.shutdownFlush()
+
+			if indexer.failureSpool != nil {
+				indexer.failureSpool.close()
+			}
+
+			if indexer.loadMode {
+				ctx, cancel := context.WithTimeout(context.Background(), indexer.shutdownFlushTimeout)
+				indexer.restoreRefresh(ctx)
+				cancel()
+			}
+
+			// recorded responses are not abandoned when the process exits after the indexer stops
+			indexer.recorderWG.Wait()
+			indexer.stopOwnedClient()
 			return nil
 
 		default:
-			time.Sleep(indexer.sleepInterval)
+			time.Sleep(indexer.idleInterval())
 		}
 	}
 }
 
-// Stop the indexer instance
-func (indexer *Indexer) Stop() {
-	indexer.shutdown <- true
+// handle attempts to index the given message, logging its rejection
+func (indexer *Indexer) handle(msg *Message) {
+	if msg.Header != nil && msg.Header.Index != nil {
+		log.Debugf("attempting to index %d-byte document delivered for index %s", len(msg.Payload), *msg.Header.Index)
+		if err := indexer.index(msg); err != nil {
+			log.Warningf("indexer (%v) rejected %d-byte document; %s", indexer.identifier, len(msg.Payload), err.Error())
+			if atomic.LoadInt32(&indexer.draining) == 1 {
+				indexer.recordShutdownFailure(msg, err)
+			}
+			indexer.settle(msg, err)
+		}
+	} else {
+		log.Warningf("skipped indexing %d-byte document delivered with invalid headers", len(msg.Payload))
+		// this is an implicit rejection of the delivery
+		indexer.settle(msg, ErrNoHeader)
+	}
+}
+
+// Stop the indexer instance, returning once it has stopped with a report of the documents which
+// failed or remained unflushed; unlike Drain, messages which are enqueued but not yet buffered are dead-lettered
+func (indexer *Indexer) Stop() *ShutdownReport {
+	atomic.StoreInt32(&indexer.draining, 1)
+	select {
+	case indexer.shutdown <- true:
+	case <-indexer.stopped:
+	}
+	<-indexer.stopped
+	return indexer.shutdownReport()
 }
 
 // Q enqueues the given message for inclusion in the bulk indexing process
 func (indexer *Indexer) Q(msg *Message) error {
-	indexer.q <- msg
-	return nil
+	if msg.Header == nil {
+		return fmt.Errorf("failed to enqueue %d-byte message; %w", len(msg.Payload), ErrNoHeader)
+	}
+
+	if msg.Header.Index == nil {
+		return fmt.Errorf("failed to enqueue %d-byte message; %w", len(msg.Payload), ErrNoIndex)
+	}
+
+	if atomic.LoadInt32(&indexer.draining) == 1 {
+		return fmt.Errorf("failed to enqueue %d-byte message to indexer (%v); %w", len(msg.Payload), indexer.identifier, ErrStopped)
+	}
+
+	// admitted before its cursor is tracked, such that a denied message does not hold back the checkpoint
+	if !indexer.admit(msg) {
+		return fmt.Errorf("failed to enqueue %d-byte message to indexer (%v); %d buffered bytes at configured max %d; %w", len(msg.Payload), indexer.identifier, atomic.LoadInt64(&indexer.admittedBytes), indexer.maxBufferedBytes, ErrQueueFull)
+	}
+
+	if msg.Header.Cursor != nil && !indexer.checkpoints.track(*msg.Header.Cursor) {
+		log.Debugf("indexer (%v) skipped replayed %d-byte message at cursor %d; already checkpointed", indexer.identifier, len(msg.Payload), *msg.Header.Cursor)
+		indexer.release(msg)
+		if msg.Ack != nil {
+			msg.Ack(nil)
+		}
+		return nil
+	}
+
+	// the queue is closed only once no enqueue holds the lock, and enqueues are abandoned once the
+	// indexer is done, such that a message is never sent on the closed queue
+	indexer.qMutex.RLock()
+	defer indexer.qMutex.RUnlock()
+
+	select {
+	case <-indexer.done:
+		indexer.abandon(msg)
+		return fmt.Errorf("failed to enqueue %d-byte message to indexer (%v); %w", len(msg.Payload), indexer.identifier, ErrStopped)
+	default:
+	}
+
+	atomic.AddInt64(&indexer.outstanding, 1)
+	select {
+	case indexer.q <- msg:
+		return nil
+	case <-indexer.done:
+		atomic.AddInt64(&indexer.outstanding, -1)
+		indexer.abandon(msg)
+		return fmt.Errorf("failed to enqueue %d-byte message to indexer (%v); %w", len(msg.Payload), indexer.identifier, ErrStopped)
+	}
+}
+
+// abandon releases the admission and cursor of a message which was admitted but could not be enqueued
+func (indexer *Indexer) abandon(msg *Message) {
+	indexer.release(msg)
+	if msg.Header.Cursor != nil {
+		indexer.checkpoints.untrack(*msg.Header.Cursor)
+	}
+}
+
+// QMap marshals the given document and enqueues it for the given index, using the given id (if any);
+// an error is returned when the document cannot be marshaled, rather than it being silently dropped
+func (indexer *Indexer) QMap(index string, id *string, doc map[string]interface{}) error {
+	payload, err := jsonCodec.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to marshal document for index %s; %w", index, err)
+	}
+
+	return indexer.Q(&Message{
+		Header: &MessageHeader{
+			ID:    id,
+			Index: &index,
+		},
+		Payload: payload,
+	})
 }
 
 func (indexer *Indexer) cleanup() {
 	log.Debugf("cleaning up indexer (%v)", indexer.identifier)
-	indexer.queueFlushTicker.Stop()
+	if indexer.queueFlushTicker != nil {
+		indexer.queueFlushTicker.Stop()
+	}
+	if indexer.maxDocumentAgeTimer != nil {
+		indexer.maxDocumentAgeTimer.Stop()
+	}
+	close(indexer.done)
 
 	log.Debugf("closing buffered queue for indexer (%v)", indexer.identifier)
+	indexer.qMutex.Lock()
 	close(indexer.q)
+	indexer.qMutex.Unlock()
 
 	log.Infof("indexer instance (%v) closed", indexer.identifier)
 }
 
-func (indexer *Indexer) setupBulkIndexer() error {
-	indexer.esBulkService = elastic.NewBulkService(indexer.client)
-	indexer.esBulkService.Timeout(fmt.Sprintf("%ds", elasticTimeout))
-	indexer.esBulkService.Pretty(false)
+// bulkClient returns the client with which the next bulk request is sent, which may be nil if the
+// client pool has since been emptied
+func (indexer *Indexer) bulkClient() *elastic.Client {
+	if indexer.selectClients {
+		// distributed across the healthy clients rather than pinned to the client of the indexer
+		client, _ := GetClient()
+		return client
+	}
+	return indexer.client
+}
 
-	return nil
+// newBulkService returns a bulk service sent using the given client, configured for the indexer
+// containing the given actions
+func (indexer *Indexer) newBulkService(client *elastic.Client, pending []*queuedAction) *elastic.BulkService {
+	svc := elastic.NewBulkService(client)
+	timeout := fmt.Sprintf("%ds", elasticTimeout)
+	if len(pending) > 0 {
+		// batches are split such that each contains only indices sharing a timeout
+		timeout = indexer.bulkTimeout(*pending[0].msg.Header.Index)
+	}
+	svc.Timeout(timeout)
+	svc.Pretty(false)
+	if indexer.waitForActiveShards != "" {
+		svc.WaitForActiveShards(indexer.waitForActiveShards)
+	}
+	if indexer.bulkContentType != "" {
+		svc.Header(contentTypeOverrideHeader, indexer.bulkContentType)
+	}
+
+	for _, action := range pending {
+		svc.Add(action.req)
+	}
+
+	return svc
 }
 
 func (indexer *Indexer) index(msg *Message) error {
-	if indexer.queueSizeInBytes == 0 {
+	if indexer.queueSizeInBytes == 0 && indexer.queueFlushTicker != nil {
 		log.Debugf("indexer (%v) queue is currently empty, resetting queue flush timer", indexer.identifier)
-		indexer.queueFlushTicker.Reset(time.Millisecond * time.Duration(defaultElasticsearchIndexerMaxBatchIntervalMillis))
+		indexer.queueFlushTicker.Reset(indexer.flushInterval())
 	}
 
 	if msg.Header == nil {
-		return fmt.Errorf("failed to index %d-byte message; no header provided", len(msg.Payload))
+		return fmt.Errorf("failed to index %d-byte message; %w", len(msg.Payload), ErrNoHeader)
 	}
 
 	if msg.Header.Index == nil {
-		return fmt.Errorf("failed to index %d-byte message; no index provided in header", len(msg.Payload))
+		return fmt.Errorf("failed to index %d-byte message; %w", len(msg.Payload), ErrNoIndex)
+	}
+
+	if err := decodePayload(msg, indexer.maxDocumentBytes); err != nil {
+		// a corrupt payload can never be indexed; dead-lettered rather than retried
+		indexer.deadLetter(msg, err)
+		return nil
+	}
+
+	if msg.Header.ID == nil && indexer.idGenerator != nil {
+		// assigned on the header so retries of the message reuse the generated id
+		msg.Header.ID = stringOrNil(indexer.idGenerator(msg))
+	}
+
+	if len(indexer.preprocessors) > 0 {
+		processed, err := indexer.preprocess(msg)
+		if err != nil {
+			return fmt.Errorf("failed to preprocess %d-byte message; %s", len(msg.Payload), err.Error())
+		}
+		if processed == nil {
+			log.Tracef("indexer (%v) skipped %d-byte message per preprocessor", indexer.identifier, len(msg.Payload))
+			indexer.settle(msg, nil)
+			return nil
+		}
+		if processed.Header == nil || processed.Header.Index == nil {
+			return fmt.Errorf("failed to index %d-byte preprocessed message; %w", len(processed.Payload), ErrNoHeader)
+		}
+		// either the replacement or, if it is rejected, the message it was derived from is settled
+		if processed.Header.Cursor == nil {
+			processed.Header.Cursor = msg.Header.Cursor
+		}
+		if processed.Ack == nil {
+			processed.Ack = msg.Ack
+		}
+		processed.admittedBytes = msg.admittedBytes
+		msg = processed
+	}
+
+	if tbi, ok := indexer.timeBasedIndices[*msg.Header.Index]; ok {
+		// resolved from the payload prior to redaction, and assigned on the header so retries of the message reuse it
+		msg.Header.Index = stringOrNil(tbi.resolve(msg.Payload))
+	}
+
+	if indexer.routingField != nil && msg.Header.Routing == nil && !isDeleteOp(msg) {
+		// extracted prior to redaction, and assigned on the header so retries of the message reuse it
+		msg.Header.Routing = payloadField(msg.Payload, indexer.routingField)
+	}
+
+	if len(msg.Header.Meta) > 0 && !isDeleteOp(msg) {
+		payload, err := mergeMeta(msg.Payload, indexer.metaField, msg.Header.Meta)
+		if err != nil {
+			return fmt.Errorf("failed to index %d-byte message; failed to merge metadata; %s", len(msg.Payload), err.Error())
+		}
+		// merged once, such that retries of the message do not merge it again
+		msg.Payload = payload
+		msg.Header.Meta = nil
+	}
+
+	if indexer.fieldRedactor != nil && !isDeleteOp(msg) {
+		payload, err := indexer.fieldRedactor.redact(msg.Payload)
+		if err != nil {
+			return fmt.Errorf("failed to index %d-byte message; failed to redact fields; %s", len(msg.Payload), err.Error())
+		}
+		msg.Payload = payload
+	}
+
+	if shards, ok := indexer.indexShards[*msg.Header.Index]; ok {
+		// assigned on the header so retries of the message target the same physical index
+		msg.Header.Index = stringOrNil(shardIndex(*msg.Header.Index, shards, msg))
 	}
 
 	size := len(msg.Payload)
 	index := msg.Header.Index
 
-	log.Tracef("attempting to index %d-byte %v document in index %v: %v", size, index, msg)
+	if err := indexer.validateIndexAccess(*index); err != nil {
+		indexer.deadLetter(msg, err)
+		return nil
+	}
+
+	if indexer.maxDocumentBytes > 0 && size > indexer.maxDocumentBytes {
+		// dead-lettered before it is added to a batch, as it would otherwise fail the entire bulk request
+		indexer.deadLetter(msg, fmt.Errorf("%d-byte document exceeds configured max %d-byte document size", size, indexer.maxDocumentBytes))
+		return nil
+	}
+
+	log.Tracef("attempting to index %d-byte document in index %v: %v", size, *index, msg)
 	log.Tracef("current bulk queue size of indexer (%v) in bytes: %d", indexer.identifier, indexer.queueSizeInBytes)
 
-	if indexer.queueSizeInBytes+size >= defaultElasticsearchIndexerMaxBatchSizeBytes {
-		log.Debugf("adding %d-byte %v document would exceed configured max %d-byte batch size", size, defaultElasticsearchIndexerMaxBatchSizeBytes)
-		indexer.esBulkServiceFlush()
+	req, err := indexer.bulkRequest(msg)
+	if err != nil {
+		return err
 	}
 
-	req := elastic.NewBulkIndexRequest().Index(*index).Doc(string(msg.Payload))
-	if msg.Header.ID != nil {
-		req.Id(*msg.Header.ID)
+	if indexer.autoCreateIndex != nil && !msg.Header.DataStream && !isDeleteOp(msg) {
+		// bounded, as the run loop blocks until the index is ensured
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*time.Duration(defaultElasticsearchIndexerEnsureIndexTimeoutMillis))
+		indexer.ensureIndex(ctx, *index)
+		cancel()
+	}
+
+	if indexer.loadMode {
+		// bounded, as the run loop blocks until refresh of the index is disabled
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*time.Duration(defaultElasticsearchIndexerLoadModeTimeoutMillis))
+		indexer.disableRefresh(ctx, *index)
+		cancel()
+	}
+
+	if limit := indexer.batchSizeLimit(); limit > 0 && indexer.queueSizeInBytes+size >= limit {
+		log.Debugf("adding %d-byte document would exceed configured max %d-byte batch size", size, limit)
+		indexer.dispatchFlush()
+	}
+
+	if indexer.homogeneousBatches && len(indexer.pending) > 0 {
+		if batchOp := messageOp(indexer.pending[len(indexer.pending)-1].msg); batchOp != messageOp(msg) {
+			log.Debugf("indexer (%v) flushing batch of %s ops before queueing %s op", indexer.identifier, batchOp, messageOp(msg))
+			indexer.dispatchFlush()
+		}
+	}
+
+	if len(indexer.indexTimeouts) > 0 && len(indexer.pending) > 0 {
+		batchTimeout := indexer.bulkTimeout(*indexer.pending[len(indexer.pending)-1].msg.Header.Index)
+		if timeout := indexer.bulkTimeout(*index); timeout != batchTimeout {
+			log.Debugf("indexer (%v) flushing batch with %s timeout before queueing document for index %s with %s timeout", indexer.identifier, batchTimeout, *index, timeout)
+			indexer.dispatchFlush()
+		}
+	}
+
+	action := &queuedAction{msg: msg, req: req, size: size, superseded: msg.superseded}
+	msg.superseded = nil
+	if indexer.deduplicate(action) {
+		return nil
 	}
 
 	log.Debugf("queueing request in elasticsearch bulk index service: %v", req.String())
-	indexer.esBulkService.Add(req)
+	if len(indexer.pending) == 0 {
+		indexer.batchStartedAt = time.Now()
+		indexer.armMaxDocumentAgeTimer()
+	}
+	indexer.pending = append(indexer.pending, action)
+	atomic.AddInt64(&indexer.bufferedActions, 1)
 	indexer.queueSizeInBytes += size
 
+	if indexer.maxBatchActions > 0 && len(indexer.pending) >= indexer.maxBatchActions {
+		log.Debugf("indexer (%v) reached configured max batch size of %d actions", indexer.identifier, indexer.maxBatchActions)
+		indexer.dispatchFlush()
+	}
+
 	return nil
 }
 
-func (indexer *Indexer) esBulkServiceFlush() (*elastic.BulkResponse, error) {
-	indexer.flushMutex.Lock()
-	defer indexer.flushMutex.Unlock()
+// bulkRequest builds the bulk action for the given message, validating the op requested in its header
+func (indexer *Indexer) bulkRequest(msg *Message) (elastic.BulkableRequest, error) {
+	if msg.Header.OpType != nil {
+		if *msg.Header.OpType != OpIndex && *msg.Header.OpType != OpCreate {
+			return nil, fmt.Errorf("failed to index %d-byte message; invalid op_type %s provided in header", len(msg.Payload), *msg.Header.OpType)
+		}
+		if msg.Header.Op != nil && *msg.Header.Op != *msg.Header.OpType {
+			return nil, fmt.Errorf("failed to index %d-byte message; op_type %s conflicts with op %s provided in header", len(msg.Payload), *msg.Header.OpType, *msg.Header.Op)
+		}
+	}
 
-	indexer.queueSizeInBytes = 0
-	if indexer.esBulkService.NumberOfActions() == 0 {
+	op := messageOp(msg)
+	if op != OpIndex && op != OpCreate && op != OpUpdate && op != OpDelete {
+		return nil, fmt.Errorf("failed to index %d-byte message; invalid op %s provided in header", len(msg.Payload), op)
+	}
+
+	index := *msg.Header.Index
+	if msg.Header.DataStream && op != OpCreate {
+		return nil, fmt.Errorf("failed to index %d-byte message; only %s ops are permitted for data stream %s", len(msg.Payload), OpCreate, index)
+	}
+
+	if err := indexer.validateIndexPolicy(msg, index, op); err != nil {
+		return nil, err
+	}
+
+	docType := indexer.documentType(msg)
+
+	if op == OpDelete {
+		if msg.Header.ID == nil {
+			return nil, fmt.Errorf("failed to delete document in index %s; no id provided in header", index)
+		}
+		if msg.Header.Routing == nil && indexer.routedIndices[index] {
+			return nil, fmt.Errorf("failed to delete document %s in index %s; index contains routed documents but no routing provided in header", *msg.Header.ID, index)
+		}
+
+		req := elastic.NewBulkDeleteRequest().Index(index).Id(*msg.Header.ID)
+		if msg.Header.Routing != nil {
+			req.Routing(*msg.Header.Routing)
+		}
+		if msg.Header.IfSeqNo != nil && msg.Header.IfPrimaryTerm != nil {
+			req.IfSeqNo(*msg.Header.IfSeqNo).IfPrimaryTerm(*msg.Header.IfPrimaryTerm)
+		}
+		if docType != nil {
+			req.Type(*docType)
+		}
+		return req, nil
+	}
+
+	// an invalid document would otherwise poison the entire bulk request
+	if !jsonCodec.Valid(msg.Payload) {
+		return nil, fmt.Errorf("failed to index %d-byte message in index %s; payload is not valid json", len(msg.Payload), index)
+	}
+
+	if op == OpUpdate {
+		if msg.Header.ID == nil {
+			return nil, fmt.Errorf("failed to update document in index %s; no id provided in header", index)
+		}
+
+		req := elastic.NewBulkUpdateRequest().Index(index).Id(*msg.Header.ID).Doc(json.RawMessage(msg.Payload))
+		if msg.Header.Routing != nil {
+			req.Routing(*msg.Header.Routing)
+		}
+		if msg.Header.IfSeqNo != nil && msg.Header.IfPrimaryTerm != nil {
+			req.IfSeqNo(*msg.Header.IfSeqNo).IfPrimaryTerm(*msg.Header.IfPrimaryTerm)
+		}
+		if msg.Header.FetchSource {
+			req.ReturnSource(true)
+		}
+		if docType != nil {
+			req.Type(*docType)
+		}
+		return req, nil
+	}
+
+	req := elastic.NewBulkIndexRequest().Index(index).OpType(op).Doc(string(msg.Payload))
+	if msg.Header.ID != nil {
+		req.Id(*msg.Header.ID)
+	}
+	if msg.Header.Routing != nil {
+		req.Routing(*msg.Header.Routing)
+		indexer.routedIndices[index] = true
+	}
+	if msg.Header.Pipeline != nil {
+		req.Pipeline(*msg.Header.Pipeline)
+	} else if elasticDefaultPipeline != nil {
+		req.Pipeline(*elasticDefaultPipeline)
+	}
+	if msg.Header.IfSeqNo != nil && msg.Header.IfPrimaryTerm != nil {
+		req.IfSeqNo(*msg.Header.IfSeqNo).IfPrimaryTerm(*msg.Header.IfPrimaryTerm)
+	}
+	if docType != nil {
+		req.Type(*docType)
+	}
+
+	meta := map[string]interface{}{}
+	if len(msg.Header.DynamicTemplates) > 0 {
+		meta["dynamic_templates"] = msg.Header.DynamicTemplates
+	}
+	if msg.Header.RequireAlias || indexer.requireAlias {
+		meta["require_alias"] = true
+	}
+
+	return withActionMeta(req, meta), nil
+}
+
+// ensureIndex creates the given index using the configured auto-create settings the first time
+// the indexer encounters it, unless it already exists; the outcome is cached per index
+func (indexer *Indexer) ensureIndex(ctx context.Context, index string) {
+	if indexer.createdIndices[index] {
+		return
+	}
+
+	client := indexer.bulkClient()
+	if client == nil {
+		log.Warningf("indexer (%v) failed to check existence of elasticsearch index %s; %s", indexer.identifier, index, ErrNoClient.Error())
+		return
+	}
+
+	exists, err := client.IndexExists(index).Do(ctx)
+	if err != nil {
+		log.Warningf("indexer (%v) failed to check existence of elasticsearch index %s; %s", indexer.identifier, index, err.Error())
+		return
+	}
+
+	if !exists {
+		_, err = client.CreateIndex(index).BodyJson(indexer.autoCreateIndex).Do(ctx)
+		if err != nil && !elastic.IsStatusCode(err, http.StatusBadRequest) {
+			log.Warningf("indexer (%v) failed to create elasticsearch index %s; %s", indexer.identifier, index, err.Error())
+			return
+		} else if err != nil {
+			// most likely created concurrently (i.e., resource_already_exists_exception)
+			log.Debugf("indexer (%v) did not create elasticsearch index %s; %s", indexer.identifier, index, err.Error())
+		} else {
+			log.Debugf("indexer (%v) created elasticsearch index %s", indexer.identifier, index)
+		}
+	}
+
+	indexer.createdIndices[index] = true
+}
+
+// messageOp returns the op requested in the header of the given message
+func messageOp(msg *Message) string {
+	if msg.Header.Op != nil {
+		return *msg.Header.Op
+	} else if msg.Header.OpType != nil {
+		return *msg.Header.OpType
+	} else if msg.Header.DataStream {
+		return OpCreate
+	}
+	return OpIndex
+}
+
+// isDeleteOp returns true when the given message requests deletion of a document
+func isDeleteOp(msg *Message) bool {
+	return msg.Header.Op != nil && *msg.Header.Op == OpDelete
+}
+
+// documentType returns the document type provided in the message header, if supported by the configured cluster
+func (indexer *Indexer) documentType(msg *Message) *string {
+	if msg.Header.Type == nil {
+		return nil
+	}
+	if !elasticDocumentTypesSupported {
+		log.Debugf("ignoring document type %s provided in header; document types are not supported by the configured elasticsearch cluster", *msg.Header.Type)
+		return nil
+	}
+	return msg.Header.Type
+}
+
+// shutdownFlush flushes any queued actions, giving up after the configured shutdown flush timeout
+func (indexer *Indexer) shutdownFlush() {
+	ctx, cancel := context.WithTimeout(context.Background(), indexer.shutdownFlushTimeout)
+	defer cancel()
+
+	actions := len(indexer.pending)
+	_, err := indexer.esBulkServiceFlush(ctx)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		log.Warningf("indexer (%v) final flush timed out after %v; %d queued actions were lost", indexer.identifier, indexer.shutdownFlushTimeout, actions)
+	}
+
+	// nothing remains to drain the retry buffer or queue once stopped
+	for _, msg := range indexer.retryBacklog {
+		atomic.AddInt64(&indexer.retrying, -1)
+		indexer.deadLetter(msg, fmt.Errorf("indexer (%v) stopped before retry; %w", indexer.identifier, ErrStopped))
+	}
+	indexer.retryBacklog = nil
+
+	for {
+		select {
+		case msg := <-indexer.retryQ:
+			atomic.AddInt64(&indexer.retrying, -1)
+			indexer.deadLetter(msg, fmt.Errorf("indexer (%v) stopped before retry; %w", indexer.identifier, ErrStopped))
+		default:
+			for msg := range indexer.q {
+				indexer.deadLetter(msg, fmt.Errorf("indexer (%v) stopped before indexing; %w", indexer.identifier, ErrStopped))
+			}
+			return
+		}
+	}
+}
+
+// esBulkServiceFlush synchronously sends the queued actions as a single bulk request
+func (indexer *Indexer) esBulkServiceFlush(ctx context.Context) (*elastic.BulkResponse, error) {
+	batch := indexer.detachBatch()
+	if batch == nil {
 		msg := fmt.Sprintf("indexer (%v) attempted to send Elasticsearch bulk index request, but nothing was queued", indexer.identifier)
 		log.Tracef(msg)
 		return nil, errors.New(msg)
 	}
 
-	response, err := indexer.esBulkService.Do(context.TODO())
+	return indexer.sendBatch(ctx, batch)
+}
+
+// detachBatch hands off the queued actions, replacing the bulk service so queueing can continue
+// while the detached batch is sent; nil is returned when nothing is queued
+func (indexer *Indexer) detachBatch() *bulkBatch {
+	indexer.flushMutex.Lock()
+	defer indexer.flushMutex.Unlock()
+
+	size := indexer.queueSizeInBytes
+	indexer.queueSizeInBytes = 0
+	if len(indexer.pending) == 0 {
+		return nil
+	}
+
+	batch := indexer.newBatch(indexer.pending, size)
+
+	indexer.pending = nil
+	indexer.dedupeKeys = nil
+	atomic.StoreInt64(&indexer.bufferedActions, 0)
+
+	return batch
+}
+
+// newBatch returns a batch of the given actions, identified by a new opaque id
+func (indexer *Indexer) newBatch(pending []*queuedAction, sizeInBytes int) *bulkBatch {
+	opaqueID, _ := uuid.NewV4()
+	client := indexer.bulkClient()
+
+	batch := &bulkBatch{
+		client:      client,
+		service:     indexer.newBulkService(client, pending),
+		pending:     pending,
+		sizeInBytes: sizeInBytes,
+		opaqueID:    opaqueID.String(),
+	}
+	batch.service.Header("X-Opaque-Id", batch.opaqueID)
+
+	return batch
+}
+
+// sendBatch sends the given batch, retrying or dead-lettering each of its failed actions
+func (indexer *Indexer) sendBatch(ctx context.Context, batch *bulkBatch) (*elastic.BulkResponse, error) {
+	// once the context expires the request is sent regardless, failing as it otherwise would
+	if indexer.requestLimiter != nil {
+		indexer.requestLimiter.wait(ctx, 1)
+	}
+	if indexer.byteLimiter != nil {
+		indexer.byteLimiter.wait(ctx, float64(batch.service.EstimatedSizeInBytes()))
+	}
+
+	indexer.recordBulkBody(batch)
+
+	var response *elastic.BulkResponse
+	var err error
+	if batch.client == nil {
+		// the actions are dead-lettered rather than sent using a nil client
+		err = fmt.Errorf("failed to send bulk request (%s); %w", batch.opaqueID, ErrNoClient)
+	} else {
+		indexer.acquireInFlight(batch.sizeInBytes)
+		// bounded such that an unresponsive cluster cannot block the run loop or a flush worker indefinitely
+		reqCtx, cancel := context.WithTimeout(ctx, indexer.flushDeadline(batch))
+		startedAt := time.Now()
+		response, err = batch.service.Do(reqCtx)
+		cancel()
+		indexer.adaptBatchSize(time.Since(startedAt), response, err)
+		indexer.releaseInFlight(batch.sizeInBytes)
+	}
+
+	indexer.trackFlushErr(err)
+	atomic.AddInt64(&indexer.stats.Flushes, 1)
+
+	// superseded messages are settled with the outcome of the actions replacing them, following them into the retry buffer
+	pending := batch.pending
+	for _, action := range pending {
+		action.msg.superseded = append(action.msg.superseded, action.superseded...)
+		action.superseded = nil
+	}
+
 	if err != nil {
-		log.Warningf("elasticsearch bulk index request failed: %v", err)
-		// FIXME-- implement strategy to retry failed items
-		// in some cases, we will want to requeue the reconstituted message (i.e. ES connection timeout)...
-		// and in other cases, we will want to reject the message and not requeue it (i.e. bad request).
+		atomic.AddInt64(&indexer.stats.FailedFlushes, 1)
+		log.Warningf("elasticsearch bulk index request (%s) failed: %v", batch.opaqueID, err)
+
+		// actions which failed to send are requeued individually so the retry buffer
+		// can bound their attempts, and the rest are rejected (i.e. bad request)
+		for _, action := range pending {
+			if indexer.isRetryableErr(err) {
+				indexer.retry(action.msg, err)
+			} else {
+				indexer.deadLetter(action.msg, err)
+			}
+		}
 	} else {
-		log.Debugf("indexer (%v) successfully indexed %d items in %dms via bulk request", len(response.Items), response.Took)
+		atomic.AddInt64(&indexer.stats.Indexed, int64(len(response.Succeeded())))
+		atomic.AddInt64(&indexer.stats.Failed, int64(len(response.Failed())))
+
+		log.Debugf("indexer (%v) successfully indexed %d items in %dms via bulk request (%s)", indexer.identifier, len(response.Items), response.Took, batch.opaqueID)
 		log.Tracef("elasticsearch bulk index response items: %v", response.Items)
 
-		for _, item := range response.Succeeded() {
-			messageId := item.Id
-			docType := item.Type
-			log.Tracef("indexer (%v) indexed %v document with id: %v", indexer.identifier, docType, messageId)
+		if indexer.responseRecorder != nil {
+			indexer.recorderWG.Add(1)
+			go func() {
+				defer indexer.recorderWG.Done()
+				indexer.responseRecorder(context.Background(), response)
+			}()
 		}
 
-		for _, item := range response.Failed() {
-			log.Warningf("indexer (%v) failed to index document in bulk request; %v", item.Error)
+		// read-only blocks are cleared at most once per index within the batch, when enabled
+		clearedIndices := map[string]error{}
+
+		if len(response.Items) != len(pending) {
+			log.Warningf("indexer (%v) received %d response items for %d actions sent via bulk request (%s)", indexer.identifier, len(response.Items), len(pending), batch.opaqueID)
+		}
+
+		// response items are returned in the order the actions were added to the bulk request, such that
+		// each item is correlated with its source message by position; surplus items cannot be correlated
+		for i, items := range response.Items {
+			if i >= len(pending) {
+				break
+			}
+
+			for op, item := range items {
+				if indexer.resultHandler != nil {
+					indexer.resultHandler(pending[i].msg, item)
+				}
+
+				if item.Error == nil && item.Status < 300 {
+					log.Tracef("indexer (%v) indexed %v document with id: %v", indexer.identifier, item.Type, item.Id)
+					indexer.settle(pending[i].msg, nil)
+					continue
+				}
+
+				log.Warningf("indexer (%v) failed to index document in bulk request; %v", indexer.identifier, item.Error)
+
+				itemErr := newBulkItemError(op, item)
+				if readOnlyErr := readOnlyIndexErr(item); readOnlyErr != nil {
+					indexer.handleReadOnlyIndex(ctx, pending[i].msg, readOnlyErr, clearedIndices)
+				} else if indexer.isRetryableItem(item) {
+					indexer.retry(pending[i].msg, itemErr)
+				} else {
+					indexer.deadLetter(pending[i].msg, itemErr)
+				}
+			}
+		}
+
+		// actions lacking a response item are unconfirmed, and are retried rather than left unsettled
+		for i := len(response.Items); i < len(pending); i++ {
+			indexer.retry(pending[i].msg, fmt.Errorf("no response item for action %d of bulk request (%s)", i, batch.opaqueID))
+		}
+
+		if indexer.strictBulkErrors {
+			if bulkErrs := newBulkErrors(response); bulkErrs != nil {
+				return response, bulkErrs
+			}
 		}
 	}
 
@@ -0,0 +1,450 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	uuid "github.com/kthomas/go.uuid"
+	"github.com/olivere/elastic/v7"
+)
+
+func TestIndexerSendsDocumentTypeWhenSupported(t *testing.T) {
+	supported := elasticDocumentTypesSupported
+	elasticDocumentTypesSupported = true
+	defer func() { elasticDocumentTypesSupported = supported }()
+
+	indexer, transport := newStubIndexer(t, okBulkHandler(t))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	msg := testMessage("legacy", "1", `{"a":1}`)
+	msg.Header.Type = stringOrNil("doc")
+	if err := indexer.Q(msg); err != nil {
+		t.Fatalf("failed to enqueue message; %s", err.Error())
+	}
+	waitIdle(t, indexer)
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 1 {
+		t.Fatalf("expected 1 bulk action; got %d", len(commands))
+	}
+	if docType := commands[0].meta["_type"]; docType != "doc" {
+		t.Errorf("expected document type doc; got %v", docType)
+	}
+}
+
+func TestIndexerOmitsDocumentTypeWhenUnsupported(t *testing.T) {
+	supported := elasticDocumentTypesSupported
+	elasticDocumentTypesSupported = false
+	defer func() { elasticDocumentTypesSupported = supported }()
+
+	indexer, transport := newStubIndexer(t, okBulkHandler(t))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	msg := testMessage("modern", "1", `{"a":1}`)
+	msg.Header.Type = stringOrNil("doc")
+	if err := indexer.Q(msg); err != nil {
+		t.Fatalf("failed to enqueue message; %s", err.Error())
+	}
+	waitIdle(t, indexer)
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 1 {
+		t.Fatalf("expected 1 bulk action; got %d", len(commands))
+	}
+	if docType, ok := commands[0].meta["_type"]; ok {
+		t.Errorf("expected no document type; got %v", docType)
+	}
+}
+
+// hangingBulkHandler returns a handler which never responds to bulk requests, until the request is cancelled
+func hangingBulkHandler() stubHandler {
+	return func(req *stubRequest) (int, string) {
+		if strings.HasSuffix(req.Path, "/_bulk") {
+			<-req.ctx.Done()
+			return 0, ""
+		}
+		return http.StatusOK, "{}"
+	}
+}
+
+func TestStopBoundsFinalFlushByShutdownFlushTimeout(t *testing.T) {
+	indexer, transport := newStubIndexer(t, hangingBulkHandler(), WithShutdownFlushTimeout(100*time.Millisecond))
+	stop := runIndexer(indexer)
+
+	if err := indexer.Q(testMessage("events", "1", `{"a":1}`)); err != nil {
+		t.Fatalf("failed to enqueue message; %s", err.Error())
+	}
+	waitFor(t, "message to be buffered", func() bool { return atomic.LoadInt64(&indexer.bufferedActions) == 1 })
+
+	startedAt := time.Now()
+	report := stop()
+	if elapsed := time.Since(startedAt); elapsed > 2*time.Second {
+		t.Errorf("expected stop to be bounded by the shutdown flush timeout; took %v", elapsed)
+	}
+
+	if len(transport.bulkRequests()) != 1 {
+		t.Errorf("expected the final flush to be attempted")
+	}
+	if len(report.Failed) != 1 || report.Failed[0].ID != "1" {
+		t.Fatalf("expected the unflushed document to be reported; got %v", report.Failed)
+	}
+	if !strings.Contains(report.Failed[0].Reason, ErrStopped.Error()) {
+		t.Errorf("expected the document to fail as stopped; got %s", report.Failed[0].Reason)
+	}
+}
+
+func TestWithShutdownFlushTimeoutRejectsNonPositiveTimeouts(t *testing.T) {
+	if _, err := newIndexer(nil, "", WithShutdownFlushTimeout(0)); err == nil {
+		t.Errorf("expected zero shutdown flush timeout to be rejected")
+	}
+}
+
+func TestIndexerSendsRoutedDeletes(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	msg := testMessage("orders", "1", `{"a":1}`)
+	msg.Header.Routing = stringOrNil("customer-1")
+	if err := indexer.Q(msg); err != nil {
+		t.Fatalf("failed to enqueue message; %s", err.Error())
+	}
+	del := testMessage("orders", "1", "")
+	del.Header.Op = stringOrNil(OpDelete)
+	del.Header.Routing = stringOrNil("customer-1")
+	if err := indexer.Q(del); err != nil {
+		t.Fatalf("failed to enqueue delete; %s", err.Error())
+	}
+	waitIdle(t, indexer)
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 2 {
+		t.Fatalf("expected 2 bulk actions; got %d", len(commands))
+	}
+	if commands[1].op != OpDelete || commands[1].meta["_id"] != "1" {
+		t.Fatalf("expected delete of document 1; got %s %v", commands[1].op, commands[1].meta)
+	}
+	if routing := commands[1].meta["routing"]; routing != "customer-1" {
+		t.Errorf("expected delete routed to customer-1; got %v", routing)
+	}
+}
+
+func TestBulkRequestRejectsUnroutedDeletesFromRoutedIndices(t *testing.T) {
+	indexer, _ := newStubIndexer(t, nil)
+
+	msg := testMessage("orders", "1", `{"a":1}`)
+	msg.Header.Routing = stringOrNil("customer-1")
+	if _, err := indexer.bulkRequest(msg); err != nil {
+		t.Fatalf("failed to build routed index request; %s", err.Error())
+	}
+
+	del := testMessage("orders", "1", "")
+	del.Header.Op = stringOrNil(OpDelete)
+	if _, err := indexer.bulkRequest(del); err == nil {
+		t.Errorf("expected delete without routing from a routed index to be rejected")
+	}
+
+	del = testMessage("orders", "", "")
+	del.Header.Op = stringOrNil(OpDelete)
+	del.Header.Routing = stringOrNil("customer-1")
+	if _, err := indexer.bulkRequest(del); err == nil {
+		t.Errorf("expected delete without id to be rejected")
+	}
+}
+
+func TestIndexerSendsUpdatesAndHandsResultsToResultHandler(t *testing.T) {
+	handler := func(req *stubRequest) (int, string) {
+		if strings.HasSuffix(req.Path, "/_bulk") {
+			return http.StatusOK, `{"took":1,"errors":false,"items":[{"update":{"_index":"orders","_id":"1","status":200,"result":"updated","get":{"found":true,"_source":{"a":1,"b":2}}}}]}`
+		}
+		return http.StatusOK, "{}"
+	}
+
+	results := make(chan *elastic.BulkResponseItem, 1)
+	indexer, transport := newStubIndexer(t, handler, WithResultHandler(func(msg *Message, item *elastic.BulkResponseItem) {
+		results <- item
+	}))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	msg := testMessage("orders", "1", `{"b":2}`)
+	msg.Header.Op = stringOrNil(OpUpdate)
+	msg.Header.FetchSource = true
+	if err := indexer.Q(msg); err != nil {
+		t.Fatalf("failed to enqueue message; %s", err.Error())
+	}
+	waitIdle(t, indexer)
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 1 || commands[0].op != OpUpdate {
+		t.Fatalf("expected 1 update action; got %d", len(commands))
+	}
+	var source map[string]interface{}
+	if err := jsonCodec.Unmarshal(commands[0].source, &source); err != nil {
+		t.Fatalf("failed to parse update source; %s", err.Error())
+	}
+	if doc, _ := source["doc"].(map[string]interface{}); doc["b"] != float64(2) {
+		t.Errorf("expected the payload to be sent as the partial document; got %s", commands[0].source)
+	}
+	if source["_source"] != true {
+		t.Errorf("expected the updated source to be requested; got %s", commands[0].source)
+	}
+
+	item := <-results
+	if item.GetResult == nil || string(item.GetResult.Source) != `{"a":1,"b":2}` {
+		t.Errorf("expected the updated source to be handed to the result handler; got %v", item.GetResult)
+	}
+}
+
+func TestBulkRequestRejectsUpdatesWithoutID(t *testing.T) {
+	indexer, _ := newStubIndexer(t, nil)
+
+	msg := testMessage("orders", "", `{"b":2}`)
+	msg.Header.Op = stringOrNil(OpUpdate)
+	if _, err := indexer.bulkRequest(msg); err == nil {
+		t.Errorf("expected update without id to be rejected")
+	}
+}
+
+func TestIndexerSendsDistinctOpaqueIDWithEachBulkRequest(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	for _, id := range []string{"1", "2"} {
+		enqueueAll(t, indexer, 1, testMessage("events", id, `{"a":1}`))
+		waitIdle(t, indexer)
+	}
+	enqueueAll(t, indexer, 1, testMessage("logs", "1", `{"a":1}`))
+	if _, err := indexer.FlushIndex(context.Background(), "logs"); err != nil {
+		t.Fatalf("failed to flush index; %s", err.Error())
+	}
+
+	reqs := transport.bulkRequests()
+	if len(reqs) != 3 {
+		t.Fatalf("expected 3 bulk requests; got %d", len(reqs))
+	}
+	seen := map[string]bool{}
+	for _, req := range reqs {
+		opaqueID := req.Header.Get("X-Opaque-Id")
+		if _, err := uuid.FromString(opaqueID); err != nil {
+			t.Errorf("expected a uuid opaque id; got %q", opaqueID)
+		}
+		if seen[opaqueID] {
+			t.Errorf("expected a distinct opaque id for each bulk request; got %s twice", opaqueID)
+		}
+		seen[opaqueID] = true
+	}
+}
+
+func TestIndexerSendsExplicitOpType(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithDeduplication())
+	stop := runIndexer(indexer)
+	defer stop()
+
+	create := testMessage("events", "1", `{"a":1}`)
+	create.Header.OpType = stringOrNil(OpCreate)
+	overwrite := testMessage("events", "1", `{"a":2}`)
+	overwrite.Header.OpType = stringOrNil(OpIndex)
+	enqueueAll(t, indexer, 2, create, overwrite)
+	waitIdle(t, indexer)
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 2 {
+		t.Fatalf("expected the create not to be collapsed; got %d bulk actions", len(commands))
+	}
+	if commands[0].op != OpCreate || commands[1].op != OpIndex {
+		t.Errorf("expected create then index actions; got %s, %s", commands[0].op, commands[1].op)
+	}
+}
+
+func TestBulkRequestValidatesOpType(t *testing.T) {
+	indexer, _ := newStubIndexer(t, nil)
+
+	msg := testMessage("events", "1", `{"a":1}`)
+	msg.Header.OpType = stringOrNil(OpDelete)
+	if _, err := indexer.bulkRequest(msg); err == nil || !strings.Contains(err.Error(), "invalid op_type") {
+		t.Errorf("expected an op_type other than index or create to be rejected; got %v", err)
+	}
+
+	msg.Header.OpType = stringOrNil(OpCreate)
+	msg.Header.Op = stringOrNil(OpIndex)
+	if _, err := indexer.bulkRequest(msg); err == nil || !strings.Contains(err.Error(), "conflicts with op") {
+		t.Errorf("expected an op_type conflicting with the op to be rejected; got %v", err)
+	}
+
+	msg.Header.Op = stringOrNil(OpCreate)
+	if _, err := indexer.bulkRequest(msg); err != nil {
+		t.Errorf("expected an op_type matching the op to be accepted; got %s", err.Error())
+	}
+}
+
+func TestQMapMarshalsAndEnqueuesDocument(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	if err := indexer.QMap("events", stringOrNil("1"), map[string]interface{}{"a": 1}); err != nil {
+		t.Fatalf("failed to enqueue document; %s", err.Error())
+	}
+	if err := indexer.QMap("events", nil, map[string]interface{}{"b": 2}); err != nil {
+		t.Fatalf("failed to enqueue document; %s", err.Error())
+	}
+	waitIdle(t, indexer)
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 2 {
+		t.Fatalf("expected 2 bulk actions; got %d", len(commands))
+	}
+	if commands[0].meta["_index"] != "events" || commands[0].meta["_id"] != "1" || string(commands[0].source) != `{"a":1}` {
+		t.Errorf("expected the marshaled document to be indexed as document 1; got %v %s", commands[0].meta, commands[0].source)
+	}
+	if _, ok := commands[1].meta["_id"]; ok {
+		t.Errorf("expected no id for the document enqueued without id; got %v", commands[1].meta)
+	}
+}
+
+func TestQMapReturnsMarshalErrors(t *testing.T) {
+	indexer, _ := newStubIndexer(t, nil)
+
+	if err := indexer.QMap("events", nil, map[string]interface{}{"a": make(chan int)}); err == nil || !strings.Contains(err.Error(), "failed to marshal document for index events") {
+		t.Errorf("expected the marshal error to be returned; got %v", err)
+	}
+	if len(indexer.q) != 0 {
+		t.Errorf("expected nothing to be enqueued")
+	}
+}
+
+func TestNewIndexerRequiresClient(t *testing.T) {
+	clients := elasticClients
+	elasticClients = nil
+	defer func() { elasticClients = clients }()
+
+	if indexer, err := NewIndexer(); !errors.Is(err, ErrNoClient) || indexer != nil {
+		t.Errorf("expected ErrNoClient without a configured client; got %v", err)
+	}
+}
+
+func TestNewIndexerReturnsInvalidOptionErrors(t *testing.T) {
+	_, restore := useStubClient(t, nil)
+	defer restore()
+
+	if indexer, err := NewIndexer(WithMinBatchSize(-1)); err == nil || indexer != nil || !strings.Contains(err.Error(), "min batch size must not be negative") {
+		t.Errorf("expected the invalid option error to be returned; got %v", err)
+	}
+	if _, err := NewIndexer(WithMinBatchSize(1)); err != nil {
+		t.Errorf("expected valid options to be accepted; got %s", err.Error())
+	}
+}
+
+func TestIndexerDeadLettersBatchesWithoutClient(t *testing.T) {
+	_, restore := useStubClient(t, okBulkHandler(t))
+	defer restore()
+
+	var dead deadLetters
+	indexer, err := NewIndexer(WithDeadLetterHandler(dead.handler()))
+	if err != nil {
+		t.Fatalf("failed to initialize indexer; %s", err.Error())
+	}
+	// as if the healthy clients were since removed from the pool
+	indexer.selectClients = true
+	elasticClients = nil
+
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueAll(t, indexer, 1, testMessage("events", "1", `{"a":1}`))
+	waitIdle(t, indexer)
+
+	if dead.len() != 1 || !errors.Is(dead.reasons[0], ErrNoClient) {
+		t.Errorf("expected the batch to be dead-lettered with ErrNoClient; got %v", dead.reasons)
+	}
+}
+
+// truncatingBulkHandler returns a handler responding to the first bulk request with only its first item,
+// and to subsequent bulk requests with an item per action followed by a surplus item
+func truncatingBulkHandler(t *testing.T) stubHandler {
+	var attempts int32
+	return func(req *stubRequest) (int, string) {
+		if !strings.HasSuffix(req.Path, "/_bulk") {
+			return http.StatusOK, "{}"
+		}
+		items := make([]string, 0)
+		for _, command := range parseBulkBody(t, req.Body) {
+			items = append(items, fmt.Sprintf(`{"index":{"_index":"events","_id":"%v","status":201}}`, command.meta["_id"]))
+		}
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			items = items[:1]
+		} else {
+			items = append(items, `{"index":{"_index":"events","_id":"surplus","status":201}}`)
+		}
+		return http.StatusOK, `{"took":1,"errors":false,"items":[` + strings.Join(items, ",") + `]}`
+	}
+}
+
+func TestIndexerRetriesActionsLackingResponseItems(t *testing.T) {
+	indexer, transport := newStubIndexer(t, truncatingBulkHandler(t), WithRetryBackoff(time.Millisecond, time.Millisecond))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	first, firstAcks := ackedMessage("events", "1", `{"a":1}`)
+	second, secondAcks := ackedMessage("events", "2", `{"a":2}`)
+	enqueueAll(t, indexer, 2, first, second)
+	waitIdle(t, indexer)
+
+	reqs := transport.bulkRequests()
+	if len(reqs) != 2 {
+		t.Fatalf("expected the unconfirmed action to be retried; got %d bulk requests", len(reqs))
+	}
+	if commands := parseBulkBody(t, reqs[1].Body); len(commands) != 1 || commands[0].meta["_id"] != "2" {
+		t.Errorf("expected only the action lacking a response item to be retried; got %v", commands)
+	}
+	if err := <-firstAcks; err != nil {
+		t.Errorf("expected the confirmed message to be acknowledged; got %s", err.Error())
+	}
+	if err := <-secondAcks; err != nil {
+		t.Errorf("expected the retried message to be acknowledged; got %s", err.Error())
+	}
+}
+
+func TestIndexerCorrelatesResponseItemsByPosition(t *testing.T) {
+	handler := func(req *stubRequest) (int, string) {
+		if strings.HasSuffix(req.Path, "/_bulk") {
+			// the ids of the items do not match those of the actions, as for auto-generated or rewritten ids
+			return http.StatusOK, `{"took":1,"errors":true,"items":[{"index":{"_index":"events","_id":"x","status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse"}}},{"index":{"_index":"events","_id":"y","status":201}}]}`
+		}
+		return http.StatusOK, "{}"
+	}
+
+	var mutex sync.Mutex
+	results := map[string]int{}
+	var dead deadLetters
+	indexer, _ := newStubIndexer(t, handler, WithDeadLetterHandler(dead.handler()), WithResultHandler(func(msg *Message, item *elastic.BulkResponseItem) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		results[*msg.Header.ID] = item.Status
+	}))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueAll(t, indexer, 2, testMessage("events", "1", `{"a":1}`), testMessage("events", "2", `{"a":2}`))
+	waitIdle(t, indexer)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if results["1"] != http.StatusBadRequest || results["2"] != http.StatusCreated {
+		t.Errorf("expected each item to be handed to the result handler with the message at its position; got %v", results)
+	}
+	if dead.len() != 1 || *dead.messages[0].Header.ID != "1" {
+		t.Errorf("expected the message at the position of the failed item to be dead-lettered")
+	}
+}
@@ -0,0 +1,408 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// defaultElasticsearchRotateCleanupTimeoutMillis bounds deleting the new index of a failed rotation,
+// which is attempted even once the context of the rotation is done
+const defaultElasticsearchRotateCleanupTimeoutMillis = 30000
+
+// uncopyableIndexSettings are the index settings assigned by elasticsearch, or tied to the index upon
+// which they are set, which are omitted when the settings of an index are copied to a new index
+var uncopyableIndexSettings = []string{
+	"blocks",
+	"creation_date",
+	"history_uuid",
+	"provided_name",
+	"resize",
+	"routing",
+	"uuid",
+	"verified_before_close",
+	"version",
+}
+
+// GetMapping returns the mappings for the given index, keyed by concrete index name; more than one
+// entry is returned when the given index is an alias or wildcard expression resolving to several indices
+func GetMapping(ctx context.Context, index string) (map[string]interface{}, error) {
+	client, err := GetClient()
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := client.GetMapping().Index(index).Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve mapping for elasticsearch index %s; %w", index, err)
+	}
+
+	mappings := map[string]interface{}{}
+	for name, result := range response {
+		if indexMapping, ok := result.(map[string]interface{}); ok {
+			mappings[name] = indexMapping["mappings"]
+		}
+	}
+
+	log.Debugf("retrieved mapping for %d elasticsearch index(es) matching %s", len(mappings), index)
+	return mappings, nil
+}
+
+// PutMapping adds the given field mappings to the given index; existing fields cannot be changed,
+// and the underlying *elastic.Error is wrapped in the returned error when the change conflicts
+func PutMapping(ctx context.Context, index string, properties map[string]interface{}) error {
+	client, err := GetClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = client.PutMapping().Index(index).BodyJson(map[string]interface{}{
+		"properties": properties,
+	}).Do(ctx)
+	if err != nil {
+		var esErr *elastic.Error
+		if errors.As(err, &esErr) && esErr.Details != nil {
+			return fmt.Errorf("failed to put mapping for elasticsearch index %s; %s: %s; %w", index, esErr.Details.Type, esErr.Details.Reason, err)
+		}
+		return fmt.Errorf("failed to put mapping for elasticsearch index %s; %w", index, err)
+	}
+
+	log.Debugf("put %d field mapping(s) for elasticsearch index %s", len(properties), index)
+	return nil
+}
+
+// ListIndices returns the names of the indices matching the given pattern, or all indices when
+// the pattern is empty; hidden (i.e., index.hidden) and system (i.e., dot-prefixed) indices are omitted
+func ListIndices(ctx context.Context, pattern string) ([]string, error) {
+	return listIndices(ctx, pattern, false)
+}
+
+// ListAllIndices returns the names of the indices matching the given pattern, or all indices when
+// the pattern is empty, including hidden and system (i.e., dot-prefixed) indices
+func ListAllIndices(ctx context.Context, pattern string) ([]string, error) {
+	return listIndices(ctx, pattern, true)
+}
+
+func listIndices(ctx context.Context, pattern string, includeHidden bool) ([]string, error) {
+	client, err := GetClient()
+	if err != nil {
+		return nil, err
+	}
+
+	svc := client.CatIndices().Columns("index").Sort("index")
+	if pattern != "" {
+		svc.Index(pattern)
+	}
+
+	rows, err := svc.Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list elasticsearch indices matching %s; %w", pattern, err)
+	}
+
+	hidden := map[string]bool{}
+	if !includeHidden && len(rows) > 0 {
+		hidden, err = hiddenIndices(ctx, client, pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list elasticsearch indices matching %s; %w", pattern, err)
+		}
+	}
+
+	indices := make([]string, 0)
+	for _, row := range rows {
+		if !includeHidden && (hidden[row.Index] || strings.HasPrefix(row.Index, ".")) {
+			continue
+		}
+		indices = append(indices, row.Index)
+	}
+
+	return indices, nil
+}
+
+// hiddenIndices returns the set of indices matching the given pattern, or of all indices when the
+// pattern is empty, which set index.hidden
+func hiddenIndices(ctx context.Context, client *elastic.Client, pattern string) (map[string]bool, error) {
+	if pattern == "" {
+		pattern = "_all"
+	}
+
+	resp, err := client.IndexGetSettings(pattern).Name("index.hidden").ExpandWildcards("all").FlatSettings(true).Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hidden setting of elasticsearch indices matching %s; %w", pattern, err)
+	}
+
+	hidden := map[string]bool{}
+	for index, settings := range resp {
+		if settings != nil && fmt.Sprintf("%v", settings.Settings["index.hidden"]) == "true" {
+			hidden[index] = true
+		}
+	}
+
+	return hidden, nil
+}
+
+// RotateIndex creates the given new index with the mappings and settings of the index currently behind
+// the given alias, reindexes the documents matching the given query (or all documents when nil) from it,
+// atomically swaps the alias to the new index and finally deletes the previous index; the new index is
+// deleted if the reindex fails
+func RotateIndex(ctx context.Context, alias, newIndex string, query elastic.Query) error {
+	return rotateIndex(ctx, alias, newIndex, query, true)
+}
+
+// RotateIndexRetainingPrevious behaves like RotateIndex but does not delete the previous index
+func RotateIndexRetainingPrevious(ctx context.Context, alias, newIndex string, query elastic.Query) error {
+	return rotateIndex(ctx, alias, newIndex, query, false)
+}
+
+func rotateIndex(ctx context.Context, alias, newIndex string, query elastic.Query, deletePrevious bool) error {
+	client, err := GetClient()
+	if err != nil {
+		return err
+	}
+
+	aliases, err := client.Aliases().Alias(alias).Do(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to resolve indices behind elasticsearch alias %s; %w", alias, err)
+	}
+
+	previous := aliases.IndicesByAlias(alias)
+	if len(previous) == 0 {
+		return fmt.Errorf("failed to rotate elasticsearch alias %s; alias does not exist", alias)
+	}
+
+	body, err := copyableIndexBody(ctx, client, previous[0])
+	if err != nil {
+		return fmt.Errorf("failed to rotate elasticsearch alias %s; %w", alias, err)
+	}
+
+	_, err = client.CreateIndex(newIndex).BodyJson(body).Do(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create elasticsearch index %s; %w", newIndex, err)
+	}
+
+	source := elastic.NewReindexSource().Index(previous...)
+	if query != nil {
+		source.Query(query)
+	}
+
+	reindexed, err := client.Reindex().Source(source).DestinationIndex(newIndex).Refresh("true").WaitForCompletion(true).Do(ctx)
+	if err != nil {
+		deleteRotatedIndex(client, newIndex)
+		return fmt.Errorf("failed to reindex %s into elasticsearch index %s; %w", strings.Join(previous, ","), newIndex, err)
+	}
+	if len(reindexed.Failures) > 0 {
+		deleteRotatedIndex(client, newIndex)
+		return fmt.Errorf("failed to reindex %d document(s) from %s into elasticsearch index %s", len(reindexed.Failures), strings.Join(previous, ","), newIndex)
+	}
+
+	swap := client.Alias()
+	for _, index := range previous {
+		swap.Remove(index, alias)
+	}
+	_, err = swap.Add(newIndex, alias).Do(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to swap elasticsearch alias %s to index %s; %w", alias, newIndex, err)
+	}
+
+	log.Debugf("rotated elasticsearch alias %s from %s to %s; reindexed %d document(s)", alias, strings.Join(previous, ","), newIndex, reindexed.Created)
+
+	if deletePrevious {
+		_, err = client.DeleteIndex(previous...).Do(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to delete previous elasticsearch index %s; %w", strings.Join(previous, ","), err)
+		}
+	}
+
+	return nil
+}
+
+// copyableIndexBody returns the create index body copying the mappings and settings of the given index,
+// omitting the settings which cannot be set upon a new index
+func copyableIndexBody(ctx context.Context, client *elastic.Client, index string) (map[string]interface{}, error) {
+	settingsResp, err := client.IndexGetSettings(index).Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get settings of elasticsearch index %s; %w", index, err)
+	}
+
+	mappingResp, err := client.GetMapping().Index(index).Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve mapping for elasticsearch index %s; %w", index, err)
+	}
+
+	body := map[string]interface{}{}
+	if settings, ok := settingsResp[index]; ok && settings.Settings != nil {
+		if indexSettings, ok := settings.Settings["index"].(map[string]interface{}); ok {
+			copied := map[string]interface{}{}
+			for key, val := range indexSettings {
+				copied[key] = val
+			}
+			for _, key := range uncopyableIndexSettings {
+				delete(copied, key)
+			}
+			body["settings"] = map[string]interface{}{"index": copied}
+		}
+	}
+
+	if indexMapping, ok := mappingResp[index].(map[string]interface{}); ok && indexMapping["mappings"] != nil {
+		body["mappings"] = indexMapping["mappings"]
+	}
+
+	return body, nil
+}
+
+// deleteRotatedIndex deletes the new index of a failed rotation using a fresh context, such that it is
+// deleted even when the rotation failed because its context is done
+func deleteRotatedIndex(client *elastic.Client, index string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*time.Duration(defaultElasticsearchRotateCleanupTimeoutMillis))
+	defer cancel()
+
+	if _, err := client.DeleteIndex(index).Do(ctx); err != nil {
+		log.Warningf("failed to delete elasticsearch index %s after failed rotation; %s", index, err.Error())
+	}
+}
+
+// Rollover rolls the given alias over to a new index when any of the given conditions (i.e., max_docs,
+// max_size or max_age) is met, or unconditionally when none are given; whether a rollover occurred is
+// indicated by the RolledOver field of the returned response
+func Rollover(ctx context.Context, alias string, conditions map[string]interface{}) (*elastic.IndicesRolloverResponse, error) {
+	client, err := GetClient()
+	if err != nil {
+		return nil, err
+	}
+
+	svc := client.RolloverIndex(alias)
+	if len(conditions) > 0 {
+		svc.Conditions(conditions)
+	}
+
+	response, err := svc.Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to roll over elasticsearch alias %s; %w", alias, err)
+	}
+
+	if response.RolledOver {
+		log.Debugf("rolled over elasticsearch alias %s from %s to %s", alias, response.OldIndex, response.NewIndex)
+	}
+
+	return response, nil
+}
+
+// Refresh refreshes the given index, making all operations performed on it visible to search
+func Refresh(ctx context.Context, index string) error {
+	client, err := GetClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Refresh(index).Do(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to refresh elasticsearch index %s; %w", index, err)
+	}
+
+	return nil
+}
+
+// DisableRefresh disables periodic refresh of the given index, i.e., to speed up a large load
+func DisableRefresh(ctx context.Context, index string) error {
+	client, err := GetClient()
+	if err != nil {
+		return err
+	}
+
+	return putRefreshInterval(ctx, client, index, "-1")
+}
+
+// EnableRefresh restores the default periodic refresh of the given index after DisableRefresh
+func EnableRefresh(ctx context.Context, index string) error {
+	client, err := GetClient()
+	if err != nil {
+		return err
+	}
+
+	return putRefreshInterval(ctx, client, index, nil)
+}
+
+// getRefreshInterval returns the refresh interval explicitly set on the given index, or nil when the
+// index uses the default; an alias or data stream resolves to its concrete indices, which must agree
+func getRefreshInterval(ctx context.Context, client *elastic.Client, index string) (interface{}, error) {
+	resp, err := client.IndexGetSettings(index).Name("index.refresh_interval").Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refresh interval of elasticsearch index %s; %w", index, err)
+	}
+
+	// keyed by concrete index name rather than the given name
+	var interval interface{}
+	resolved := false
+	for name, settings := range resp {
+		var current interface{}
+		if settings != nil && settings.Settings != nil {
+			indexSettings, _ := settings.Settings["index"].(map[string]interface{})
+			current = indexSettings["refresh_interval"]
+		}
+
+		if resolved && current != interval {
+			return nil, fmt.Errorf("failed to get refresh interval of elasticsearch index %s; index %s has refresh interval %v rather than %v", index, name, current, interval)
+		}
+		interval = current
+		resolved = true
+	}
+
+	return interval, nil
+}
+
+// putRefreshInterval sets the refresh interval of the given index; nil restores the default
+func putRefreshInterval(ctx context.Context, client *elastic.Client, index string, interval interface{}) error {
+	_, err := client.IndexPutSettings(index).BodyJson(map[string]interface{}{
+		"index": map[string]interface{}{
+			"refresh_interval": interval,
+		},
+	}).Do(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to set refresh interval of elasticsearch index %s; %w", index, err)
+	}
+
+	log.Debugf("set refresh interval of elasticsearch index %s to %v", index, interval)
+	return nil
+}
+
+// ForceMerge merges the segments of the given index down to at most maxSegments segments per shard
+// (i.e., after a large load), or to the default of an optimal number of segments when zero
+func ForceMerge(ctx context.Context, index string, maxSegments int) error {
+	return forceMerge(ctx, index, maxSegments, false)
+}
+
+// ForceMergeExpungeDeletes merges only the segments of the given index containing deleted documents,
+// reclaiming the space of those documents
+func ForceMergeExpungeDeletes(ctx context.Context, index string) error {
+	return forceMerge(ctx, index, 0, true)
+}
+
+func forceMerge(ctx context.Context, index string, maxSegments int, onlyExpungeDeletes bool) error {
+	client, err := GetClient()
+	if err != nil {
+		return err
+	}
+
+	if maxSegments < 0 {
+		return fmt.Errorf("failed to force merge elasticsearch index %s; max segments must not be negative", index)
+	}
+
+	svc := client.Forcemerge(index)
+	if maxSegments > 0 {
+		svc.MaxNumSegments(maxSegments)
+	}
+	if onlyExpungeDeletes {
+		svc.OnlyExpungeDeletes(true)
+	}
+
+	_, err = svc.Do(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to force merge elasticsearch index %s; %w", index, err)
+	}
+
+	log.Debugf("force merged elasticsearch index %s", index)
+	return nil
+}
@@ -0,0 +1,316 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/olivere/elastic/v7"
+)
+
+func TestGetMappingReturnsMappingsByIndex(t *testing.T) {
+	_, restore := useStubClient(t, func(req *stubRequest) (int, string) {
+		if req.Method == http.MethodGet && strings.HasPrefix(req.Path, "/logs-*/_mapping") {
+			return http.StatusOK, `{
+				"logs-1": {"mappings": {"properties": {"message": {"type": "text"}}}},
+				"logs-2": {"mappings": {"properties": {"level": {"type": "keyword"}}}}
+			}`
+		}
+		return http.StatusNotFound, `{}`
+	})
+	defer restore()
+
+	mappings, err := GetMapping(context.Background(), "logs-*")
+	if err != nil {
+		t.Fatalf("failed to get mapping; %s", err.Error())
+	}
+
+	if len(mappings) != 2 {
+		t.Fatalf("expected mappings of 2 indices; got %d", len(mappings))
+	}
+	expected := map[string]interface{}{
+		"properties": map[string]interface{}{
+			"level": map[string]interface{}{"type": "keyword"},
+		},
+	}
+	if !reflect.DeepEqual(mappings["logs-2"], expected) {
+		t.Errorf("expected mapping %v; got %v", expected, mappings["logs-2"])
+	}
+}
+
+func TestGetMappingWithoutClient(t *testing.T) {
+	clients := elasticClients
+	elasticClients = nil
+	defer func() { elasticClients = clients }()
+
+	if _, err := GetMapping(context.Background(), "logs"); !errors.Is(err, ErrNoClient) {
+		t.Errorf("expected ErrNoClient; got %v", err)
+	}
+}
+
+func TestPutMappingSendsProperties(t *testing.T) {
+	transport, restore := useStubClient(t, func(req *stubRequest) (int, string) {
+		return http.StatusOK, `{"acknowledged":true}`
+	})
+	defer restore()
+
+	properties := map[string]interface{}{
+		"level": map[string]interface{}{"type": "keyword"},
+	}
+	if err := PutMapping(context.Background(), "logs", properties); err != nil {
+		t.Fatalf("failed to put mapping; %s", err.Error())
+	}
+
+	reqs := transport.find(http.MethodPut, "/logs/_mapping")
+	if len(reqs) != 1 {
+		t.Fatalf("expected 1 put mapping request; got %d", len(reqs))
+	}
+
+	var body map[string]interface{}
+	if err := jsonCodec.Unmarshal(reqs[0].Body, &body); err != nil {
+		t.Fatalf("failed to parse put mapping body; %s", err.Error())
+	}
+	if !reflect.DeepEqual(body, map[string]interface{}{"properties": properties}) {
+		t.Errorf("expected properties to be sent; got %v", body)
+	}
+}
+
+func TestPutMappingWrapsConflicts(t *testing.T) {
+	_, restore := useStubClient(t, func(req *stubRequest) (int, string) {
+		return http.StatusBadRequest, `{"error":{"type":"illegal_argument_exception","reason":"mapper [level] cannot be changed from type [keyword] to [text]"},"status":400}`
+	})
+	defer restore()
+
+	err := PutMapping(context.Background(), "logs", map[string]interface{}{
+		"level": map[string]interface{}{"type": "text"},
+	})
+
+	var esErr *elastic.Error
+	if !errors.As(err, &esErr) || esErr.Status != http.StatusBadRequest {
+		t.Fatalf("expected wrapped *elastic.Error; got %v", err)
+	}
+	if !strings.Contains(err.Error(), "illegal_argument_exception") {
+		t.Errorf("expected error to describe the conflict; got %s", err.Error())
+	}
+}
+
+// listIndicesHandler returns a handler listing the given indices, of which the given hidden indices set index.hidden
+func listIndicesHandler(indices []string, hidden []string) stubHandler {
+	return func(req *stubRequest) (int, string) {
+		switch {
+		case strings.HasPrefix(req.Path, "/_cat/indices"):
+			rows := make([]map[string]string, 0, len(indices))
+			for _, index := range indices {
+				rows = append(rows, map[string]string{"index": index})
+			}
+			body, _ := jsonCodec.Marshal(rows)
+			return http.StatusOK, string(body)
+		case strings.Contains(req.Path, "/_settings"):
+			settings := map[string]interface{}{}
+			for _, index := range indices {
+				settings[index] = map[string]interface{}{"settings": map[string]interface{}{}}
+			}
+			for _, index := range hidden {
+				settings[index] = map[string]interface{}{"settings": map[string]interface{}{"index.hidden": "true"}}
+			}
+			body, _ := jsonCodec.Marshal(settings)
+			return http.StatusOK, string(body)
+		}
+		return http.StatusNotFound, `{}`
+	}
+}
+
+func TestListIndicesOmitsHiddenAndSystemIndices(t *testing.T) {
+	transport, restore := useStubClient(t, listIndicesHandler([]string{".kibana", "logs-1", "logs-hidden", "metrics"}, []string{"logs-hidden"}))
+	defer restore()
+
+	indices, err := ListIndices(context.Background(), "")
+	if err != nil {
+		t.Fatalf("failed to list indices; %s", err.Error())
+	}
+
+	if !reflect.DeepEqual(indices, []string{"logs-1", "metrics"}) {
+		t.Errorf("expected visible indices only; got %v", indices)
+	}
+
+	settingsReqs := transport.find(http.MethodGet, "/_settings/index.hidden")
+	if len(settingsReqs) != 1 || settingsReqs[0].Query.Get("expand_wildcards") != "all" {
+		t.Errorf("expected the hidden setting of every index to be requested")
+	}
+}
+
+func TestListAllIndicesIncludesHiddenAndSystemIndices(t *testing.T) {
+	transport, restore := useStubClient(t, listIndicesHandler([]string{".kibana", "logs-1", "logs-hidden"}, []string{"logs-hidden"}))
+	defer restore()
+
+	indices, err := ListAllIndices(context.Background(), "")
+	if err != nil {
+		t.Fatalf("failed to list indices; %s", err.Error())
+	}
+
+	if !reflect.DeepEqual(indices, []string{".kibana", "logs-1", "logs-hidden"}) {
+		t.Errorf("expected every index; got %v", indices)
+	}
+	if len(transport.find(http.MethodGet, "/_settings/index.hidden")) != 0 {
+		t.Errorf("expected no settings request when including hidden indices")
+	}
+}
+
+func TestListIndicesMatchesPattern(t *testing.T) {
+	transport, restore := useStubClient(t, listIndicesHandler([]string{"logs-1"}, nil))
+	defer restore()
+
+	if _, err := ListIndices(context.Background(), "logs-*"); err != nil {
+		t.Fatalf("failed to list indices; %s", err.Error())
+	}
+
+	if len(transport.find(http.MethodGet, "/_cat/indices/logs-*")) != 1 {
+		t.Errorf("expected indices matching the pattern to be listed")
+	}
+}
+
+// rotateIndexHandler returns a handler resolving the logs alias to the logs-1 index, responding to
+// reindex requests with the given response body
+func rotateIndexHandler(reindexResponse string) stubHandler {
+	return func(req *stubRequest) (int, string) {
+		switch {
+		case req.Method == http.MethodGet && strings.Contains(req.Path, "/_alias"):
+			return http.StatusOK, `{"logs-1":{"aliases":{"logs":{}}}}`
+		case req.Method == http.MethodGet && strings.HasPrefix(req.Path, "/logs-1/_settings"):
+			return http.StatusOK, `{"logs-1":{"settings":{"index":{"number_of_shards":"3","refresh_interval":"5s","uuid":"abc","creation_date":"1","provided_name":"logs-1","version":{"created":"7100099"}}}}}`
+		case req.Method == http.MethodGet && strings.HasPrefix(req.Path, "/logs-1/_mapping"):
+			return http.StatusOK, `{"logs-1":{"mappings":{"properties":{"level":{"type":"keyword"}}}}}`
+		case req.Method == http.MethodPost && req.Path == "/_reindex":
+			return http.StatusOK, reindexResponse
+		}
+		return http.StatusOK, `{"acknowledged":true}`
+	}
+}
+
+func TestRotateIndexCopiesSourceMappingsAndSettings(t *testing.T) {
+	transport, restore := useStubClient(t, rotateIndexHandler(`{"created":2,"failures":[]}`))
+	defer restore()
+
+	if err := RotateIndex(context.Background(), "logs", "logs-2", nil); err != nil {
+		t.Fatalf("failed to rotate index; %s", err.Error())
+	}
+
+	creates := transport.find(http.MethodPut, "/logs-2")
+	if len(creates) != 1 {
+		t.Fatalf("expected 1 create index request; got %d", len(creates))
+	}
+
+	var body map[string]map[string]interface{}
+	if err := jsonCodec.Unmarshal(creates[0].Body, &body); err != nil {
+		t.Fatalf("failed to parse create index body; %s", err.Error())
+	}
+	expectedSettings := map[string]interface{}{
+		"index": map[string]interface{}{"number_of_shards": "3", "refresh_interval": "5s"},
+	}
+	if !reflect.DeepEqual(body["settings"], expectedSettings) {
+		t.Errorf("expected copyable settings %v; got %v", expectedSettings, body["settings"])
+	}
+	if _, ok := body["mappings"]["properties"]; !ok {
+		t.Errorf("expected mappings to be copied; got %v", body["mappings"])
+	}
+
+	if len(transport.find(http.MethodPost, "/_aliases")) != 1 {
+		t.Errorf("expected the alias to be swapped")
+	}
+	if len(transport.find(http.MethodDelete, "/logs-1")) != 1 {
+		t.Errorf("expected the previous index to be deleted")
+	}
+}
+
+func TestRotateIndexDeletesNewIndexWhenReindexFails(t *testing.T) {
+	transport, restore := useStubClient(t, rotateIndexHandler(`{"created":1,"failures":[{"index":"logs-2","id":"2","cause":{"type":"mapper_parsing_exception","reason":"failed to parse"},"status":400}]}`))
+	defer restore()
+
+	if err := RotateIndexRetainingPrevious(context.Background(), "logs", "logs-2", nil); err == nil {
+		t.Fatalf("expected the failed reindex to be returned as an error")
+	}
+
+	if len(transport.find(http.MethodDelete, "/logs-2")) != 1 {
+		t.Errorf("expected the new index to be deleted")
+	}
+	if len(transport.find(http.MethodPost, "/_aliases")) != 0 || len(transport.find(http.MethodDelete, "/logs-1")) != 0 {
+		t.Errorf("expected the alias and previous index to be left untouched")
+	}
+}
+
+func TestRolloverSendsConditions(t *testing.T) {
+	transport, restore := useStubClient(t, func(req *stubRequest) (int, string) {
+		if req.Method == http.MethodPost && req.Path == "/logs/_rollover" {
+			return http.StatusOK, `{"old_index":"logs-000001","new_index":"logs-000002","rolled_over":true,"dry_run":false,"acknowledged":true,"conditions":{"[max_docs: 1000]":true}}`
+		}
+		return http.StatusNotFound, `{}`
+	})
+	defer restore()
+
+	response, err := Rollover(context.Background(), "logs", map[string]interface{}{"max_docs": 1000})
+	if err != nil {
+		t.Fatalf("failed to roll over alias; %s", err.Error())
+	}
+	if !response.RolledOver || response.NewIndex != "logs-000002" {
+		t.Errorf("expected the alias to be rolled over to logs-000002; got %+v", response)
+	}
+
+	var body map[string]map[string]interface{}
+	if err := jsonCodec.Unmarshal(transport.find(http.MethodPost, "/logs/_rollover")[0].Body, &body); err != nil {
+		t.Fatalf("failed to parse rollover body; %s", err.Error())
+	}
+	if body["conditions"]["max_docs"] != float64(1000) {
+		t.Errorf("expected the conditions to be sent; got %v", body)
+	}
+}
+
+func TestRolloverWrapsErrors(t *testing.T) {
+	_, restore := useStubClient(t, func(req *stubRequest) (int, string) {
+		return http.StatusBadRequest, `{"error":{"type":"illegal_argument_exception","reason":"source alias does not exist"},"status":400}`
+	})
+	defer restore()
+
+	_, err := Rollover(context.Background(), "logs", nil)
+	var esErr *elastic.Error
+	if !errors.As(err, &esErr) || esErr.Status != http.StatusBadRequest {
+		t.Errorf("expected wrapped *elastic.Error; got %v", err)
+	}
+}
+
+func TestForceMerge(t *testing.T) {
+	transport, restore := useStubClient(t, func(req *stubRequest) (int, string) {
+		return http.StatusOK, `{"_shards":{"total":1,"successful":1,"failed":0}}`
+	})
+	defer restore()
+
+	if err := ForceMerge(context.Background(), "logs", 1); err != nil {
+		t.Fatalf("failed to force merge; %s", err.Error())
+	}
+	if err := ForceMerge(context.Background(), "logs", 0); err != nil {
+		t.Fatalf("failed to force merge; %s", err.Error())
+	}
+	if err := ForceMergeExpungeDeletes(context.Background(), "logs"); err != nil {
+		t.Fatalf("failed to force merge; %s", err.Error())
+	}
+
+	reqs := transport.find(http.MethodPost, "/logs/_forcemerge")
+	if len(reqs) != 3 {
+		t.Fatalf("expected 3 force merge requests; got %d", len(reqs))
+	}
+	if reqs[0].Query.Get("max_num_segments") != "1" {
+		t.Errorf("expected max segments to be sent; got %v", reqs[0].Query)
+	}
+	if _, ok := reqs[1].Query["max_num_segments"]; ok {
+		t.Errorf("expected no max segments for the default; got %v", reqs[1].Query)
+	}
+	if reqs[2].Query.Get("only_expunge_deletes") != "true" {
+		t.Errorf("expected only_expunge_deletes to be sent; got %v", reqs[2].Query)
+	}
+
+	if err := ForceMerge(context.Background(), "logs", -1); err == nil {
+		t.Errorf("expected negative max segments to be rejected")
+	}
+}
@@ -0,0 +1,31 @@
+package elasticsearchutil
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// jitterRand is seeded per process such that indexers across processes do not share a jitter sequence
+var jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+var jitterRandMutex sync.Mutex
+
+// flushInterval returns the max batch interval, randomized within the configured jitter fraction
+// of the interval such that the flushes of many indexers started together do not synchronize
+func (indexer *Indexer) flushInterval() time.Duration {
+	if indexer.flushJitter <= 0 {
+		return indexer.maxBatchInterval
+	}
+
+	jitterRandMutex.Lock()
+	r := jitterRand.Float64()
+	jitterRandMutex.Unlock()
+
+	// uniformly distributed within [interval - jitter, interval + jitter)
+	jitter := float64(indexer.maxBatchInterval) * indexer.flushJitter
+	interval := time.Duration(float64(indexer.maxBatchInterval) - jitter + r*2*jitter)
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	return interval
+}
@@ -0,0 +1,40 @@
+package elasticsearchutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFlushIntervalIsJitteredWithinFraction(t *testing.T) {
+	indexer, _ := newStubIndexer(t, nil, WithFlushThresholds(0, 0, time.Second), WithFlushJitter(0.2))
+
+	intervals := make(map[time.Duration]bool)
+	for i := 0; i < 100; i++ {
+		interval := indexer.flushInterval()
+		if interval < 800*time.Millisecond || interval >= 1200*time.Millisecond {
+			t.Fatalf("expected the interval to be within 20%% of 1s; got %v", interval)
+		}
+		intervals[interval] = true
+	}
+	if len(intervals) < 2 {
+		t.Errorf("expected the interval to be randomized; got %v", intervals)
+	}
+}
+
+func TestFlushIntervalIsUnjitteredByDefault(t *testing.T) {
+	indexer, _ := newStubIndexer(t, nil, WithFlushThresholds(0, 0, time.Second))
+	if interval := indexer.flushInterval(); interval != time.Second {
+		t.Errorf("expected the max batch interval; got %v", interval)
+	}
+}
+
+func TestWithFlushJitterValidatesFraction(t *testing.T) {
+	for _, fraction := range []float64{-0.1, 1, 1.5} {
+		if _, err := newIndexer(nil, "", WithFlushJitter(fraction)); err == nil {
+			t.Errorf("expected flush jitter %v to be rejected", fraction)
+		}
+	}
+	if _, err := newIndexer(nil, "", WithFlushJitter(0)); err != nil {
+		t.Errorf("expected zero flush jitter to be accepted; got %s", err.Error())
+	}
+}
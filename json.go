@@ -0,0 +1,40 @@
+package elasticsearchutil
+
+import (
+	"encoding/json"
+)
+
+// JSONCodec marshals, unmarshals and validates the json documents handled by this package;
+// a faster implementation (i.e., jsoniter or sonic) may be provided via SetJSONCodec
+type JSONCodec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+	Valid(data []byte) bool
+}
+
+// stdJSONCodec is the default JSONCodec, backed by encoding/json
+type stdJSONCodec struct{}
+
+func (stdJSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (stdJSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (stdJSONCodec) Valid(data []byte) bool {
+	return json.Valid(data)
+}
+
+// jsonCodec is the JSONCodec used wherever this package parses or produces json
+var jsonCodec JSONCodec = stdJSONCodec{}
+
+// SetJSONCodec replaces the codec used wherever this package parses or produces json; passing
+// nil restores the encoding/json default. It should be called before any indexer is run.
+func SetJSONCodec(codec JSONCodec) {
+	if codec == nil {
+		codec = stdJSONCodec{}
+	}
+	jsonCodec = codec
+}
@@ -0,0 +1,81 @@
+package elasticsearchutil
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+// fakeCodec is a JSONCodec delegating to encoding/json, recording its use and rejecting payloads containing invalid as invalid json
+type fakeCodec struct {
+	stdJSONCodec
+	mutex     sync.Mutex
+	marshaled int
+	validated int
+	invalid   []byte
+}
+
+func (c *fakeCodec) Marshal(v interface{}) ([]byte, error) {
+	c.mutex.Lock()
+	c.marshaled++
+	c.mutex.Unlock()
+	return c.stdJSONCodec.Marshal(v)
+}
+
+func (c *fakeCodec) Valid(data []byte) bool {
+	c.mutex.Lock()
+	c.validated++
+	c.mutex.Unlock()
+	return !bytes.Contains(data, c.invalid) && c.stdJSONCodec.Valid(data)
+}
+
+// useCodec configures the given codec, returning a func restoring the default codec
+func useCodec(codec JSONCodec) func() {
+	SetJSONCodec(codec)
+	return func() { SetJSONCodec(nil) }
+}
+
+func TestIndexerValidatesPayloadsUsingConfiguredCodec(t *testing.T) {
+	codec := &fakeCodec{invalid: []byte("poison")}
+	restore := useCodec(codec)
+	defer restore()
+
+	indexer, transport := newStubIndexer(t, okBulkHandler(t))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	rejected := make(chan error, 1)
+	msg := testMessage("events", "1", `{"a":"poison"}`)
+	msg.Ack = func(err error) { rejected <- err }
+	if err := indexer.Q(msg); err != nil {
+		t.Fatalf("failed to enqueue message; %s", err.Error())
+	}
+	if err := indexer.QMap("events", stringOrNil("2"), map[string]interface{}{"a": 2}); err != nil {
+		t.Fatalf("failed to enqueue document; %s", err.Error())
+	}
+	waitIdle(t, indexer)
+
+	codec.mutex.Lock()
+	marshaled, validated := codec.marshaled, codec.validated
+	codec.mutex.Unlock()
+	if marshaled == 0 || validated < 2 {
+		t.Errorf("expected the configured codec to marshal and validate documents; %d marshaled, %d validated", marshaled, validated)
+	}
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 1 || commands[0].meta["_id"] != "2" {
+		t.Fatalf("expected only the valid document to be sent; got %d bulk actions", len(commands))
+	}
+	if err := <-rejected; err == nil {
+		t.Errorf("expected the invalid document to be rejected")
+	}
+}
+
+func TestSetJSONCodecNilRestoresDefault(t *testing.T) {
+	SetJSONCodec(&fakeCodec{})
+	SetJSONCodec(nil)
+
+	if _, ok := jsonCodec.(stdJSONCodec); !ok {
+		t.Errorf("expected the encoding/json codec to be restored; got %T", jsonCodec)
+	}
+}
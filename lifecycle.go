@@ -0,0 +1,157 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const defaultElasticsearchIndexerIdlePollIntervalMillis = 50
+
+// WaitIdle blocks until every message enqueued so far has been flushed, i.e., the queue and retry
+// buffer are empty, nothing remains buffered for the next bulk request and no flush is in progress,
+// or until the given context expires; unlike stopping the indexer, it continues to run afterward.
+// Messages which are dead-lettered or rejected are considered flushed.
+func (indexer *Indexer) WaitIdle(ctx context.Context) error {
+	ticker := time.NewTicker(time.Millisecond * time.Duration(defaultElasticsearchIndexerIdlePollIntervalMillis))
+	defer ticker.Stop()
+
+	for {
+		if indexer.idle() {
+			return nil
+		}
+
+		if atomic.LoadInt64(&indexer.bufferedActions) > 0 {
+			// request the run loop flush buffered actions rather than waiting on the flush interval
+			select {
+			case indexer.flushNow <- struct{}{}:
+			default:
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// idle returns true when every message enqueued has been indexed, rejected or dead-lettered
+func (indexer *Indexer) idle() bool {
+	return atomic.LoadInt64(&indexer.outstanding) == 0
+}
+
+// settle records that an enqueued message has been indexed, or rejected or dead-lettered for the given
+// reason, acknowledging its cursor, if any, and invoking its ack callback; the messages it superseded
+// by deduplication are settled with it
+func (indexer *Indexer) settle(msg *Message, reason error) {
+	indexer.acknowledge(msg)
+	if msg != nil && msg.Ack != nil {
+		msg.Ack(reason)
+	}
+	indexer.release(msg)
+	atomic.AddInt64(&indexer.outstanding, -1)
+
+	if msg != nil {
+		for _, superseded := range msg.superseded {
+			indexer.settle(superseded, reason)
+		}
+		msg.superseded = nil
+	}
+}
+
+// admit reserves the payload bytes of the given message against the configured max buffered bytes,
+// returning false if the reservation would exceed it; a message is always admitted when no bytes are
+// buffered, such that a message larger than the max is not denied indefinitely
+func (indexer *Indexer) admit(msg *Message) bool {
+	size := int64(len(msg.Payload))
+	if indexer.maxBufferedBytes > 0 {
+		buffered := atomic.AddInt64(&indexer.admittedBytes, size)
+		if buffered > indexer.maxBufferedBytes && buffered != size {
+			atomic.AddInt64(&indexer.admittedBytes, -size)
+			return false
+		}
+	}
+
+	msg.admittedBytes = int(size)
+	return true
+}
+
+// release releases the bytes reserved for the given message once it is settled
+func (indexer *Indexer) release(msg *Message) {
+	if msg == nil || msg.admittedBytes == 0 || indexer.maxBufferedBytes <= 0 {
+		return
+	}
+	atomic.AddInt64(&indexer.admittedBytes, -int64(msg.admittedBytes))
+	msg.admittedBytes = 0
+}
+
+// Drain stops accepting new messages, waits for every message already enqueued to be flushed and
+// then stops the indexer, returning once it has stopped or the given context expires; the report
+// lists the documents which failed or remained unflushed as of the time Drain returns
+func (indexer *Indexer) Drain(ctx context.Context) (*ShutdownReport, error) {
+	if !atomic.CompareAndSwapInt32(&indexer.draining, 0, 1) {
+		return nil, fmt.Errorf("failed to drain indexer (%v); %w", indexer.identifier, ErrStopped)
+	}
+
+	err := indexer.drain(ctx)
+	return indexer.shutdownReport(), err
+}
+
+func (indexer *Indexer) drain(ctx context.Context) error {
+	log.Debugf("draining indexer (%v)", indexer.identifier)
+	err := indexer.WaitIdle(ctx)
+	if err != nil {
+		log.Warningf("indexer (%v) stopping before drained; %d message(s) outstanding; %s", indexer.identifier, atomic.LoadInt64(&indexer.outstanding), err.Error())
+	}
+
+	// the shutdown signal is delivered even once the context has expired, such that the indexer
+	// still performs its final flush; only the wait for it to stop is bounded by the context
+	select {
+	case indexer.shutdown <- true:
+	case <-indexer.stopped:
+		return err
+	}
+
+	select {
+	case <-indexer.stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return err
+}
+
+// handleSignals drains the indexer, bounded by the shutdown flush timeout, upon SIGINT or SIGTERM;
+// the signal is then raised again with the handler removed so the process exits as it otherwise would
+func (indexer *Indexer) handleSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		defer signal.Stop(signals)
+
+		select {
+		case sig := <-signals:
+			log.Infof("indexer (%v) received %v; draining", indexer.identifier, sig)
+
+			ctx, cancel := context.WithTimeout(context.Background(), indexer.shutdownFlushTimeout)
+			defer cancel()
+			if report, _ := indexer.Drain(ctx); report != nil && len(report.Failed) > 0 {
+				log.Warningf("indexer (%v) failed to flush %d document(s) while draining", indexer.identifier, len(report.Failed))
+			}
+
+			signal.Stop(signals)
+			if proc, err := os.FindProcess(os.Getpid()); err != nil || proc.Signal(sig) != nil {
+				os.Exit(1)
+			}
+
+		case <-indexer.stopped:
+		}
+	}()
+}
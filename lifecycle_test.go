@@ -0,0 +1,184 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWaitIdleFlushesBufferedActionsWithoutWaitingOnInterval(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	for round := 1; round <= 2; round++ {
+		enqueueN(t, indexer, 1)
+
+		startedAt := time.Now()
+		waitIdle(t, indexer)
+		if elapsed := time.Since(startedAt); elapsed >= indexer.maxBatchInterval {
+			t.Errorf("expected buffered actions to be flushed before the %v flush interval; took %v", indexer.maxBatchInterval, elapsed)
+		}
+
+		// the indexer continues to run once idle
+		if reqs := len(transport.bulkRequests()); reqs != round {
+			t.Errorf("expected %d bulk requests; got %d", round, reqs)
+		}
+	}
+}
+
+func TestWaitIdleReturnsContextErrorWhileFlushInProgress(t *testing.T) {
+	handler := newBlockingBulkHandler(t)
+	indexer, _ := newStubIndexer(t, handler.handle)
+	stop := runIndexer(indexer)
+	defer stop()
+	defer close(handler.release)
+
+	enqueueN(t, indexer, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := indexer.WaitIdle(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded; got %v", err)
+	}
+}
+
+func TestWaitIdleCountsDeadLetteredMessagesAsFlushed(t *testing.T) {
+	indexer, _ := newStubIndexer(t, failingBulkHandler(t, http.StatusBadRequest, 1))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueN(t, indexer, 1)
+	waitIdle(t, indexer)
+
+	if stats := indexer.Stats(); stats.Indexed != 0 {
+		t.Errorf("expected the document not to be indexed; got %d indexed", stats.Indexed)
+	}
+}
+
+func TestDrainFlushesEnqueuedMessagesAndStops(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t))
+	runIndexer(indexer)
+
+	enqueueN(t, indexer, 3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), stubWaitTimeout)
+	defer cancel()
+	report, err := indexer.Drain(ctx)
+	if err != nil {
+		t.Fatalf("failed to drain indexer; %s", err.Error())
+	}
+	if len(report.Failed) != 0 {
+		t.Errorf("expected no failed documents; got %v", report.Failed)
+	}
+	if commands := sentCommands(t, transport); len(commands) != 3 {
+		t.Errorf("expected 3 bulk actions; got %d", len(commands))
+	}
+
+	select {
+	case <-indexer.stopped:
+	default:
+		t.Errorf("expected the indexer to be stopped once drained")
+	}
+	if err := indexer.Q(testMessage("events", "4", `{"a":1}`)); !errors.Is(err, ErrStopped) {
+		t.Errorf("expected ErrStopped enqueueing to a drained indexer; got %v", err)
+	}
+	if _, err := indexer.Drain(ctx); !errors.Is(err, ErrStopped) {
+		t.Errorf("expected ErrStopped draining a drained indexer; got %v", err)
+	}
+}
+
+func TestWithGracefulSignalsDrainsUponSIGTERM(t *testing.T) {
+	// registered before the signal is sent, such that the signal raised again once drained does not terminate the test
+	caught := make(chan os.Signal, 2)
+	signal.Notify(caught, syscall.SIGTERM)
+	defer signal.Stop(caught)
+
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithGracefulSignals())
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueN(t, indexer, 3)
+	waitFor(t, "messages to be buffered", func() bool { return atomic.LoadInt64(&indexer.bufferedActions) == 3 })
+
+	proc, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatalf("failed to find test process; %s", err.Error())
+	}
+	if err := proc.Signal(syscall.SIGTERM); err != nil {
+		t.Fatalf("failed to signal test process; %s", err.Error())
+	}
+
+	select {
+	case <-indexer.stopped:
+	case <-time.After(stubWaitTimeout):
+		t.Fatalf("expected the indexer to stop upon SIGTERM")
+	}
+	if commands := sentCommands(t, transport); len(commands) != 3 {
+		t.Errorf("expected the buffered documents to be flushed while draining; got %d bulk actions", len(commands))
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-caught:
+		case <-time.After(stubWaitTimeout):
+			t.Fatalf("expected SIGTERM to be raised again once drained")
+		}
+	}
+}
+
+func TestDrainReportsDocumentsFailingWhileDraining(t *testing.T) {
+	indexer, _ := newStubIndexer(t, rejectingBulkHandler(t, "1"))
+	runIndexer(indexer)
+
+	bufferN(t, indexer, 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), stubWaitTimeout)
+	defer cancel()
+	report, err := indexer.Drain(ctx)
+	if err != nil {
+		t.Fatalf("failed to drain indexer; %s", err.Error())
+	}
+	if len(report.Failed) != 1 {
+		t.Fatalf("expected the rejected document to be reported; got %v", report.Failed)
+	}
+	failure := report.Failed[0]
+	if failure.Index != "events" || failure.ID != "1" || !strings.Contains(failure.Reason, "failed to parse field [a]") {
+		t.Errorf("expected the failure of document 1 to be described; got %+v", failure)
+	}
+	if failure.Message == nil || string(failure.Message.Payload) != `{"a":1}` {
+		t.Errorf("expected the dead-lettered message to be retained; got %v", failure.Message)
+	}
+}
+
+func TestAckIsInvokedWithOutcomeOfMessage(t *testing.T) {
+	indexer, _ := newStubIndexer(t, rejectingBulkHandler(t, "2"))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	indexed, indexedAcks := ackedMessage("events", "1", `{"a":1}`)
+	rejected, rejectedAcks := ackedMessage("events", "2", `{"a":2}`)
+	enqueueAll(t, indexer, 2, indexed, rejected)
+
+	select {
+	case err := <-indexedAcks:
+		t.Fatalf("expected the message not to be acknowledged until flushed; got %v", err)
+	default:
+	}
+	waitIdle(t, indexer)
+
+	if err := <-indexedAcks; err != nil {
+		t.Errorf("expected the indexed message to be acknowledged with nil; got %s", err.Error())
+	}
+	var itemErr *BulkItemError
+	if err := <-rejectedAcks; !errors.As(err, &itemErr) || itemErr.ID != "2" || itemErr.Status != http.StatusBadRequest {
+		t.Errorf("expected the dead-lettered message to be acknowledged with its *BulkItemError; got %v", err)
+	}
+}
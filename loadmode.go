@@ -0,0 +1,63 @@
+package elasticsearchutil
+
+import (
+	"context"
+)
+
+// loadModeIndex tracks an index encountered in load mode
+type loadModeIndex struct {
+	disabled        bool
+	refreshInterval interface{} // set on the index prior to load mode; nil when the index used the default
+}
+
+// disableRefresh disables refresh of the given index the first time the indexer encounters it
+// while in load mode, tracking the index and its refresh interval so the interval is restored once
+// the indexer stops
+func (indexer *Indexer) disableRefresh(ctx context.Context, index string) {
+	if _, ok := indexer.loadModeIndices[index]; ok {
+		return
+	}
+
+	// tracked regardless of the outcome so a failure is not retried for every message
+	tracked := &loadModeIndex{}
+	indexer.loadModeIndices[index] = tracked
+
+	client := indexer.bulkClient()
+	if client == nil {
+		log.Warningf("indexer (%v) failed to disable refresh of index %s in load mode; %s", indexer.identifier, index, ErrNoClient.Error())
+		return
+	}
+
+	interval, err := getRefreshInterval(ctx, client, index)
+	if err == nil {
+		err = putRefreshInterval(ctx, client, index, "-1")
+	}
+	if err != nil {
+		log.Warningf("indexer (%v) failed to disable refresh of index %s in load mode; %s", indexer.identifier, index, err.Error())
+		return
+	}
+
+	tracked.disabled = true
+	tracked.refreshInterval = interval
+}
+
+// restoreRefresh restores the refresh interval of each index for which refresh was disabled in load mode
+func (indexer *Indexer) restoreRefresh(ctx context.Context) {
+	client := indexer.bulkClient()
+	for index, tracked := range indexer.loadModeIndices {
+		if !tracked.disabled {
+			continue
+		}
+
+		if client == nil {
+			log.Warningf("indexer (%v) failed to restore refresh of index %s after load mode; %s", indexer.identifier, index, ErrNoClient.Error())
+			continue
+		}
+
+		if err := putRefreshInterval(ctx, client, index, tracked.refreshInterval); err != nil {
+			log.Warningf("indexer (%v) failed to restore refresh of index %s after load mode; %s", indexer.identifier, index, err.Error())
+		}
+	}
+
+	indexer.loadModeIndices = map[string]*loadModeIndex{}
+}
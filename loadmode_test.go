@@ -0,0 +1,146 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// refreshSettingsHandler returns a handler acknowledging bulk and settings requests, responding to
+// requests for the refresh interval of each index with the given interval, if any
+func refreshSettingsHandler(t *testing.T, intervals map[string]string) stubHandler {
+	return func(req *stubRequest) (int, string) {
+		switch {
+		case strings.HasSuffix(req.Path, "/_bulk"):
+			return stubBulkResponse(t, req, nil)
+		case req.Method == http.MethodGet && strings.Contains(req.Path, "/_settings"):
+			index := strings.Split(strings.TrimPrefix(req.Path, "/"), "/")[0]
+			if interval, ok := intervals[index]; ok {
+				return http.StatusOK, `{"` + index + `":{"settings":{"index":{"refresh_interval":"` + interval + `"}}}}`
+			}
+			return http.StatusOK, `{"` + index + `":{"settings":{}}}`
+		case req.Method == http.MethodPut && strings.HasSuffix(req.Path, "/_settings"):
+			return http.StatusOK, `{"acknowledged":true}`
+		}
+		return http.StatusNotFound, `{}`
+	}
+}
+
+// refreshIntervals returns the refresh interval sent by each recorded settings request for the given index, in order
+func refreshIntervals(t *testing.T, transport *stubTransport, index string) []interface{} {
+	t.Helper()
+
+	intervals := make([]interface{}, 0)
+	for _, req := range transport.find(http.MethodPut, "/"+index+"/_settings") {
+		var body map[string]map[string]interface{}
+		if err := jsonCodec.Unmarshal(req.Body, &body); err != nil {
+			t.Fatalf("failed to parse settings body; %s", err.Error())
+		}
+		intervals = append(intervals, body["index"]["refresh_interval"])
+	}
+	return intervals
+}
+
+func TestWithLoadModeDisablesAndRestoresRefresh(t *testing.T) {
+	indexer, transport := newStubIndexer(t, refreshSettingsHandler(t, map[string]string{"events": "30s"}), WithLoadMode(true))
+	stop := runIndexer(indexer)
+
+	enqueueAll(t, indexer, 3,
+		testMessage("events", "1", `{"a":1}`),
+		testMessage("events", "2", `{"a":2}`),
+		testMessage("logs", "1", `{"a":1}`),
+	)
+	waitIdle(t, indexer)
+
+	if intervals := refreshIntervals(t, transport, "events"); len(intervals) != 1 || intervals[0] != "-1" {
+		t.Fatalf("expected refresh of events to be disabled once while loading; got %v", intervals)
+	}
+	stop()
+
+	if intervals := refreshIntervals(t, transport, "events"); len(intervals) != 2 || intervals[1] != "30s" {
+		t.Errorf("expected the refresh interval previously set on events to be restored; got %v", intervals)
+	}
+	if intervals := refreshIntervals(t, transport, "logs"); len(intervals) != 2 || intervals[0] != "-1" || intervals[1] != nil {
+		t.Errorf("expected the default refresh interval of logs to be restored; got %v", intervals)
+	}
+}
+
+func TestWithLoadModeRestoresRefreshOfAliases(t *testing.T) {
+	indexer, transport := newStubIndexer(t, func(req *stubRequest) (int, string) {
+		if req.Method == http.MethodGet && strings.Contains(req.Path, "/_settings") {
+			// keyed by the concrete index backing the alias
+			return http.StatusOK, `{"events-000001":{"settings":{"index":{"refresh_interval":"30s"}}}}`
+		}
+		return refreshSettingsHandler(t, nil)(req)
+	}, WithLoadMode(true))
+	stop := runIndexer(indexer)
+
+	enqueueAll(t, indexer, 1, testMessage("events", "1", `{"a":1}`))
+	waitIdle(t, indexer)
+	stop()
+
+	if intervals := refreshIntervals(t, transport, "events"); len(intervals) != 2 || intervals[0] != "-1" || intervals[1] != "30s" {
+		t.Errorf("expected the refresh interval of the index backing events to be restored; got %v", intervals)
+	}
+}
+
+func TestGetRefreshIntervalRejectsDisagreeingIndices(t *testing.T) {
+	client, _ := newStubClient(t, func(req *stubRequest) (int, string) {
+		return http.StatusOK, `{"events-000001":{"settings":{"index":{"refresh_interval":"30s"}}},"events-000002":{"settings":{}}}`
+	})
+
+	if _, err := getRefreshInterval(context.Background(), client, "events"); err == nil {
+		t.Errorf("expected differing refresh intervals of the indices backing events to be rejected")
+	}
+}
+
+func TestWithLoadModeSkipsIndicesWhoseRefreshIntervalIsUnavailable(t *testing.T) {
+	indexer, transport := newStubIndexer(t, func(req *stubRequest) (int, string) {
+		if req.Method == http.MethodGet {
+			return http.StatusForbidden, `{"error":{"type":"security_exception","reason":"unauthorized"},"status":403}`
+		}
+		return refreshSettingsHandler(t, nil)(req)
+	}, WithLoadMode(true))
+	stop := runIndexer(indexer)
+
+	enqueueAll(t, indexer, 2, testMessage("events", "1", `{"a":1}`), testMessage("events", "2", `{"a":2}`))
+	waitIdle(t, indexer)
+	stop()
+
+	if gets := transport.find(http.MethodGet, "/_settings/index.refresh_interval"); len(gets) != 1 {
+		t.Errorf("expected the failure not to be retried for every message; got %d settings requests", len(gets))
+	}
+	if intervals := refreshIntervals(t, transport, "events"); len(intervals) != 0 {
+		t.Errorf("expected refresh not to be disabled or restored; got %v", intervals)
+	}
+}
+
+func TestIndexerLeavesRefreshWithoutLoadMode(t *testing.T) {
+	indexer, transport := newStubIndexer(t, refreshSettingsHandler(t, nil))
+	stop := runIndexer(indexer)
+
+	enqueueAll(t, indexer, 1, testMessage("events", "1", `{"a":1}`))
+	waitIdle(t, indexer)
+	stop()
+
+	if intervals := refreshIntervals(t, transport, "events"); len(intervals) != 0 {
+		t.Errorf("expected refresh not to be modified; got %v", intervals)
+	}
+}
+
+func TestDisableAndEnableRefresh(t *testing.T) {
+	transport, restore := useStubClient(t, refreshSettingsHandler(t, nil))
+	defer restore()
+
+	if err := DisableRefresh(context.Background(), "events"); err != nil {
+		t.Fatalf("failed to disable refresh; %s", err.Error())
+	}
+	if err := EnableRefresh(context.Background(), "events"); err != nil {
+		t.Fatalf("failed to enable refresh; %s", err.Error())
+	}
+
+	if intervals := refreshIntervals(t, transport, "events"); len(intervals) != 2 || intervals[0] != "-1" || intervals[1] != nil {
+		t.Errorf("expected refresh to be disabled then reset to the default; got %v", intervals)
+	}
+}
@@ -0,0 +1,51 @@
+package elasticsearchutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// defaultElasticsearchIndexerMetaField is the top-level document field under which header metadata is merged
+const defaultElasticsearchIndexerMetaField = "meta"
+
+// mergeMeta returns the given json object payload with the given metadata merged into the object at the
+// given top-level field; when the document already contains the field, its keys are preserved except
+// those also present in the metadata, which take precedence
+func mergeMeta(payload []byte, field string, meta map[string]interface{}) ([]byte, error) {
+	if !strings.HasPrefix(strings.TrimSpace(string(payload)), "{") {
+		return nil, fmt.Errorf("metadata can only be merged into json object payloads")
+	}
+
+	var doc map[string]json.RawMessage
+	if err := jsonCodec.Unmarshal(payload, &doc); err != nil {
+		return nil, err
+	}
+
+	merged := map[string]interface{}{}
+	if existing, ok := doc[field]; ok && strings.TrimSpace(string(existing)) != "null" {
+		if !strings.HasPrefix(strings.TrimSpace(string(existing)), "{") {
+			return nil, fmt.Errorf("metadata field %s collides with a non-object field of the document", field)
+		}
+
+		var fields map[string]json.RawMessage
+		if err := jsonCodec.Unmarshal(existing, &fields); err != nil {
+			return nil, err
+		}
+		for key, val := range fields {
+			merged[key] = val
+		}
+	}
+
+	for key, val := range meta {
+		merged[key] = val
+	}
+
+	raw, err := jsonCodec.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	doc[field] = raw
+
+	return jsonCodec.Marshal(doc)
+}
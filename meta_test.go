@@ -0,0 +1,70 @@
+package elasticsearchutil
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMergeMetaPreservesExistingFields(t *testing.T) {
+	payload, err := mergeMeta([]byte(`{"a":1,"meta":{"source":"legacy","trace":"t-1"}}`), "meta", map[string]interface{}{"source": "billing"})
+	if err != nil {
+		t.Fatalf("failed to merge metadata; %s", err.Error())
+	}
+
+	var doc map[string]interface{}
+	if err := jsonCodec.Unmarshal(payload, &doc); err != nil {
+		t.Fatalf("failed to parse merged payload; %s", err.Error())
+	}
+	meta, _ := doc["meta"].(map[string]interface{})
+	if doc["a"] != float64(1) || meta["source"] != "billing" || meta["trace"] != "t-1" {
+		t.Errorf("expected the metadata to be merged over the existing meta field; got %s", payload)
+	}
+
+	if payload, err := mergeMeta([]byte(`{"a":1,"meta":null}`), "meta", map[string]interface{}{"source": "billing"}); err != nil || !strings.Contains(string(payload), `"meta":{"source":"billing"}`) {
+		t.Errorf("expected a null meta field to be replaced; got %s, %v", payload, err)
+	}
+}
+
+func TestMergeMetaRejectsIncompatiblePayloads(t *testing.T) {
+	meta := map[string]interface{}{"source": "billing"}
+	if _, err := mergeMeta([]byte(`[1,2]`), "meta", meta); err == nil {
+		t.Errorf("expected a payload which is not a json object to be rejected")
+	}
+	if _, err := mergeMeta([]byte(`{"meta":"scalar"}`), "meta", meta); err == nil || !strings.Contains(err.Error(), "collides with a non-object field") {
+		t.Errorf("expected a colliding non-object field to be rejected; got %v", err)
+	}
+}
+
+func TestIndexerMergesHeaderMetaUnderMetaField(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithMetaField("provenance"))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	msg := testMessage("events", "1", `{"a":1}`)
+	msg.Header.Meta = map[string]interface{}{"source": "billing"}
+	enqueueAll(t, indexer, 1, msg)
+	waitIdle(t, indexer)
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 1 {
+		t.Fatalf("expected 1 bulk action; got %d", len(commands))
+	}
+	var doc map[string]interface{}
+	if err := jsonCodec.Unmarshal(commands[0].source, &doc); err != nil {
+		t.Fatalf("failed to parse source; %s", err.Error())
+	}
+	if provenance, _ := doc["provenance"].(map[string]interface{}); provenance["source"] != "billing" || doc["a"] != float64(1) {
+		t.Errorf("expected the metadata to be merged under the configured field; got %s", commands[0].source)
+	}
+	if _, ok := doc["meta"]; ok {
+		t.Errorf("expected the default meta field not to be used; got %s", commands[0].source)
+	}
+}
+
+func TestWithMetaFieldValidatesField(t *testing.T) {
+	for _, field := range []string{"", "_meta"} {
+		if _, err := newIndexer(nil, "", WithMetaField(field)); err == nil {
+			t.Errorf("expected meta field %q to be rejected", field)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package elasticsearchutil
+
+import (
+	"time"
+)
+
+// defaultElasticsearchIndexerMinBatchMaxIntervals bounds the number of flush intervals a batch smaller
+// than the configured minimum batch size may be deferred before it is flushed regardless of its size,
+// unless a max document age is configured
+const defaultElasticsearchIndexerMinBatchMaxIntervals = 10
+
+// deferTimerFlush returns true if the timer flush of the current batch should be deferred to the next
+// interval, as it contains fewer than the configured minimum actions and has not yet reached its max age
+func (indexer *Indexer) deferTimerFlush() bool {
+	if indexer.minBatchActions <= 0 || len(indexer.pending) == 0 || len(indexer.pending) >= indexer.minBatchActions {
+		return false
+	}
+
+	maxAge := indexer.maxBatchInterval * time.Duration(defaultElasticsearchIndexerMinBatchMaxIntervals)
+	if indexer.maxDocumentAge > 0 {
+		maxAge = indexer.maxDocumentAge
+	}
+	return time.Since(indexer.batchStartedAt) < maxAge
+}
+
+// armMaxDocumentAgeTimer schedules the max document age check of a batch whose first action was just queued
+func (indexer *Indexer) armMaxDocumentAgeTimer() {
+	if indexer.maxDocumentAgeTimer != nil {
+		indexer.maxDocumentAgeTimer.Reset(indexer.maxDocumentAge)
+	}
+}
+
+// handleMaxDocumentAge flushes the current batch once its oldest document has been buffered for the configured
+// max document age; the timer may fire for a batch since flushed, in which case the check is rescheduled for
+// the batch queued in its place
+func (indexer *Indexer) handleMaxDocumentAge() {
+	if len(indexer.pending) == 0 {
+		return
+	}
+
+	if age := time.Since(indexer.batchStartedAt); age < indexer.maxDocumentAge {
+		indexer.maxDocumentAgeTimer.Reset(indexer.maxDocumentAge - age)
+		return
+	}
+
+	log.Debugf("indexer (%v) flushing %d action(s) buffered longer than configured max document age of %v", indexer.identifier, len(indexer.pending), indexer.maxDocumentAge)
+	indexer.dispatchFlush()
+}
@@ -0,0 +1,91 @@
+package elasticsearchutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWithMinBatchSizeDefersTimerFlushOfTinyBatches(t *testing.T) {
+	// the timer is disabled in favor of ticks sent by the test, each received only once the run loop has
+	// handled the previous tick; the max document age bounds deferral in place of the flush interval
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithFlushThresholds(0, 0, 0), WithMinBatchSize(3), WithMaxDocumentAge(time.Hour))
+	ticks := make(chan time.Time)
+	indexer.queueFlushC = ticks
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueAll(t, indexer, 1, testMessage("events", "0", `{"a":1}`))
+	ticks <- time.Now()
+	ticks <- time.Now()
+	if reqs := transport.bulkRequests(); len(reqs) != 0 {
+		t.Fatalf("expected the timer flush of the tiny batch to be deferred; got %d bulk requests", len(reqs))
+	}
+
+	enqueueAll(t, indexer, 3, testMessage("events", "1", `{"a":1}`), testMessage("events", "2", `{"a":1}`))
+	ticks <- time.Now()
+	waitFor(t, "batch to be flushed", func() bool { return len(transport.bulkRequests()) == 1 })
+	if commands := sentCommands(t, transport); len(commands) != 3 {
+		t.Errorf("expected the batch to be flushed once it reached the min batch size; got %d bulk actions", len(commands))
+	}
+}
+
+func TestDeferTimerFlushIsBoundedByMaxAge(t *testing.T) {
+	indexer, _ := newStubIndexer(t, nil, WithFlushThresholds(0, 0, time.Second), WithMinBatchSize(2))
+	if indexer.deferTimerFlush() {
+		t.Errorf("expected an empty batch not to be deferred")
+	}
+
+	indexer.pending = []*queuedAction{{msg: testMessage("events", "1", `{"a":1}`)}}
+	indexer.batchStartedAt = time.Now()
+	if !indexer.deferTimerFlush() {
+		t.Errorf("expected a batch below the min batch size to be deferred")
+	}
+
+	indexer.batchStartedAt = time.Now().Add(-10 * time.Second)
+	if indexer.deferTimerFlush() {
+		t.Errorf("expected a batch buffered for 10 flush intervals not to be deferred")
+	}
+
+	indexer.batchStartedAt = time.Now()
+	indexer.pending = append(indexer.pending, &queuedAction{msg: testMessage("events", "2", `{"a":1}`)})
+	if indexer.deferTimerFlush() {
+		t.Errorf("expected a batch reaching the min batch size not to be deferred")
+	}
+}
+
+func TestWithMinBatchSizeRejectsNegativeSize(t *testing.T) {
+	if _, err := newIndexer(nil, "", WithMinBatchSize(-1)); err == nil {
+		t.Errorf("expected negative min batch size to be rejected")
+	}
+}
+
+func TestWithMaxDocumentAgeFlushesAgedBatches(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithFlushThresholds(0, 0, 0), WithMaxDocumentAge(100*time.Millisecond))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	startedAt := time.Now()
+	enqueueN(t, indexer, 1)
+	waitFor(t, "aged batch to be flushed", func() bool { return len(transport.bulkRequests()) == 1 })
+	if elapsed := time.Since(startedAt); elapsed < 100*time.Millisecond {
+		t.Errorf("expected the batch to be flushed once its oldest document reached the max age; flushed after %v", elapsed)
+	}
+
+	// the timer is rearmed for each batch
+	enqueueN(t, indexer, 1)
+	waitFor(t, "aged batch to be flushed", func() bool { return len(transport.bulkRequests()) == 2 })
+}
+
+func TestWithMaxDocumentAgeBoundsDeferredTimerFlush(t *testing.T) {
+	indexer, _ := newStubIndexer(t, nil, WithFlushThresholds(0, 0, time.Second), WithMinBatchSize(2), WithMaxDocumentAge(time.Second))
+
+	indexer.pending = []*queuedAction{{msg: testMessage("events", "1", `{"a":1}`)}}
+	indexer.batchStartedAt = time.Now().Add(-2 * time.Second)
+	if indexer.deferTimerFlush() {
+		t.Errorf("expected a batch buffered for the max document age not to be deferred")
+	}
+
+	if _, err := newIndexer(nil, "", WithMaxDocumentAge(-time.Second)); err == nil {
+		t.Errorf("expected negative max document age to be rejected")
+	}
+}
@@ -0,0 +1,200 @@
+package elasticsearchutil
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	uuid "github.com/kthomas/go.uuid"
+	"github.com/olivere/elastic/v7"
+)
+
+const mockElasticsearchURL = "http://mock.elasticsearch.local:9200"
+
+// MockBulkAction is a bulk action recorded by a MockIndexer
+type MockBulkAction struct {
+	Op      string          `json:"op"`
+	Index   string          `json:"index"`
+	ID      string          `json:"id,omitempty"`
+	Routing string          `json:"routing,omitempty"`
+	Source  json.RawMessage `json:"source,omitempty"`
+}
+
+// MockIndexer is an `Indexer` which records bulk actions in memory rather than sending them to an
+// elasticsearch cluster, allowing producers to be unit tested without a live cluster. Because
+// MockIndexer embeds *Indexer, code which accepts an *Indexer can be handed mock.Indexer:
+//
+//	mock, err := elasticsearchutil.NewMockIndexer()
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	go mock.Run()
+//	producer := NewProducer(mock.Indexer)
+//	producer.Produce()
+//	mock.WaitIdle(ctx)
+//	actions := mock.Actions()
+type MockIndexer struct {
+	*Indexer
+	transport *mockTransport
+}
+
+// NewMockIndexer initializes a new `MockIndexer` with the given options; every bulk
+// action it sends succeeds and is recorded for retrieval via Actions. An error is
+// returned if any option is invalid
+func NewMockIndexer(opts ...IndexerOption) (*MockIndexer, error) {
+	transport := &mockTransport{
+		actions: make([]*MockBulkAction, 0),
+		mutex:   &sync.Mutex{},
+	}
+
+	client, err := elastic.NewClient(
+		elastic.SetHttpClient(&http.Client{Transport: &contentTypeTransport{transport: transport}}),
+		elastic.SetURL(mockElasticsearchURL),
+		elastic.SetSniff(false),
+		elastic.SetHealthcheck(false),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize mock elasticsearch client; %w", err)
+	}
+
+	indexer, err := newIndexer(client, "", opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize mock indexer; %w", err)
+	}
+
+	return &MockIndexer{
+		Indexer:   indexer,
+		transport: transport,
+	}, nil
+}
+
+// Actions returns the bulk actions recorded so far, in the order they were sent
+func (mock *MockIndexer) Actions() []*MockBulkAction {
+	mock.transport.mutex.Lock()
+	defer mock.transport.mutex.Unlock()
+
+	actions := make([]*MockBulkAction, len(mock.transport.actions))
+	copy(actions, mock.transport.actions)
+	return actions
+}
+
+// Reset discards the bulk actions recorded so far
+func (mock *MockIndexer) Reset() {
+	mock.transport.mutex.Lock()
+	defer mock.transport.mutex.Unlock()
+
+	mock.transport.actions = make([]*MockBulkAction, 0)
+}
+
+// mockTransport is an http.RoundTripper which records bulk actions and acknowledges every request
+type mockTransport struct {
+	actions []*MockBulkAction
+	mutex   *sync.Mutex
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *mockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.HasSuffix(req.URL.Path, "/_bulk") {
+		return t.response(req, http.StatusOK, []byte("{}")), nil
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := t.record(body)
+	if err != nil {
+		return t.response(req, http.StatusBadRequest, []byte(fmt.Sprintf(`{"error":{"type":"parse_exception","reason":%q},"status":400}`, err.Error()))), nil
+	}
+
+	response, err := jsonCodec.Marshal(map[string]interface{}{
+		"took":   0,
+		"errors": false,
+		"items":  items,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return t.response(req, http.StatusOK, response), nil
+}
+
+// record parses the given ndjson bulk request body, recording each of its actions
+// and returning the corresponding successful response items
+func (t *mockTransport) record(body []byte) ([]map[string]interface{}, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	items := make([]map[string]interface{}, 0)
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(body)+1)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var command map[string]map[string]interface{}
+		if err := jsonCodec.Unmarshal(line, &command); err != nil {
+			return nil, fmt.Errorf("failed to parse bulk action; %s", err.Error())
+		}
+
+		for op, meta := range command {
+			action := &MockBulkAction{Op: op}
+			action.Index, _ = meta["_index"].(string)
+			action.ID, _ = meta["_id"].(string)
+			action.Routing, _ = meta["routing"].(string)
+
+			if op != OpDelete {
+				if !scanner.Scan() {
+					return nil, fmt.Errorf("failed to parse bulk action; %s action missing source", op)
+				}
+				action.Source = append(json.RawMessage{}, scanner.Bytes()...)
+			}
+
+			if action.ID == "" {
+				id, _ := uuid.NewV4()
+				action.ID = id.String()
+			}
+
+			status := http.StatusOK
+			if op == OpCreate || op == OpIndex {
+				status = http.StatusCreated
+			}
+
+			t.actions = append(t.actions, action)
+			items = append(items, map[string]interface{}{
+				op: map[string]interface{}{
+					"_index": action.Index,
+					"_id":    action.ID,
+					"status": status,
+				},
+			})
+		}
+	}
+
+	return items, scanner.Err()
+}
+
+// response builds a json response to the given request
+func (t *mockTransport) response(req *http.Request, status int, body []byte) *http.Response {
+	return &http.Response{
+		StatusCode:    status,
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
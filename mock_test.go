@@ -0,0 +1,61 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMockIndexerRecordsBulkActions(t *testing.T) {
+	mock, err := NewMockIndexer()
+	if err != nil {
+		t.Fatalf("failed to initialize mock indexer; %s", err.Error())
+	}
+	mock.sleepInterval = time.Millisecond
+	go mock.Run()
+	defer mock.Stop()
+
+	routed := testMessage("orders", "1", `{"a":1}`)
+	routed.Header.Routing = stringOrNil("customer-1")
+	del := testMessage("events", "2", "")
+	del.Header.Op = stringOrNil(OpDelete)
+	for _, msg := range []*Message{routed, testMessage("events", "", `{"b":2}`), del} {
+		if err := mock.Q(msg); err != nil {
+			t.Fatalf("failed to enqueue message; %s", err.Error())
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), stubWaitTimeout)
+	defer cancel()
+	if err := mock.WaitIdle(ctx); err != nil {
+		t.Fatalf("mock indexer did not become idle; %s", err.Error())
+	}
+
+	actions := mock.Actions()
+	if len(actions) != 3 {
+		t.Fatalf("expected 3 recorded actions; got %d", len(actions))
+	}
+	if actions[0].Op != OpIndex || actions[0].Index != "orders" || actions[0].ID != "1" || actions[0].Routing != "customer-1" || string(actions[0].Source) != `{"a":1}` {
+		t.Errorf("expected the routed index action to be recorded; got %+v", actions[0])
+	}
+	if actions[1].ID == "" {
+		t.Errorf("expected an id to be generated for the action without one")
+	}
+	if actions[2].Op != OpDelete || actions[2].ID != "2" || actions[2].Source != nil {
+		t.Errorf("expected the delete action to be recorded without source; got %+v", actions[2])
+	}
+	if stats := mock.Stats(); stats.Indexed != 3 {
+		t.Errorf("expected every action to succeed; got %d indexed", stats.Indexed)
+	}
+
+	mock.Reset()
+	if len(mock.Actions()) != 0 {
+		t.Errorf("expected the recorded actions to be discarded")
+	}
+}
+
+func TestNewMockIndexerReturnsInvalidOptionErrors(t *testing.T) {
+	if _, err := NewMockIndexer(WithIDGenerator(nil)); err == nil {
+		t.Errorf("expected an invalid option to be returned as an error")
+	}
+}
@@ -0,0 +1,582 @@
+package elasticsearchutil
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IndexerOption configures an optional behavior of an `Indexer` instance
+type IndexerOption func(*Indexer) error
+
+// WithShutdownFlushTimeout bounds the final flush performed when the indexer is stopped,
+// ensuring shutdown completes even when the elasticsearch cluster is unresponsive
+func WithShutdownFlushTimeout(timeout time.Duration) IndexerOption {
+	return func(indexer *Indexer) error {
+		if timeout <= 0 {
+			return errors.New("shutdown flush timeout must be greater than zero")
+		}
+		indexer.shutdownFlushTimeout = timeout
+		return nil
+	}
+}
+
+// WithWaitForActiveShards requires the given number of active shard copies, i.e., "all" or a
+// positive integer, to acknowledge each bulk request before it is considered complete
+func WithWaitForActiveShards(value string) IndexerOption {
+	return func(indexer *Indexer) error {
+		if !strings.EqualFold(value, "all") {
+			shards, err := strconv.Atoi(value)
+			if err != nil || shards < 1 {
+				return fmt.Errorf("invalid wait_for_active_shards value %s; must be \"all\" or a positive integer", value)
+			}
+		}
+		indexer.waitForActiveShards = strings.ToLower(value)
+		return nil
+	}
+}
+
+// WithMaxRetries sets the number of times a document failing with a transient error is retried before it is dead-lettered
+func WithMaxRetries(retries int) IndexerOption {
+	return func(indexer *Indexer) error {
+		if retries < 0 {
+			return errors.New("max retries must not be negative")
+		}
+		indexer.maxRetries = retries
+		return nil
+	}
+}
+
+// WithRetryBufferSize sets the capacity of the buffer holding documents awaiting retry; documents
+// which do not fit in the retry buffer are dead-lettered
+func WithRetryBufferSize(size int) IndexerOption {
+	return func(indexer *Indexer) error {
+		if size < 1 {
+			return errors.New("retry buffer size must be greater than zero")
+		}
+		indexer.retryQ = make(chan *Message, size)
+		return nil
+	}
+}
+
+// WithRetryBackoff sets the backoff preceding the first retry of a document failing with a transient
+// error, which doubles with each subsequent retry up to the given max
+func WithRetryBackoff(initial, max time.Duration) IndexerOption {
+	return func(indexer *Indexer) error {
+		if initial < 0 || max < initial {
+			return errors.New("retry backoff must not be negative, nor exceed the max retry backoff")
+		}
+		indexer.retryBackoff = initial
+		indexer.maxRetryBackoff = max
+		return nil
+	}
+}
+
+// WithDeadLetterHandler sets the handler invoked with each document which could not be indexed; the
+// handler may be invoked concurrently when more than one flush worker is configured
+func WithDeadLetterHandler(handler DeadLetterHandler) IndexerOption {
+	return func(indexer *Indexer) error {
+		indexer.deadLetterHandler = handler
+		return nil
+	}
+}
+
+// WithFlushThresholds configures when queued actions are flushed: once the batch would reach the
+// given size in bytes, once it contains the given number of actions, or once the given interval
+// elapses, whichever comes first; a zero value disables the respective threshold
+func WithFlushThresholds(maxBatchSizeBytes, maxBatchActions int, maxBatchInterval time.Duration) IndexerOption {
+	return func(indexer *Indexer) error {
+		if maxBatchSizeBytes < 0 || maxBatchActions < 0 || maxBatchInterval < 0 {
+			return errors.New("flush thresholds must not be negative")
+		}
+		indexer.maxBatchSizeBytes = maxBatchSizeBytes
+		indexer.maxBatchActions = maxBatchActions
+		indexer.maxBatchInterval = maxBatchInterval
+		return nil
+	}
+}
+
+// WithAdaptiveBatchSize tunes the batch size in bytes within the given bounds from cluster feedback: the
+// size is halved when a bulk request is throttled (429) or exceeds the target latency, and grown by a
+// quarter when a request completes within half the target latency; the configured max batch size is
+// the initial size, clamped to the bounds
+func WithAdaptiveBatchSize(minBytes, maxBytes int, targetLatency time.Duration) IndexerOption {
+	return func(indexer *Indexer) error {
+		if minBytes <= 0 || maxBytes < minBytes {
+			return errors.New("adaptive batch size bounds must be positive, with max not less than min")
+		}
+		if targetLatency <= 0 {
+			return errors.New("adaptive batch size target latency must be positive")
+		}
+		indexer.adaptiveBatchSize = &adaptiveBatchSize{
+			minBytes:      int64(minBytes),
+			maxBytes:      int64(maxBytes),
+			targetLatency: targetLatency,
+		}
+		return nil
+	}
+}
+
+// WithMaxBufferedBytes bounds the memory consumed by messages enqueued but not yet settled (i.e., buffered,
+// in flight or awaiting retry) by their payload bytes, independent of the buffered channel size; Q returns
+// an error wrapping ErrQueueFull rather than enqueueing a message which would exceed it
+func WithMaxBufferedBytes(maxBytes int64) IndexerOption {
+	return func(indexer *Indexer) error {
+		if maxBytes < 0 {
+			return errors.New("max buffered bytes must not be negative")
+		}
+		indexer.maxBufferedBytes = maxBytes
+		return nil
+	}
+}
+
+// WithMaxActionsPerRequest flushes the queued actions once the batch contains the given number of
+// actions, independent of the byte size and interval thresholds; this is the action threshold of
+// WithFlushThresholds, which overrides it when provided after this option
+func WithMaxActionsPerRequest(maxActions int) IndexerOption {
+	return func(indexer *Indexer) error {
+		if maxActions <= 0 {
+			return errors.New("max actions per request must be positive")
+		}
+		indexer.maxBatchActions = maxActions
+		return nil
+	}
+}
+
+// WithFailureSpool appends each dead-lettered message as ndjson to the file at the given path, in addition
+// to handing it to the dead-letter handler, such that it can be replayed using ReplaySpool; the file is
+// rotated to <path>.1 once it reaches 64MB
+func WithFailureSpool(path string) IndexerOption {
+	return func(indexer *Indexer) error {
+		if path == "" {
+			return errors.New("failure spool path must not be empty")
+		}
+		indexer.failureSpool = newFailureSpool(path)
+		return nil
+	}
+}
+
+// WithAutoCreateIndex creates each target index with the given body (i.e., settings and mappings)
+// the first time a document is indexed to it, rather than relying on dynamic index creation
+func WithAutoCreateIndex(settings map[string]interface{}) IndexerOption {
+	return func(indexer *Indexer) error {
+		if settings == nil {
+			settings = map[string]interface{}{}
+		}
+		indexer.autoCreateIndex = settings
+		return nil
+	}
+}
+
+// WithMaxInFlightBytes caps the total size of the batches being sent concurrently by the flush
+// workers; once reached, flushing (and therefore indexing) blocks until capacity frees
+func WithMaxInFlightBytes(maxInFlightBytes int64) IndexerOption {
+	return func(indexer *Indexer) error {
+		if maxInFlightBytes < 1 {
+			return errors.New("max in-flight bytes must be greater than zero")
+		}
+		indexer.maxInFlightBytes = maxInFlightBytes
+		return nil
+	}
+}
+
+// WithResultHandler sets the handler invoked with each message sent in a bulk request along with
+// its response item; the handler may be invoked concurrently when more than one flush worker is configured
+func WithResultHandler(handler ResultHandler) IndexerOption {
+	return func(indexer *Indexer) error {
+		indexer.resultHandler = handler
+		return nil
+	}
+}
+
+// WithResponseRecorder sets the recorder invoked asynchronously with the full response of each successful
+// bulk request, such that persisting it (i.e., for auditing) does not block ingestion; stopping the indexer
+// waits for pending recordings to complete
+func WithResponseRecorder(recorder ResponseRecorder) IndexerOption {
+	return func(indexer *Indexer) error {
+		indexer.responseRecorder = recorder
+		return nil
+	}
+}
+
+// WithIndexPolicy restricts the ops permitted for indices matching the given pattern (i.e., `audit-*`);
+// the option may be provided more than once, in which case every matching policy must permit the op
+func WithIndexPolicy(pattern string, policy IndexPolicy) IndexerOption {
+	return func(indexer *Indexer) error {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid index policy pattern %s; %s", pattern, err.Error())
+		}
+		indexer.indexPolicies = append(indexer.indexPolicies, &indexPolicyRule{
+			pattern: pattern,
+			policy:  policy,
+		})
+		return nil
+	}
+}
+
+// WithIndexDenylist dead-letters messages targeting indices matching any of the given patterns,
+// i.e., `.*` to protect system indices from accidental writes
+func WithIndexDenylist(patterns []string) IndexerOption {
+	return func(indexer *Indexer) error {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid index denylist pattern %s; %s", pattern, err.Error())
+			}
+		}
+		indexer.indexDenylist = append(indexer.indexDenylist, patterns...)
+		return nil
+	}
+}
+
+// WithIndexAllowlist dead-letters messages targeting indices matching none of the given patterns,
+// restricting writes to an explicit set of indices; WithIndexDenylist takes precedence when both are configured
+func WithIndexAllowlist(patterns []string) IndexerOption {
+	return func(indexer *Indexer) error {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid index allowlist pattern %s; %s", pattern, err.Error())
+			}
+		}
+		if indexer.indexAllowlist == nil {
+			// non-nil even if empty, such that an empty allowlist permits no indices
+			indexer.indexAllowlist = make([]string, 0, len(patterns))
+		}
+		indexer.indexAllowlist = append(indexer.indexAllowlist, patterns...)
+		return nil
+	}
+}
+
+// WithPreprocessor appends a preprocessor applied to each message prior to building its bulk action;
+// preprocessors are applied in the order in which they are provided
+func WithPreprocessor(preprocessor Preprocessor) IndexerOption {
+	return func(indexer *Indexer) error {
+		if preprocessor == nil {
+			return errors.New("preprocessor must not be nil")
+		}
+		indexer.preprocessors = append(indexer.preprocessors, preprocessor)
+		return nil
+	}
+}
+
+// WithRoutingField derives the routing of each document lacking a header routing from the field at
+// the given dotted path of its payload (i.e., `tenant.id`); documents missing the field are not routed
+func WithRoutingField(path string) IndexerOption {
+	return func(indexer *Indexer) error {
+		if path == "" {
+			return errors.New("routing field must not be empty")
+		}
+		indexer.routingField = strings.Split(path, ".")
+		return nil
+	}
+}
+
+// WithCheckpointStore persists the checkpoint of acknowledged message cursors using the given store
+// rather than in memory, such that messages enqueued after a restart at or before the stored checkpoint
+// are skipped, and the source can be replayed from the checkpoint
+func WithCheckpointStore(store CheckpointStore) IndexerOption {
+	return func(indexer *Indexer) error {
+		if store == nil {
+			return errors.New("checkpoint store must not be nil")
+		}
+		indexer.checkpoints = newCheckpointTracker(store)
+		return nil
+	}
+}
+
+// WithTimeBasedIndex resolves messages targeting the given pattern, i.e., `logs-{2006.01.02}`, to the
+// dated index for the timestamp at the given dotted field of the payload, such that backfilled documents
+// are written to the index of their own date, formatted in utc using the go time layout enclosed in
+// braces; timestamps are rfc3339 strings or epoch milliseconds, and the current time is used when the
+// field is missing
+func WithTimeBasedIndex(field, pattern string) IndexerOption {
+	return func(indexer *Indexer) error {
+		if field == "" {
+			return errors.New("time-based index field must not be empty")
+		}
+		tbi, err := newTimeBasedIndex(field, pattern)
+		if err != nil {
+			return err
+		}
+		if indexer.timeBasedIndices == nil {
+			indexer.timeBasedIndices = map[string]*timeBasedIndex{}
+		}
+		indexer.timeBasedIndices[pattern] = tbi
+		return nil
+	}
+}
+
+// WithIndexSharding spreads documents targeting the given logical index across the given number of
+// physical indices, i.e., `base-0` through `base-{shards-1}`, selected by a hash of the document id;
+// searches should target the physical indices using a wildcard or an alias
+func WithIndexSharding(base string, shards int) IndexerOption {
+	return func(indexer *Indexer) error {
+		if base == "" {
+			return errors.New("sharded index must not be empty")
+		}
+		if shards < 1 {
+			return errors.New("index shards must be positive")
+		}
+		if indexer.indexShards == nil {
+			indexer.indexShards = map[string]int{}
+		}
+		indexer.indexShards[base] = shards
+		return nil
+	}
+}
+
+// WithMetaField merges the metadata provided in message headers into documents under the given
+// top-level field rather than meta; the field should be mapped as an object which is not indexed
+// (i.e., `"enabled": false`) if the metadata is only to be stored
+func WithMetaField(field string) IndexerOption {
+	return func(indexer *Indexer) error {
+		if field == "" {
+			return errors.New("meta field must not be empty")
+		}
+		if strings.HasPrefix(field, "_") {
+			return fmt.Errorf("invalid meta field %s; fields prefixed with _ are reserved by elasticsearch", field)
+		}
+		indexer.metaField = field
+		return nil
+	}
+}
+
+// WithIndexTimeout sets the timeout of bulk requests for indices matching the given pattern, in lieu
+// of ELASTICSEARCH_TIMEOUT, such that a slow index (i.e., `archive-*`) does not dictate the timeout of
+// others; documents for indices with differing timeouts are sent in separate bulk requests
+func WithIndexTimeout(pattern string, timeout time.Duration) IndexerOption {
+	return func(indexer *Indexer) error {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid index timeout pattern %s; %s", pattern, err.Error())
+		}
+		if timeout <= 0 {
+			return errors.New("index timeout must be positive")
+		}
+		indexer.indexTimeouts = append(indexer.indexTimeouts, &indexTimeoutRule{
+			pattern: pattern,
+			timeout: timeout,
+		})
+		return nil
+	}
+}
+
+// WithGracefulSignals drains the indexer upon SIGINT or SIGTERM, bounded by the shutdown flush
+// timeout, and then lets the signal terminate the process; it is opt-in as it installs signal
+// handlers which may interfere with those of the host application
+func WithGracefulSignals() IndexerOption {
+	return func(indexer *Indexer) error {
+		indexer.gracefulSignals = true
+		return nil
+	}
+}
+
+// WithStrictBulkErrors causes Flush and FlushIndex to return a *BulkErrors aggregating each failed
+// action when any action within a bulk request fails, even though the request itself succeeded
+func WithStrictBulkErrors() IndexerOption {
+	return func(indexer *Indexer) error {
+		indexer.strictBulkErrors = true
+		return nil
+	}
+}
+
+// WithRetryClassifier replaces DefaultRetryClassifier in deciding which failures are retried,
+// i.e., to retry 403 responses from a flaky proxy
+func WithRetryClassifier(classifier RetryClassifier) IndexerOption {
+	return func(indexer *Indexer) error {
+		if classifier == nil {
+			return errors.New("retry classifier must not be nil")
+		}
+		indexer.retryClassifier = classifier
+		return nil
+	}
+}
+
+// WithDeduplication collapses buffered index and delete ops targeting the same document (by index,
+// routing and id) into the latest op, reducing the number of actions sent in each bulk request
+func WithDeduplication() IndexerOption {
+	return func(indexer *Indexer) error {
+		indexer.dedupe = true
+		return nil
+	}
+}
+
+// WithIDGenerator assigns the id returned by the given generator to messages queued without an id,
+// in lieu of an id auto-generated by elasticsearch; see PayloadHashIDGenerator for idempotent ingestion
+func WithIDGenerator(generator IDGenerator) IndexerOption {
+	return func(indexer *Indexer) error {
+		if generator == nil {
+			return errors.New("id generator must not be nil")
+		}
+		indexer.idGenerator = generator
+		return nil
+	}
+}
+
+// WithFieldRedactor removes or masks the named fields of json object payloads prior to indexing,
+// i.e., to keep pii out of the index; nested fields are named using dotted paths (i.e., user.email)
+func WithFieldRedactor(fields []string, mode RedactionMode) IndexerOption {
+	return func(indexer *Indexer) error {
+		if mode != RedactRemove && mode != RedactMask {
+			return fmt.Errorf("invalid redaction mode %d", mode)
+		}
+
+		paths := make([][]string, 0, len(fields))
+		for _, field := range fields {
+			path := strings.Split(field, ".")
+			for _, part := range path {
+				if part == "" {
+					return fmt.Errorf("invalid redacted field %s", field)
+				}
+			}
+			paths = append(paths, path)
+		}
+
+		indexer.fieldRedactor = &fieldRedactor{
+			paths: paths,
+			mode:  mode,
+		}
+		return nil
+	}
+}
+
+// WithMaxDocumentBytes sets the max payload size of an individual document, which defaults to the
+// 100mb http.max_content_length default of elasticsearch; larger documents are dead-lettered rather
+// than failing the entire bulk request
+func WithMaxDocumentBytes(maxDocumentBytes int) IndexerOption {
+	return func(indexer *Indexer) error {
+		if maxDocumentBytes < 1 {
+			return errors.New("max document bytes must be positive")
+		}
+		indexer.maxDocumentBytes = maxDocumentBytes
+		return nil
+	}
+}
+
+// WithReadOnlyIndexAutoClear clears the read-only block elasticsearch applies to indices once the
+// flood-stage disk watermark is exceeded, retrying the affected documents; by default such documents
+// are dead-lettered with a *ReadOnlyIndexError so callers can alert on the condition
+func WithReadOnlyIndexAutoClear() IndexerOption {
+	return func(indexer *Indexer) error {
+		indexer.clearReadOnly = true
+		return nil
+	}
+}
+
+// WithLoadMode disables refresh of each index the first time the indexer encounters it, speeding up
+// large loads, and restores the default refresh interval of those indices once the indexer is drained or stopped
+func WithLoadMode(enabled bool) IndexerOption {
+	return func(indexer *Indexer) error {
+		indexer.loadMode = enabled
+		return nil
+	}
+}
+
+// WithRateLimit caps the rate of bulk requests sent by the indexer, i.e., to avoid overwhelming a
+// shared cluster; flushes exceeding the rate wait for capacity, during which documents remain queued
+func WithRateLimit(requestsPerSecond float64) IndexerOption {
+	return func(indexer *Indexer) error {
+		if requestsPerSecond <= 0 {
+			return errors.New("rate limit must be positive")
+		}
+		indexer.requestLimiter = newTokenBucket(requestsPerSecond)
+		return nil
+	}
+}
+
+// WithByteRateLimit caps the rate of bytes sent by the indexer, per the estimated size of each bulk
+// request; flushes wait until enough budget accrues, and a single request larger than the budget of
+// one second is sent once the full budget accrues. It may be combined with WithRateLimit, in which
+// case each flush waits to satisfy both limits.
+func WithByteRateLimit(bytesPerSecond int) IndexerOption {
+	return func(indexer *Indexer) error {
+		if bytesPerSecond < 1 {
+			return errors.New("byte rate limit must be positive")
+		}
+		indexer.byteLimiter = newTokenBucket(float64(bytesPerSecond))
+		return nil
+	}
+}
+
+// WithRequireAlias fails each index and create op unless its index is an alias (i.e., a write alias),
+// rather than implicitly creating a concrete index; see MessageHeader.RequireAlias to require it per message
+func WithRequireAlias() IndexerOption {
+	return func(indexer *Indexer) error {
+		indexer.requireAlias = true
+		return nil
+	}
+}
+
+// WithMinBatchSize defers the timer flush of batches containing fewer than the given number of actions
+// to the next flush interval, reducing the number of tiny bulk requests sent for low-traffic indices; a
+// deferred batch is flushed regardless of its size once it has been buffered for 10 flush intervals
+func WithMinBatchSize(minActions int) IndexerOption {
+	return func(indexer *Indexer) error {
+		if minActions < 0 {
+			return errors.New("min batch size must not be negative")
+		}
+		indexer.minBatchActions = minActions
+		return nil
+	}
+}
+
+// WithMaxDocumentAge flushes the current batch once its oldest document has been buffered for the given
+// duration, bounding worst-case latency regardless of the min batch size and flush interval
+func WithMaxDocumentAge(maxAge time.Duration) IndexerOption {
+	return func(indexer *Indexer) error {
+		if maxAge < 0 {
+			return errors.New("max document age must not be negative")
+		}
+		indexer.maxDocumentAge = maxAge
+		return nil
+	}
+}
+
+// WithHomogeneousBatches flushes the current batch whenever a message requests an op differing from
+// that of the batch, such that each bulk request contains a single op (i.e., only index or only delete
+// ops), simplifying failure handling; workloads which interleave ops will send more, smaller bulk
+// requests, reducing throughput
+func WithHomogeneousBatches() IndexerOption {
+	return func(indexer *Indexer) error {
+		indexer.homogeneousBatches = true
+		return nil
+	}
+}
+
+// WithBulkContentType overrides the application/x-ndjson content type of bulk requests, i.e., for
+// proxies which mishandle it; the override applies only to clients initialized by this package
+func WithBulkContentType(contentType string) IndexerOption {
+	return func(indexer *Indexer) error {
+		if contentType == "" {
+			return errors.New("bulk content type must not be empty")
+		}
+		indexer.bulkContentType = contentType
+		return nil
+	}
+}
+
+// WithFlushJitter randomizes each interval of the flush ticker within the given fraction (i.e., 0.1
+// for 10%) of the max batch interval, staggering the flushes of many indexers sharing an interval
+func WithFlushJitter(fraction float64) IndexerOption {
+	return func(indexer *Indexer) error {
+		if fraction < 0 || fraction >= 1 {
+			return errors.New("flush jitter must be a fraction within [0, 1)")
+		}
+		indexer.flushJitter = fraction
+		return nil
+	}
+}
+
+// WithDebugBodies retains the ndjson body of the most recent bulk request, truncated to the given
+// max bytes, for retrieval via LastBulkBody; it is intended for debugging, as the body is serialized
+// an additional time for each bulk request
+func WithDebugBodies(maxBytes int) IndexerOption {
+	return func(indexer *Indexer) error {
+		if maxBytes < 1 {
+			return errors.New("debug body max bytes must be positive")
+		}
+		indexer.debugBodyMaxBytes = maxBytes
+		return nil
+	}
+}
@@ -0,0 +1,338 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithWaitForActiveShardsSetsBulkParam(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithWaitForActiveShards("ALL"))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	if err := indexer.Q(testMessage("events", "1", `{"a":1}`)); err != nil {
+		t.Fatalf("failed to enqueue message; %s", err.Error())
+	}
+	waitIdle(t, indexer)
+
+	reqs := transport.bulkRequests()
+	if len(reqs) != 1 {
+		t.Fatalf("expected 1 bulk request; got %d", len(reqs))
+	}
+	if value := reqs[0].Query.Get("wait_for_active_shards"); value != "all" {
+		t.Errorf("expected wait_for_active_shards=all; got %q", value)
+	}
+}
+
+func TestWithWaitForActiveShardsRejectsInvalidValues(t *testing.T) {
+	for _, value := range []string{"0", "-1", "some", ""} {
+		if _, err := newIndexer(nil, "", WithWaitForActiveShards(value)); err == nil {
+			t.Errorf("expected wait_for_active_shards value %q to be rejected", value)
+		}
+	}
+
+	if _, err := newIndexer(nil, "", WithWaitForActiveShards("2")); err != nil {
+		t.Errorf("expected wait_for_active_shards value 2 to be accepted; %s", err.Error())
+	}
+}
+
+// enqueueN enqueues the given number of 7-byte documents to the given indexer
+func enqueueN(t *testing.T, indexer *Indexer, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := indexer.Q(testMessage("events", strconv.Itoa(i), `{"a":1}`)); err != nil {
+			t.Fatalf("failed to enqueue message; %s", err.Error())
+		}
+	}
+}
+
+func TestWithFlushThresholdsFlushesAtMaxBatchActions(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithFlushThresholds(0, 2, 0))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueN(t, indexer, 5)
+	waitFor(t, "2 bulk requests", func() bool { return len(transport.bulkRequests()) == 2 })
+	waitIdle(t, indexer)
+
+	reqs := transport.bulkRequests()
+	if len(reqs) != 3 {
+		t.Fatalf("expected 3 bulk requests; got %d", len(reqs))
+	}
+	for i, expected := range []int{2, 2, 1} {
+		if actions := len(parseBulkBody(t, reqs[i].Body)); actions != expected {
+			t.Errorf("expected bulk request %d to contain %d actions; got %d", i, expected, actions)
+		}
+	}
+}
+
+func TestWithMaxActionsPerRequestBoundsActionsPerBulkRequest(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithFlushThresholds(0, 0, 0), WithMaxActionsPerRequest(3))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueN(t, indexer, 7)
+	waitFor(t, "2 bulk requests", func() bool { return len(transport.bulkRequests()) == 2 })
+	waitIdle(t, indexer)
+
+	reqs := transport.bulkRequests()
+	if len(reqs) != 3 {
+		t.Fatalf("expected 3 bulk requests; got %d", len(reqs))
+	}
+	for i, expected := range []int{3, 3, 1} {
+		if actions := len(parseBulkBody(t, reqs[i].Body)); actions != expected {
+			t.Errorf("expected bulk request %d to contain %d actions; got %d", i, expected, actions)
+		}
+	}
+}
+
+func TestWithMaxActionsPerRequestIsOverriddenByLaterFlushThresholds(t *testing.T) {
+	indexer, _ := newStubIndexer(t, nil, WithMaxActionsPerRequest(3), WithFlushThresholds(0, 5, 0))
+	if indexer.maxBatchActions != 5 {
+		t.Errorf("expected the later action threshold to apply; got %d", indexer.maxBatchActions)
+	}
+	for _, maxActions := range []int{0, -1} {
+		if _, err := newIndexer(nil, "", WithMaxActionsPerRequest(maxActions)); err == nil {
+			t.Errorf("expected max actions per request %d to be rejected", maxActions)
+		}
+	}
+}
+
+func TestWithFlushThresholdsFlushesBeforeExceedingMaxBatchSizeBytes(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithFlushThresholds(16, 0, 0))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueN(t, indexer, 3)
+	waitFor(t, "bulk request", func() bool { return len(transport.bulkRequests()) == 1 })
+
+	if actions := len(parseBulkBody(t, transport.bulkRequests()[0].Body)); actions != 2 {
+		t.Errorf("expected the batch to be flushed before exceeding 16 bytes; got %d actions", actions)
+	}
+}
+
+func TestWithFlushThresholdsFlushesAtMaxBatchInterval(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithFlushThresholds(0, 0, 20*time.Millisecond))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueN(t, indexer, 1)
+	waitFor(t, "bulk request", func() bool { return len(transport.bulkRequests()) == 1 })
+}
+
+func TestWithFlushThresholdsRejectsNegativeThresholds(t *testing.T) {
+	if _, err := newIndexer(nil, "", WithFlushThresholds(-1, 0, 0)); err == nil {
+		t.Errorf("expected negative flush thresholds to be rejected")
+	}
+}
+
+// autoCreateHandler returns a handler acknowledging bulk actions, for which the given indices exist
+func autoCreateHandler(t *testing.T, existing ...string) stubHandler {
+	bulk := okBulkHandler(t)
+	return func(req *stubRequest) (int, string) {
+		if req.Method == http.MethodHead {
+			for _, index := range existing {
+				if req.Path == "/"+index {
+					return http.StatusOK, ""
+				}
+			}
+			return http.StatusNotFound, ""
+		}
+		return bulk(req)
+	}
+}
+
+func TestWithAutoCreateIndexCreatesMissingIndicesOnce(t *testing.T) {
+	settings := map[string]interface{}{"settings": map[string]interface{}{"number_of_shards": 1}}
+	indexer, transport := newStubIndexer(t, autoCreateHandler(t, "existing"), WithAutoCreateIndex(settings))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueN(t, indexer, 2)
+	if err := indexer.Q(testMessage("existing", "1", `{"a":1}`)); err != nil {
+		t.Fatalf("failed to enqueue message; %s", err.Error())
+	}
+	waitIdle(t, indexer)
+
+	if checks := len(transport.find(http.MethodHead, "/events")); checks != 1 {
+		t.Errorf("expected the existence of the index to be checked once; got %d", checks)
+	}
+	creates := transport.find(http.MethodPut, "/events")
+	if len(creates) != 1 {
+		t.Fatalf("expected the missing index to be created once; got %d", len(creates))
+	}
+	var body map[string]interface{}
+	if err := jsonCodec.Unmarshal(creates[0].Body, &body); err != nil || body["settings"] == nil {
+		t.Errorf("expected the index to be created with the configured settings; got %s", creates[0].Body)
+	}
+	if len(transport.find(http.MethodPut, "/existing")) != 0 {
+		t.Errorf("expected the existing index not to be created")
+	}
+	if len(transport.bulkRequests()) == 0 {
+		t.Errorf("expected the documents to be indexed")
+	}
+}
+
+func TestEnsureIndexIsBoundedByContext(t *testing.T) {
+	indexer, _ := newStubIndexer(t, func(req *stubRequest) (int, string) {
+		<-req.ctx.Done()
+		return 0, ""
+	}, WithAutoCreateIndex(nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	startedAt := time.Now()
+	indexer.ensureIndex(ctx, "events")
+	if elapsed := time.Since(startedAt); elapsed > 2*time.Second {
+		t.Errorf("expected ensuring the index to be bounded by its context; took %v", elapsed)
+	}
+	if indexer.createdIndices["events"] {
+		t.Errorf("expected the index not to be marked created")
+	}
+}
+
+func TestWithMaxDocumentBytesDeadLettersOversizedDocuments(t *testing.T) {
+	var dead deadLetters
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithMaxDocumentBytes(10), WithDeadLetterHandler(dead.handler()))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	for _, msg := range []*Message{testMessage("events", "1", `{"a":"oversized"}`), testMessage("events", "2", `{"a":1}`)} {
+		if err := indexer.Q(msg); err != nil {
+			t.Fatalf("failed to enqueue message; %s", err.Error())
+		}
+	}
+	waitIdle(t, indexer)
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 1 || commands[0].meta["_id"] != "2" {
+		t.Errorf("expected only the document within the max size to be sent; got %d bulk actions", len(commands))
+	}
+	if dead.len() != 1 || *dead.messages[0].Header.ID != "1" {
+		t.Fatalf("expected the oversized document to be dead-lettered")
+	}
+	if !strings.Contains(dead.reasons[0].Error(), "exceeds configured max 10-byte document size") {
+		t.Errorf("expected the reason to describe the max document size; got %s", dead.reasons[0].Error())
+	}
+}
+
+func TestWithHomogeneousBatchesFlushesOnOpBoundaries(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithHomogeneousBatches())
+	stop := runIndexer(indexer)
+	defer stop()
+
+	del := testMessage("events", "1", "")
+	del.Header.Op = stringOrNil(OpDelete)
+	for _, msg := range []*Message{testMessage("events", "1", `{"a":1}`), testMessage("events", "2", `{"a":2}`), del, testMessage("events", "3", `{"a":3}`)} {
+		if err := indexer.Q(msg); err != nil {
+			t.Fatalf("failed to enqueue message; %s", err.Error())
+		}
+	}
+	waitIdle(t, indexer)
+
+	reqs := transport.bulkRequests()
+	if len(reqs) != 3 {
+		t.Fatalf("expected a bulk request per run of ops; got %d", len(reqs))
+	}
+	for i, expected := range [][]string{{OpIndex, OpIndex}, {OpDelete}, {OpIndex}} {
+		commands := parseBulkBody(t, reqs[i].Body)
+		ops := make([]string, 0, len(commands))
+		for _, command := range commands {
+			ops = append(ops, command.op)
+		}
+		if strings.Join(ops, ",") != strings.Join(expected, ",") {
+			t.Errorf("expected bulk request %d to contain %v; got %v", i, expected, ops)
+		}
+	}
+}
+
+func TestIndexerMixesOpsWithoutHomogeneousBatches(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	del := testMessage("events", "1", "")
+	del.Header.Op = stringOrNil(OpDelete)
+	enqueueAll(t, indexer, 3, testMessage("events", "1", `{"a":1}`), del, testMessage("events", "2", `{"a":2}`))
+	waitIdle(t, indexer)
+
+	if reqs := transport.bulkRequests(); len(reqs) != 1 {
+		t.Errorf("expected the interleaved ops to be sent in a single bulk request; got %d", len(reqs))
+	}
+}
+
+func TestWithBulkContentTypeOverridesContentType(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithBulkContentType("application/json"))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueAll(t, indexer, 1, testMessage("events", "1", `{"a":1}`))
+	waitIdle(t, indexer)
+
+	reqs := transport.bulkRequests()
+	if len(reqs) != 1 {
+		t.Fatalf("expected 1 bulk request; got %d", len(reqs))
+	}
+	if contentType := reqs[0].Header.Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("expected the configured content type; got %q", contentType)
+	}
+	if _, err := newIndexer(nil, "", WithBulkContentType("")); err == nil {
+		t.Errorf("expected an empty content type to be rejected")
+	}
+}
+
+func TestWithMaxBufferedBytesDeniesMessagesExceedingMax(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithMaxBufferedBytes(16))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	payload := `{"a":"123456"}` // 14 bytes
+	enqueueAll(t, indexer, 1, cursorMessage("events", "1", 1))
+	if err := indexer.Q(testMessage("events", "2", payload)); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull once the buffered bytes would exceed the max; got %v", err)
+	}
+	denied := testMessage("events", "3", payload)
+	cursor := int64(2)
+	denied.Header.Cursor = &cursor
+	if err := indexer.Q(denied); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull; got %v", err)
+	}
+	waitIdle(t, indexer)
+
+	if buffered := atomic.LoadInt64(&indexer.admittedBytes); buffered != 0 {
+		t.Errorf("expected the bytes of settled messages to be released; got %d", buffered)
+	}
+	if err := indexer.Q(cursorMessage("events", "4", 3)); err != nil {
+		t.Fatalf("expected the message to be admitted once the buffered bytes are released; got %s", err.Error())
+	}
+	waitIdle(t, indexer)
+
+	if checkpoint := indexer.Checkpoint(); checkpoint != 3 {
+		t.Errorf("expected the denied message not to hold back the checkpoint; got %d", checkpoint)
+	}
+	if commands := sentCommands(t, transport); len(commands) != 2 {
+		t.Errorf("expected only the admitted messages to be sent; got %d bulk actions", len(commands))
+	}
+}
+
+func TestWithMaxBufferedBytesAdmitsOversizedMessageWhenNothingIsBuffered(t *testing.T) {
+	indexer, _ := newStubIndexer(t, okBulkHandler(t), WithMaxBufferedBytes(4))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	if err := indexer.Q(testMessage("events", "1", `{"a":"oversized"}`)); err != nil {
+		t.Errorf("expected a message larger than the max to be admitted when nothing is buffered; got %s", err.Error())
+	}
+	waitIdle(t, indexer)
+
+	if _, err := newIndexer(nil, "", WithMaxBufferedBytes(-1)); err == nil {
+		t.Errorf("expected negative max buffered bytes to be rejected")
+	}
+}
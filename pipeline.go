@@ -0,0 +1,53 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// SimulatePipeline runs the given sample documents through the named ingest pipeline without
+// indexing them; each document is provided as the _source of a simulated document
+func SimulatePipeline(ctx context.Context, pipeline string, docs []json.RawMessage) (*elastic.IngestSimulatePipelineResponse, error) {
+	return simulatePipeline(ctx, pipeline, nil, docs)
+}
+
+// SimulateInlinePipeline runs the given sample documents through the given inline pipeline
+// definition (i.e., description and processors) without indexing them
+func SimulateInlinePipeline(ctx context.Context, definition map[string]interface{}, docs []json.RawMessage) (*elastic.IngestSimulatePipelineResponse, error) {
+	return simulatePipeline(ctx, "", definition, docs)
+}
+
+func simulatePipeline(ctx context.Context, pipeline string, definition map[string]interface{}, docs []json.RawMessage) (*elastic.IngestSimulatePipelineResponse, error) {
+	client, err := GetClient()
+	if err != nil {
+		return nil, err
+	}
+
+	simulated := make([]map[string]interface{}, 0, len(docs))
+	for _, doc := range docs {
+		simulated = append(simulated, map[string]interface{}{
+			"_source": doc,
+		})
+	}
+
+	body := map[string]interface{}{
+		"docs": simulated,
+	}
+
+	svc := client.IngestSimulatePipeline()
+	if definition != nil {
+		body["pipeline"] = definition
+	} else {
+		svc.Id(pipeline)
+	}
+
+	response, err := svc.BodyJson(body).Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to simulate elasticsearch ingest pipeline %s with %d document(s); %w", pipeline, len(docs), err)
+	}
+
+	return response, nil
+}
@@ -0,0 +1,126 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// simulateHandler returns a handler responding to pipeline simulations with the processed documents
+func simulateHandler() stubHandler {
+	return func(req *stubRequest) (int, string) {
+		if req.Method == http.MethodPost && strings.HasSuffix(req.Path, "/_simulate") {
+			return http.StatusOK, `{"docs":[{"doc":{"_index":"_index","_id":"_id","_source":{"level":"WARN"}}}]}`
+		}
+		return http.StatusNotFound, `{}`
+	}
+}
+
+// simulateBody parses the body of the given simulate request
+func simulateBody(t *testing.T, req *stubRequest) map[string]interface{} {
+	t.Helper()
+
+	var body map[string]interface{}
+	if err := jsonCodec.Unmarshal(req.Body, &body); err != nil {
+		t.Fatalf("failed to parse simulate body; %s", err.Error())
+	}
+	return body
+}
+
+func TestSimulatePipeline(t *testing.T) {
+	transport, restore := useStubClient(t, simulateHandler())
+	defer restore()
+
+	response, err := SimulatePipeline(context.Background(), "uppercase", []json.RawMessage{json.RawMessage(`{"level":"warn"}`)})
+	if err != nil {
+		t.Fatalf("failed to simulate pipeline; %s", err.Error())
+	}
+	if len(response.Docs) != 1 || response.Docs[0].Doc["_source"].(map[string]interface{})["level"] != "WARN" {
+		t.Errorf("expected the processed document to be returned")
+	}
+
+	reqs := transport.find(http.MethodPost, "/_ingest/pipeline/uppercase/_simulate")
+	if len(reqs) != 1 {
+		t.Fatalf("expected 1 simulate request for the named pipeline; got %d", len(reqs))
+	}
+	body := simulateBody(t, reqs[0])
+	docs, _ := body["docs"].([]interface{})
+	if len(docs) != 1 || docs[0].(map[string]interface{})["_source"] == nil {
+		t.Errorf("expected the document to be sent as the _source of a simulated document; got %s", reqs[0].Body)
+	}
+	if _, ok := body["pipeline"]; ok {
+		t.Errorf("expected no inline pipeline definition")
+	}
+}
+
+func TestSimulateInlinePipeline(t *testing.T) {
+	transport, restore := useStubClient(t, simulateHandler())
+	defer restore()
+
+	definition := map[string]interface{}{
+		"processors": []interface{}{map[string]interface{}{"uppercase": map[string]interface{}{"field": "level"}}},
+	}
+	if _, err := SimulateInlinePipeline(context.Background(), definition, []json.RawMessage{json.RawMessage(`{"level":"warn"}`)}); err != nil {
+		t.Fatalf("failed to simulate pipeline; %s", err.Error())
+	}
+
+	reqs := transport.find(http.MethodPost, "/_ingest/pipeline/_simulate")
+	if len(reqs) != 1 {
+		t.Fatalf("expected 1 simulate request; got %d", len(reqs))
+	}
+	if _, ok := simulateBody(t, reqs[0])["pipeline"]; !ok {
+		t.Errorf("expected the inline pipeline definition to be sent")
+	}
+}
+
+func TestIndexerAppliesDefaultPipelineUnlessOverridden(t *testing.T) {
+	_, restore := requireStubElasticsearch(t, map[string]string{
+		"ELASTICSEARCH_HOSTS":            "es.local:9200",
+		"ELASTICSEARCH_DEFAULT_PIPELINE": "enrich",
+	}, nil)
+	defer restore()
+
+	if elasticDefaultPipeline == nil || *elasticDefaultPipeline != "enrich" {
+		t.Fatalf("expected the default pipeline from environment; got %v", elasticDefaultPipeline)
+	}
+
+	indexer, transport := newStubIndexer(t, okBulkHandler(t))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	overridden := testMessage("events", "2", `{"a":2}`)
+	overridden.Header.Pipeline = stringOrNil("redact")
+	skipped := testMessage("events", "3", `{"a":3}`)
+	skipped.Header.Pipeline = stringOrNil("_none")
+	enqueueAll(t, indexer, 3, testMessage("events", "1", `{"a":1}`), overridden, skipped)
+	waitIdle(t, indexer)
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 3 {
+		t.Fatalf("expected 3 bulk actions; got %d", len(commands))
+	}
+	for i, expected := range []string{"enrich", "redact", "_none"} {
+		if commands[i].meta["pipeline"] != expected {
+			t.Errorf("expected action %d to use pipeline %s; got %v", i, expected, commands[i].meta["pipeline"])
+		}
+	}
+}
+
+func TestIndexerOmitsPipelineWithoutDefault(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueAll(t, indexer, 1, testMessage("events", "1", `{"a":1}`))
+	waitIdle(t, indexer)
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 1 {
+		t.Fatalf("expected 1 bulk action; got %d", len(commands))
+	}
+	if pipeline, ok := commands[0].meta["pipeline"]; ok {
+		t.Errorf("expected no pipeline to be sent; got %v", pipeline)
+	}
+}
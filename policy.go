@@ -0,0 +1,70 @@
+package elasticsearchutil
+
+import (
+	"fmt"
+	"path"
+)
+
+// IndexPolicy restricts the ops which may target the indices matching a pattern
+type IndexPolicy struct {
+	AllowedOps []string
+}
+
+// AppendOnlyIndexPolicy permits only documents to be created; an OpIndex without an id in its
+// header is treated as OpCreate since its auto-generated id cannot overwrite an existing document
+var AppendOnlyIndexPolicy = IndexPolicy{AllowedOps: []string{OpCreate}}
+
+// indexPolicyRule binds an IndexPolicy to the index pattern (i.e., `logs-*`) to which it applies
+type indexPolicyRule struct {
+	pattern string
+	policy  IndexPolicy
+}
+
+// allows returns true when the policy permits the given op
+func (p IndexPolicy) allows(op string) bool {
+	for _, allowed := range p.AllowedOps {
+		if allowed == op {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesIndexPattern returns true when the given index matches any of the given patterns
+func matchesIndexPattern(patterns []string, index string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, index); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// validateIndexAccess returns an error when writes to the given index are not permitted by the configured
+// denylist or allowlist; the denylist takes precedence, denying an index even when it is allowlisted
+func (indexer *Indexer) validateIndexAccess(index string) error {
+	if matchesIndexPattern(indexer.indexDenylist, index) {
+		return fmt.Errorf("index %s matches denylist; %w", index, ErrIndexNotPermitted)
+	}
+
+	if indexer.indexAllowlist != nil && !matchesIndexPattern(indexer.indexAllowlist, index) {
+		return fmt.Errorf("index %s does not match allowlist; %w", index, ErrIndexNotPermitted)
+	}
+
+	return nil
+}
+
+// validateIndexPolicy returns an error when the given op is not permitted by each policy matching the given index
+func (indexer *Indexer) validateIndexPolicy(msg *Message, index, op string) error {
+	if op == OpIndex && msg.Header.ID == nil {
+		op = OpCreate
+	}
+
+	for _, rule := range indexer.indexPolicies {
+		if matched, _ := path.Match(rule.pattern, index); matched && !rule.policy.allows(op) {
+			return fmt.Errorf("failed to index %d-byte message; %s op not permitted by policy for index %s", len(msg.Payload), op, index)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package elasticsearchutil
+
+import (
+	"errors"
+	"testing"
+)
+
+// opMessage returns a message for the given index and id (omitted when empty) requesting the given op
+func opMessage(index, id, op string) *Message {
+	msg := testMessage(index, id, `{"a":1}`)
+	msg.Header.Op = stringOrNil(op)
+	return msg
+}
+
+func TestWithIndexPolicyRestrictsOpsOfMatchingIndices(t *testing.T) {
+	indexer, _ := newStubIndexer(t, nil, WithIndexPolicy("audit-*", AppendOnlyIndexPolicy))
+
+	permitted := []*Message{
+		opMessage("audit-1", "1", OpCreate),
+		opMessage("audit-1", "", OpIndex),
+		opMessage("events", "1", OpIndex),
+		opMessage("events", "1", OpDelete),
+	}
+	for _, msg := range permitted {
+		if _, err := indexer.bulkRequest(msg); err != nil {
+			t.Errorf("expected %s op for index %s to be permitted; %s", *msg.Header.Op, *msg.Header.Index, err.Error())
+		}
+	}
+
+	denied := []*Message{
+		opMessage("audit-1", "1", OpIndex),
+		opMessage("audit-1", "1", OpUpdate),
+		opMessage("audit-1", "1", OpDelete),
+	}
+	for _, msg := range denied {
+		if _, err := indexer.bulkRequest(msg); err == nil {
+			t.Errorf("expected %s op for index %s to be denied", *msg.Header.Op, *msg.Header.Index)
+		}
+	}
+}
+
+func TestWithIndexPolicyRequiresEveryMatchingPolicyToPermitOp(t *testing.T) {
+	indexer, _ := newStubIndexer(t, nil,
+		WithIndexPolicy("audit-*", IndexPolicy{AllowedOps: []string{OpCreate, OpDelete}}),
+		WithIndexPolicy("audit-archive-*", AppendOnlyIndexPolicy),
+	)
+
+	if _, err := indexer.bulkRequest(opMessage("audit-1", "1", OpDelete)); err != nil {
+		t.Errorf("expected delete permitted by the only matching policy; %s", err.Error())
+	}
+	if _, err := indexer.bulkRequest(opMessage("audit-archive-1", "1", OpDelete)); err == nil {
+		t.Errorf("expected delete denied by one of the matching policies to be denied")
+	}
+}
+
+func TestWithIndexPolicyRejectsInvalidPatterns(t *testing.T) {
+	if _, err := newIndexer(nil, "", WithIndexPolicy("audit-[", AppendOnlyIndexPolicy)); err == nil {
+		t.Errorf("expected invalid index policy pattern to be rejected")
+	}
+}
+
+func TestWithIndexDenylistDeadLettersDeniedIndices(t *testing.T) {
+	var dead deadLetters
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithIndexDenylist([]string{".*", "audit-*"}), WithDeadLetterHandler(dead.handler()))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueAll(t, indexer, 1, testMessage(".security", "1", `{"a":1}`), testMessage("audit-1", "2", `{"a":2}`), testMessage("events", "3", `{"a":3}`))
+	waitIdle(t, indexer)
+
+	if dead.len() != 2 {
+		t.Fatalf("expected messages targeting denied indices to be dead-lettered; got %d dead-lettered", dead.len())
+	}
+	for _, reason := range dead.reasons {
+		if !errors.Is(reason, ErrIndexNotPermitted) {
+			t.Errorf("expected ErrIndexNotPermitted; got %v", reason)
+		}
+	}
+	if commands := sentCommands(t, transport); len(commands) != 1 || commands[0].meta["_index"] != "events" {
+		t.Errorf("expected only the permitted message to be sent; got %v", commands)
+	}
+}
+
+func TestWithIndexDenylistRejectsInvalidPatterns(t *testing.T) {
+	if _, err := newIndexer(nil, "", WithIndexDenylist([]string{"audit-["})); err == nil {
+		t.Errorf("expected invalid index denylist pattern to be rejected")
+	}
+}
+
+func TestWithIndexAllowlistDeadLettersUnlistedIndices(t *testing.T) {
+	indexer, _ := newStubIndexer(t, nil, WithIndexAllowlist([]string{"events-*", "audit-*"}), WithIndexDenylist([]string{"audit-*"}))
+
+	if err := indexer.validateIndexAccess("events-1"); err != nil {
+		t.Errorf("expected an allowlisted index to be permitted; %s", err.Error())
+	}
+	if err := indexer.validateIndexAccess("logs"); !errors.Is(err, ErrIndexNotPermitted) {
+		t.Errorf("expected an unlisted index to be denied; got %v", err)
+	}
+	if err := indexer.validateIndexAccess("audit-1"); !errors.Is(err, ErrIndexNotPermitted) {
+		t.Errorf("expected the denylist to take precedence over the allowlist; got %v", err)
+	}
+
+	empty, _ := newStubIndexer(t, nil, WithIndexAllowlist(nil))
+	if err := empty.validateIndexAccess("events-1"); !errors.Is(err, ErrIndexNotPermitted) {
+		t.Errorf("expected an empty allowlist to permit no indices; got %v", err)
+	}
+
+	if _, err := newIndexer(nil, "", WithIndexAllowlist([]string{"events-["})); err == nil {
+		t.Errorf("expected invalid index allowlist pattern to be rejected")
+	}
+}
@@ -0,0 +1,187 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// IndexerPool maintains an indexer per stream (i.e., per tenant or topic), each created lazily
+// upon the first message enqueued for its stream; when configured with an idle ttl, an indexer not
+// having received a message within the ttl is drained and stopped, and re-created upon the next message
+type IndexerPool struct {
+	stats PoolStats // accessed atomically; first field for 64-bit alignment
+
+	mutex    sync.RWMutex
+	indexers map[string]*pooledIndexer
+	opts     []IndexerOption
+	idleTTL  time.Duration
+	done     chan struct{}
+	closed   bool
+}
+
+// PoolStats reports the lifecycle of the indexers maintained by an IndexerPool
+type PoolStats struct {
+	Created int64 `json:"created"` // indexers created, including those re-created after being reaped
+	Reaped  int64 `json:"reaped"`  // idle indexers drained and stopped
+	Active  int64 `json:"active"`  // indexers currently running
+}
+
+// pooledIndexer is an indexer maintained by an IndexerPool along with the time it was last used
+type pooledIndexer struct {
+	indexer  *Indexer
+	lastUsed int64 // unix nanos; accessed atomically
+	inUse    int64 // messages being enqueued; accessed atomically
+}
+
+// NewIndexerPool initializes a pool creating each of its indexers with the given options; indexers
+// idle for the given ttl are reaped, unless the ttl is zero, in which case indexers run until the pool is closed
+func NewIndexerPool(idleTTL time.Duration, opts ...IndexerOption) *IndexerPool {
+	pool := &IndexerPool{
+		indexers: map[string]*pooledIndexer{},
+		opts:     opts,
+		idleTTL:  idleTTL,
+		done:     make(chan struct{}),
+	}
+
+	if idleTTL > 0 {
+		go pool.reap()
+	}
+
+	return pool
+}
+
+// Q enqueues the given message using the indexer for the given stream, creating it if necessary
+func (pool *IndexerPool) Q(stream string, msg *Message) error {
+	for {
+		// marked in use while enqueueing, which may block, such that the indexer cannot be reaped in the interim
+		pool.mutex.RLock()
+		if pooled, ok := pool.indexers[stream]; ok {
+			atomic.AddInt64(&pooled.inUse, 1)
+			atomic.StoreInt64(&pooled.lastUsed, time.Now().UnixNano())
+			pool.mutex.RUnlock()
+
+			err := pooled.indexer.Q(msg)
+			atomic.StoreInt64(&pooled.lastUsed, time.Now().UnixNano())
+			atomic.AddInt64(&pooled.inUse, -1)
+			return err
+		}
+		pool.mutex.RUnlock()
+
+		if err := pool.create(stream); err != nil {
+			return fmt.Errorf("failed to enqueue %d-byte message for stream %s; %w", len(msg.Payload), stream, err)
+		}
+	}
+}
+
+// create runs a new indexer for the given stream unless one exists, returning an error once the pool is
+// closed or if the indexer cannot be initialized
+func (pool *IndexerPool) create(stream string) error {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	if pool.closed {
+		return fmt.Errorf("indexer pool closed; %w", ErrStopped)
+	}
+
+	if _, ok := pool.indexers[stream]; ok {
+		return nil
+	}
+
+	indexer, err := NewIndexer(pool.opts...)
+	if err != nil {
+		return err
+	}
+
+	pooled := &pooledIndexer{
+		indexer:  indexer,
+		lastUsed: time.Now().UnixNano(),
+	}
+	go pooled.indexer.Run()
+
+	pool.indexers[stream] = pooled
+	atomic.AddInt64(&pool.stats.Created, 1)
+	atomic.AddInt64(&pool.stats.Active, 1)
+	log.Debugf("indexer pool created indexer (%v) for stream %s", pooled.indexer.identifier, stream)
+
+	return nil
+}
+
+// reap periodically drains and stops the indexers idle for the configured ttl until the pool is closed
+func (pool *IndexerPool) reap() {
+	ticker := time.NewTicker(pool.idleTTL / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for stream, pooled := range pool.detachIdle() {
+				pool.stop(stream, pooled)
+				atomic.AddInt64(&pool.stats.Reaped, 1)
+			}
+		case <-pool.done:
+			return
+		}
+	}
+}
+
+// detachIdle removes and returns the indexers idle for the configured ttl; as an indexer is marked in
+// use under the read lock, no message can be in the process of being enqueued to a detached indexer
+func (pool *IndexerPool) detachIdle() map[string]*pooledIndexer {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	idle := map[string]*pooledIndexer{}
+	cutoff := time.Now().Add(-pool.idleTTL).UnixNano()
+	for stream, pooled := range pool.indexers {
+		if atomic.LoadInt64(&pooled.inUse) == 0 && atomic.LoadInt64(&pooled.lastUsed) < cutoff {
+			idle[stream] = pooled
+			delete(pool.indexers, stream)
+		}
+	}
+
+	return idle
+}
+
+// stop drains the given detached indexer, bounded by its shutdown flush timeout
+func (pool *IndexerPool) stop(stream string, pooled *pooledIndexer) {
+	ctx, cancel := context.WithTimeout(context.Background(), pooled.indexer.shutdownFlushTimeout)
+	defer cancel()
+
+	if _, err := pooled.indexer.Drain(ctx); err != nil {
+		log.Warningf("indexer pool failed to drain indexer (%v) for stream %s; %s", pooled.indexer.identifier, stream, err.Error())
+	} else {
+		log.Debugf("indexer pool stopped indexer (%v) for stream %s", pooled.indexer.identifier, stream)
+	}
+	atomic.AddInt64(&pool.stats.Active, -1)
+}
+
+// Close drains and stops every indexer in the pool; messages may no longer be enqueued afterward
+func (pool *IndexerPool) Close() {
+	pool.mutex.Lock()
+	if pool.closed {
+		pool.mutex.Unlock()
+		return
+	}
+	pool.closed = true
+	close(pool.done)
+
+	indexers := pool.indexers
+	pool.indexers = map[string]*pooledIndexer{}
+	pool.mutex.Unlock()
+
+	for stream, pooled := range indexers {
+		pool.stop(stream, pooled)
+	}
+}
+
+// Stats returns a snapshot of the pool stats
+func (pool *IndexerPool) Stats() PoolStats {
+	return PoolStats{
+		Created: atomic.LoadInt64(&pool.stats.Created),
+		Reaped:  atomic.LoadInt64(&pool.stats.Reaped),
+		Active:  atomic.LoadInt64(&pool.stats.Active),
+	}
+}
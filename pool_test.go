@@ -0,0 +1,93 @@
+package elasticsearchutil
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIndexerPoolCreatesIndexerPerStream(t *testing.T) {
+	transport, restore := useStubClient(t, okBulkHandler(t))
+	defer restore()
+
+	pool := NewIndexerPool(0)
+	for _, stream := range []string{"tenant-1", "tenant-2", "tenant-1"} {
+		if err := pool.Q(stream, testMessage("events", stream, `{"a":1}`)); err != nil {
+			t.Fatalf("failed to enqueue message; %s", err.Error())
+		}
+	}
+	if stats := pool.Stats(); stats.Created != 2 || stats.Active != 2 {
+		t.Errorf("expected an indexer per stream; got %d created, %d active", stats.Created, stats.Active)
+	}
+
+	pool.Close()
+	if stats := pool.Stats(); stats.Active != 0 {
+		t.Errorf("expected every indexer to be stopped; got %d active", stats.Active)
+	}
+	if commands := sentCommands(t, transport); len(commands) != 3 {
+		t.Errorf("expected the enqueued messages to be flushed upon close; got %d bulk actions", len(commands))
+	}
+	if err := pool.Q("tenant-1", testMessage("events", "1", `{"a":1}`)); !errors.Is(err, ErrStopped) {
+		t.Errorf("expected ErrStopped enqueueing to a closed pool; got %v", err)
+	}
+}
+
+func TestIndexerPoolReapsIdleIndexers(t *testing.T) {
+	_, restore := useStubClient(t, okBulkHandler(t))
+	defer restore()
+
+	pool := NewIndexerPool(20 * time.Millisecond)
+	defer pool.Close()
+
+	if err := pool.Q("tenant-1", testMessage("events", "1", `{"a":1}`)); err != nil {
+		t.Fatalf("failed to enqueue message; %s", err.Error())
+	}
+	waitFor(t, "the idle indexer to be reaped", func() bool {
+		stats := pool.Stats()
+		return stats.Reaped == 1 && stats.Active == 0
+	})
+
+	if err := pool.Q("tenant-1", testMessage("events", "2", `{"a":1}`)); err != nil {
+		t.Fatalf("failed to enqueue message; %s", err.Error())
+	}
+	if stats := pool.Stats(); stats.Created != 2 || stats.Active != 1 {
+		t.Errorf("expected the reaped indexer to be re-created; got %d created, %d active", stats.Created, stats.Active)
+	}
+}
+
+func TestIndexerPoolDoesNotReapIndexersInUse(t *testing.T) {
+	pool := NewIndexerPool(0)
+	pool.idleTTL = time.Millisecond
+
+	pooled := &pooledIndexer{lastUsed: time.Now().Add(-time.Hour).UnixNano(), inUse: 1}
+	pool.indexers["tenant-1"] = pooled
+
+	if idle := pool.detachIdle(); len(idle) != 0 {
+		t.Errorf("expected an indexer being enqueued to not be reaped")
+	}
+
+	atomic.StoreInt64(&pooled.inUse, 0)
+	if idle := pool.detachIdle(); len(idle) != 1 || idle["tenant-1"] != pooled {
+		t.Errorf("expected the idle indexer to be detached")
+	}
+	if len(pool.indexers) != 0 {
+		t.Errorf("expected the detached indexer to be removed from the pool")
+	}
+}
+
+func TestIndexerPoolReturnsInitializationErrors(t *testing.T) {
+	clients := elasticClients
+	elasticClients = nil
+	defer func() { elasticClients = clients }()
+
+	pool := NewIndexerPool(0)
+	defer pool.Close()
+
+	if err := pool.Q("tenant-1", testMessage("events", "1", `{"a":1}`)); !errors.Is(err, ErrNoClient) {
+		t.Errorf("expected ErrNoClient; got %v", err)
+	}
+	if stats := pool.Stats(); stats.Created != 0 {
+		t.Errorf("expected no indexer to be created; got %d", stats.Created)
+	}
+}
@@ -0,0 +1,26 @@
+package elasticsearchutil
+
+// Preprocessor transforms a message prior to indexing, i.e., to add a tenant field to each payload;
+// returning an error drops the message, and returning a nil message skips it
+type Preprocessor func(msg *Message) (*Message, error)
+
+// preprocess applies the configured preprocessors in order, returning nil if the message is skipped;
+// retried messages have already been preprocessed and are returned as-is
+func (indexer *Indexer) preprocess(msg *Message) (*Message, error) {
+	if msg.attempts > 0 {
+		return msg, nil
+	}
+
+	for _, preprocessor := range indexer.preprocessors {
+		processed, err := preprocessor(msg)
+		if err != nil {
+			return nil, err
+		}
+		if processed == nil {
+			return nil, nil
+		}
+		msg = processed
+	}
+
+	return msg, nil
+}
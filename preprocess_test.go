@@ -0,0 +1,88 @@
+package elasticsearchutil
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// ackedMessage returns a message for the given index and id which sends its outcome on the returned channel once settled
+func ackedMessage(index, id, payload string) (*Message, chan error) {
+	acks := make(chan error, 1)
+	msg := testMessage(index, id, payload)
+	msg.Ack = func(err error) { acks <- err }
+	return msg, acks
+}
+
+func TestWithPreprocessorAppliesPreprocessorsInOrder(t *testing.T) {
+	tenant := func(msg *Message) (*Message, error) {
+		return &Message{
+			Header:  &MessageHeader{ID: msg.Header.ID, Index: stringOrNil("tenant-" + *msg.Header.Index)},
+			Payload: []byte(`{"tenant":"acme"}`),
+		}, nil
+	}
+	suffix := func(msg *Message) (*Message, error) {
+		msg.Header.Index = stringOrNil(*msg.Header.Index + "-v2")
+		return msg, nil
+	}
+
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithPreprocessor(tenant), WithPreprocessor(suffix))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	msg, acks := ackedMessage("events", "1", `{"a":1}`)
+	enqueueAll(t, indexer, 1, msg)
+	waitIdle(t, indexer)
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 1 {
+		t.Fatalf("expected 1 bulk action; got %d", len(commands))
+	}
+	if commands[0].meta["_index"] != "tenant-events-v2" || string(commands[0].source) != `{"tenant":"acme"}` {
+		t.Errorf("expected the preprocessed message to be indexed; got %v %s", commands[0].meta, commands[0].source)
+	}
+	if err := <-acks; err != nil {
+		t.Errorf("expected the original message to be acknowledged once its replacement is indexed; got %s", err.Error())
+	}
+}
+
+func TestWithPreprocessorSkipsAndRejectsMessages(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithPreprocessor(func(msg *Message) (*Message, error) {
+		switch *msg.Header.ID {
+		case "skipped":
+			return nil, nil
+		case "invalid":
+			return nil, errors.New("missing tenant")
+		case "headless":
+			return &Message{Payload: msg.Payload}, nil
+		}
+		return msg, nil
+	}))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	skipped, skippedAcks := ackedMessage("events", "skipped", `{"a":1}`)
+	invalid, invalidAcks := ackedMessage("events", "invalid", `{"a":2}`)
+	headless, headlessAcks := ackedMessage("events", "headless", `{"a":3}`)
+	enqueueAll(t, indexer, 0, skipped, invalid, headless)
+	waitIdle(t, indexer)
+
+	if err := <-skippedAcks; err != nil {
+		t.Errorf("expected the skipped message to be acknowledged; got %s", err.Error())
+	}
+	if err := <-invalidAcks; err == nil || !strings.Contains(err.Error(), "missing tenant") {
+		t.Errorf("expected the message to be rejected with the preprocessor error; got %v", err)
+	}
+	if err := <-headlessAcks; !errors.Is(err, ErrNoHeader) {
+		t.Errorf("expected a preprocessed message without header to be rejected; got %v", err)
+	}
+	if len(transport.bulkRequests()) != 0 {
+		t.Errorf("expected no bulk request")
+	}
+}
+
+func TestWithPreprocessorRejectsNilPreprocessor(t *testing.T) {
+	if _, err := newIndexer(nil, "", WithPreprocessor(nil)); err == nil {
+		t.Errorf("expected nil preprocessor to be rejected")
+	}
+}
@@ -0,0 +1,59 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// tokenBucket limits the rate of an operation to the configured number of tokens per second,
+// permitting bursts of up to one second's worth of tokens
+type tokenBucket struct {
+	mutex    sync.Mutex
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+// newTokenBucket returns a full bucket refilled at the given number of tokens per second
+func newTokenBucket(rate float64) *tokenBucket {
+	capacity := math.Max(rate, 1)
+	return &tokenBucket{
+		rate:     rate,
+		capacity: capacity,
+		tokens:   capacity,
+		last:     time.Now(),
+	}
+}
+
+// wait blocks until the given number of tokens is available, or the given context is done, and
+// then takes them; more tokens than the capacity of the bucket are taken once the bucket is full,
+// leaving it in deficit such that the average rate is nonetheless honored
+func (b *tokenBucket) wait(ctx context.Context, n float64) error {
+	for {
+		b.mutex.Lock()
+		now := time.Now()
+		b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+
+		required := math.Min(n, b.capacity)
+		if b.tokens >= required {
+			b.tokens -= n
+			b.mutex.Unlock()
+			return nil
+		}
+
+		delay := time.Duration((required - b.tokens) / b.rate * float64(time.Second))
+		b.mutex.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
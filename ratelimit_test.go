@@ -0,0 +1,138 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketPermitsBurstThenWaits(t *testing.T) {
+	bucket := newTokenBucket(5)
+
+	started := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := bucket.wait(context.Background(), 1); err != nil {
+			t.Fatalf("failed to take token; %s", err.Error())
+		}
+	}
+	if elapsed := time.Since(started); elapsed > 100*time.Millisecond {
+		t.Errorf("expected a burst of the full bucket without waiting; took %v", elapsed)
+	}
+
+	started = time.Now()
+	if err := bucket.wait(context.Background(), 1); err != nil {
+		t.Fatalf("failed to take token; %s", err.Error())
+	}
+	if elapsed := time.Since(started); elapsed < 100*time.Millisecond {
+		t.Errorf("expected to wait for the bucket to refill; took %v", elapsed)
+	}
+}
+
+func TestTokenBucketTakesMoreThanCapacityOnceFull(t *testing.T) {
+	bucket := newTokenBucket(10)
+
+	if err := bucket.wait(context.Background(), 25); err != nil {
+		t.Fatalf("failed to take tokens; %s", err.Error())
+	}
+	if bucket.tokens > -14.9 {
+		t.Errorf("expected the bucket to be left in deficit; got %f tokens", bucket.tokens)
+	}
+}
+
+func TestTokenBucketWaitIsBoundedByContext(t *testing.T) {
+	bucket := newTokenBucket(1)
+	if err := bucket.wait(context.Background(), 1); err != nil {
+		t.Fatalf("failed to take token; %s", err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := bucket.wait(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded; got %v", err)
+	}
+}
+
+func TestWithRateLimitDelaysFlushesExceedingRate(t *testing.T) {
+	indexer, _ := newStubIndexer(t, okBulkHandler(t), WithRateLimit(1))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueAll(t, indexer, 1, testMessage("events", "1", `{"a":1}`))
+	started := time.Now()
+	if _, err := indexer.FlushIndex(context.Background(), "events"); err != nil {
+		t.Fatalf("failed to flush index; %s", err.Error())
+	}
+	if elapsed := time.Since(started); elapsed > 30*time.Millisecond {
+		t.Errorf("expected the flush within the rate not to wait; took %v", elapsed)
+	}
+
+	enqueueAll(t, indexer, 1, testMessage("events", "2", `{"a":1}`))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	started = time.Now()
+	indexer.FlushIndex(ctx, "events")
+
+	if elapsed := time.Since(started); elapsed < 40*time.Millisecond {
+		t.Errorf("expected the flush exceeding the rate to wait for capacity; took %v", elapsed)
+	}
+}
+
+func TestWithRateLimitRejectsNonPositiveRates(t *testing.T) {
+	for _, rate := range []float64{0, -1} {
+		if _, err := newIndexer(nil, "", WithRateLimit(rate)); err == nil {
+			t.Errorf("expected rate limit %v to be rejected", rate)
+		}
+	}
+}
+
+func TestWithByteRateLimitTakesEstimatedRequestSize(t *testing.T) {
+	indexer, _ := newStubIndexer(t, okBulkHandler(t), WithByteRateLimit(1000))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueAll(t, indexer, 1, testMessage("events", "1", `{"a":1}`))
+	if _, err := indexer.FlushIndex(context.Background(), "events"); err != nil {
+		t.Fatalf("failed to flush index; %s", err.Error())
+	}
+
+	indexer.byteLimiter.mutex.Lock()
+	defer indexer.byteLimiter.mutex.Unlock()
+	if taken := 1000 - indexer.byteLimiter.tokens; taken < 7 || taken > 200 {
+		t.Errorf("expected the estimated size of the bulk request to be taken; got %f bytes", taken)
+	}
+}
+
+func TestWithByteRateLimitDelaysFlushesExceedingRate(t *testing.T) {
+	indexer, _ := newStubIndexer(t, okBulkHandler(t), WithByteRateLimit(10))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	// a request larger than the budget of one second is sent once the full budget accrues
+	enqueueAll(t, indexer, 1, testMessage("events", "1", `{"a":1}`))
+	started := time.Now()
+	if _, err := indexer.FlushIndex(context.Background(), "events"); err != nil {
+		t.Fatalf("failed to flush index; %s", err.Error())
+	}
+	if elapsed := time.Since(started); elapsed > 30*time.Millisecond {
+		t.Errorf("expected the oversized request not to wait on a full budget; took %v", elapsed)
+	}
+
+	enqueueAll(t, indexer, 1, testMessage("events", "2", `{"a":1}`))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	started = time.Now()
+	indexer.FlushIndex(ctx, "events")
+
+	if elapsed := time.Since(started); elapsed < 40*time.Millisecond {
+		t.Errorf("expected the flush exceeding the byte rate to wait for budget; took %v", elapsed)
+	}
+}
+
+func TestWithByteRateLimitRejectsNonPositiveRates(t *testing.T) {
+	for _, rate := range []int{0, -1} {
+		if _, err := newIndexer(nil, "", WithByteRateLimit(rate)); err == nil {
+			t.Errorf("expected byte rate limit %d to be rejected", rate)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package elasticsearchutil
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+)
+
+// IndexReader streams newline-delimited json documents from the given reader, enqueueing each
+// as a message for the given index without loading the entire input into memory; messages are
+// flushed in batches per the configured thresholds. The number of documents enqueued is returned
+// along with the first read, parse or enqueue error encountered; blank lines are skipped, and a final
+// line lacking a trailing newline is indexed. Callers may use WaitIdle to wait for the documents to flush.
+func (indexer *Indexer) IndexReader(ctx context.Context, index string, r io.Reader) (indexed int, err error) {
+	reader := bufio.NewReader(r)
+
+	for line := 1; ; line++ {
+		if err := ctx.Err(); err != nil {
+			return indexed, err
+		}
+
+		raw, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return indexed, fmt.Errorf("failed to read ndjson document at line %d; %w", line, readErr)
+		}
+
+		payload := bytes.TrimSpace(raw)
+		if len(payload) > 0 {
+			if !jsonCodec.Valid(payload) {
+				return indexed, fmt.Errorf("failed to parse ndjson document at line %d; invalid json", line)
+			}
+
+			idx := index
+			err := indexer.Q(&Message{
+				Header: &MessageHeader{
+					Index: &idx,
+				},
+				Payload: payload,
+			})
+			if err != nil {
+				return indexed, err
+			}
+			indexed++
+		}
+
+		if readErr == io.EOF {
+			return indexed, nil
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestIndexReaderEnqueuesEachDocument(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	indexed, err := indexer.IndexReader(context.Background(), "events", strings.NewReader("{\"a\":1}\n\n  \n{\"a\":2}\r\n{\"a\":3}"))
+	if err != nil {
+		t.Fatalf("failed to index reader; %s", err.Error())
+	}
+	if indexed != 3 {
+		t.Errorf("expected 3 documents enqueued; got %d", indexed)
+	}
+	waitIdle(t, indexer)
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 3 {
+		t.Fatalf("expected 3 bulk actions; got %d", len(commands))
+	}
+	for i, command := range commands {
+		if command.meta["_index"] != "events" {
+			t.Errorf("expected action %d to target the events index; got %v", i, command.meta["_index"])
+		}
+	}
+	if string(commands[1].source) != `{"a":2}` || string(commands[2].source) != `{"a":3}` {
+		t.Errorf("expected trimmed documents, including the final unterminated line; got %s, %s", commands[1].source, commands[2].source)
+	}
+}
+
+func TestIndexReaderReturnsParseErrorWithLine(t *testing.T) {
+	indexer, _ := newStubIndexer(t, okBulkHandler(t))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	indexed, err := indexer.IndexReader(context.Background(), "events", strings.NewReader("{\"a\":1}\n{\"a\":\n{\"a\":3}\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected a parse error at line 2; got %v", err)
+	}
+	if indexed != 1 {
+		t.Errorf("expected the documents preceding the invalid line to be enqueued; got %d", indexed)
+	}
+}
+
+// failingReader returns the given error from each read
+type failingReader struct {
+	err error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+func TestIndexReaderReturnsReadAndContextErrors(t *testing.T) {
+	indexer, _ := newStubIndexer(t, okBulkHandler(t))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	readErr := errors.New("connection reset")
+	if _, err := indexer.IndexReader(context.Background(), "events", &failingReader{err: readErr}); !errors.Is(err, readErr) || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("expected the read error to be wrapped; got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if indexed, err := indexer.IndexReader(ctx, "events", strings.NewReader("{\"a\":1}\n")); !errors.Is(err, context.Canceled) || indexed != 0 {
+		t.Errorf("expected context.Canceled before enqueueing; got %d, %v", indexed, err)
+	}
+}
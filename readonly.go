@@ -0,0 +1,85 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// readOnlyIndexErr returns a *ReadOnlyIndexError when the given bulk response item failed
+// as a result of a read-only index block, or nil otherwise
+func readOnlyIndexErr(item *elastic.BulkResponseItem) *ReadOnlyIndexError {
+	if item.Error == nil || item.Error.Type != "cluster_block_exception" {
+		return nil
+	}
+
+	reason := strings.ToLower(item.Error.Reason)
+	if !strings.Contains(reason, "read-only") && !strings.Contains(reason, "read_only") {
+		return nil
+	}
+
+	return &ReadOnlyIndexError{
+		Index:  item.Index,
+		Status: item.Status,
+		Reason: item.Error.Reason,
+	}
+}
+
+// ClearReadOnlyIndexBlock removes the read_only_allow_delete block from the given index, which
+// elasticsearch applies once the flood-stage disk watermark is exceeded
+func ClearReadOnlyIndexBlock(ctx context.Context, index string) error {
+	client, err := GetClient()
+	if err != nil {
+		return err
+	}
+
+	return clearReadOnlyIndexBlock(ctx, client, index)
+}
+
+func clearReadOnlyIndexBlock(ctx context.Context, client *elastic.Client, index string) error {
+	_, err := client.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method: "PUT",
+		Path:   fmt.Sprintf("/%s/_settings", url.PathEscape(index)),
+		Body: map[string]interface{}{
+			"index.blocks.read_only_allow_delete": nil,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to clear read-only block of elasticsearch index %s; %w", index, err)
+	}
+
+	log.Infof("cleared read-only block of elasticsearch index %s", index)
+	return nil
+}
+
+// handleReadOnlyIndex dead-letters the given message which failed as a result of a read-only index
+// block or, when enabled via WithReadOnlyIndexAutoClear, clears the block and retries the message
+func (indexer *Indexer) handleReadOnlyIndex(ctx context.Context, msg *Message, readOnlyErr *ReadOnlyIndexError, clearedIndices map[string]error) {
+	log.Warningf("indexer (%v) failed to index document; %s", indexer.identifier, readOnlyErr.Error())
+
+	if !indexer.clearReadOnly {
+		indexer.deadLetter(msg, readOnlyErr)
+		return
+	}
+
+	err, cleared := clearedIndices[readOnlyErr.Index]
+	if !cleared {
+		indexer.flushMutex.Lock()
+		client := indexer.client
+		indexer.flushMutex.Unlock()
+
+		err = clearReadOnlyIndexBlock(ctx, client, readOnlyErr.Index)
+		clearedIndices[readOnlyErr.Index] = err
+	}
+
+	if err != nil {
+		log.Warningf("indexer (%v) %s", indexer.identifier, err.Error())
+		indexer.deadLetter(msg, readOnlyErr)
+		return
+	}
+
+	indexer.retry(msg, readOnlyErr)
+}
@@ -0,0 +1,134 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+const floodStageReason = "index [full] blocked by: [TOO_MANY_REQUESTS/12/disk usage exceeded flood-stage watermark, index has read-only-allow-delete block];"
+
+// readOnlyIndexHandler returns a handler failing bulk actions targeting the full index as read-only
+// until its block is cleared
+func readOnlyIndexHandler(t *testing.T) stubHandler {
+	var mutex sync.Mutex
+	blocked := true
+	return func(req *stubRequest) (int, string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		switch {
+		case req.Method == http.MethodPut && req.Path == "/full/_settings":
+			blocked = false
+			return http.StatusOK, `{"acknowledged":true}`
+		case strings.HasSuffix(req.Path, "/_bulk"):
+			return stubBulkResponse(t, req, func(i int, command *bulkCommand) stubItem {
+				if blocked && command.meta["_index"] == "full" {
+					return stubItem{status: http.StatusTooManyRequests, errType: "cluster_block_exception", reason: floodStageReason}
+				}
+				return stubItem{}
+			})
+		}
+		return http.StatusOK, "{}"
+	}
+}
+
+func TestIndexerDeadLettersReadOnlyIndexFailures(t *testing.T) {
+	var dead deadLetters
+	indexer, transport := newStubIndexer(t, readOnlyIndexHandler(t), WithDeadLetterHandler(dead.handler()))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	if err := indexer.Q(testMessage("full", "1", `{"a":1}`)); err != nil {
+		t.Fatalf("failed to enqueue message; %s", err.Error())
+	}
+	waitIdle(t, indexer)
+
+	if dead.len() != 1 {
+		t.Fatalf("expected the document to be dead-lettered without retry; got %d dead-lettered", dead.len())
+	}
+	var readOnlyErr *ReadOnlyIndexError
+	if !errors.As(dead.reasons[0], &readOnlyErr) || readOnlyErr.Index != "full" || readOnlyErr.Status != http.StatusTooManyRequests {
+		t.Errorf("expected *ReadOnlyIndexError for index full; got %v", dead.reasons[0])
+	}
+	if len(transport.bulkRequests()) != 1 || len(transport.find(http.MethodPut, "/full/_settings")) != 0 {
+		t.Errorf("expected the block not to be cleared by default")
+	}
+}
+
+func TestWithReadOnlyIndexAutoClearClearsBlockAndRetries(t *testing.T) {
+	var dead deadLetters
+	indexer, transport := newStubIndexer(t, readOnlyIndexHandler(t),
+		WithReadOnlyIndexAutoClear(),
+		WithDeadLetterHandler(dead.handler()),
+		WithRetryBackoff(time.Millisecond, time.Millisecond),
+	)
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueAll(t, indexer, 3, testMessage("full", "1", `{"a":1}`), testMessage("full", "2", `{"a":2}`), testMessage("events", "3", `{"a":3}`))
+	waitIdle(t, indexer)
+
+	clears := transport.find(http.MethodPut, "/full/_settings")
+	if len(clears) != 1 {
+		t.Fatalf("expected the block to be cleared once for the batch; got %d", len(clears))
+	}
+	var body map[string]interface{}
+	if err := jsonCodec.Unmarshal(clears[0].Body, &body); err != nil {
+		t.Fatalf("failed to parse settings body; %s", err.Error())
+	}
+	if val, ok := body["index.blocks.read_only_allow_delete"]; !ok || val != nil {
+		t.Errorf("expected the read_only_allow_delete block to be reset; got %s", clears[0].Body)
+	}
+
+	if dead.len() != 0 {
+		t.Errorf("expected no dead-lettered documents; got %d", dead.len())
+	}
+	if stats := indexer.Stats(); stats.Indexed != 3 {
+		t.Errorf("expected every document to be indexed once retried; got %d", stats.Indexed)
+	}
+}
+
+func TestReadOnlyIndexErrIgnoresOtherFailures(t *testing.T) {
+	item := func(errType, reason string) *elastic.BulkResponseItem {
+		return &elastic.BulkResponseItem{Index: "full", Status: http.StatusForbidden, Error: &elastic.ErrorDetails{Type: errType, Reason: reason}}
+	}
+
+	if readOnlyIndexErr(item("cluster_block_exception", "index [full] blocked by: [FORBIDDEN/4/index closed];")) != nil {
+		t.Errorf("expected a closed index block not to be treated as read-only")
+	}
+	if readOnlyIndexErr(item("mapper_parsing_exception", "read-only field")) != nil {
+		t.Errorf("expected other failures not to be treated as read-only")
+	}
+	if readOnlyIndexErr(&elastic.BulkResponseItem{Index: "full", Status: http.StatusCreated}) != nil {
+		t.Errorf("expected a successful item not to be treated as read-only")
+	}
+	if readOnlyIndexErr(item("cluster_block_exception", "index [full] blocked by: [FORBIDDEN/8/index write (api)], index.blocks.read_only")) == nil {
+		t.Errorf("expected an explicit read_only block to be treated as read-only")
+	}
+}
+
+func TestClearReadOnlyIndexBlock(t *testing.T) {
+	transport, restore := useStubClient(t, readOnlyIndexHandler(t))
+	defer restore()
+
+	if err := ClearReadOnlyIndexBlock(context.Background(), "full"); err != nil {
+		t.Fatalf("failed to clear read-only block; %s", err.Error())
+	}
+	if clears := transport.find(http.MethodPut, "/full/_settings"); len(clears) != 1 {
+		t.Errorf("expected 1 settings request; got %d", len(clears))
+	}
+
+	transport.setHandler(func(req *stubRequest) (int, string) {
+		return http.StatusForbidden, `{"error":{"type":"security_exception","reason":"unauthorized"},"status":403}`
+	})
+	if err := ClearReadOnlyIndexBlock(context.Background(), "full"); err == nil || !strings.Contains(err.Error(), "failed to clear read-only block of elasticsearch index full") {
+		t.Errorf("expected the failure to be returned; got %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package elasticsearchutil
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+const defaultElasticsearchIndexerReconnectFailureThreshold = 3
+const defaultElasticsearchIndexerReconnectInitialBackoffMillis = 1000
+const defaultElasticsearchIndexerReconnectMaxBackoffMillis = 60000
+
+// isConnectivityErr returns true when the given error indicates the elasticsearch cluster is unreachable
+func isConnectivityErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	if elastic.IsConnErr(err) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// trackFlushErr records the outcome of a flush, starting the connection monitor
+// once the configured number of consecutive connectivity failures is reached
+func (indexer *Indexer) trackFlushErr(err error) {
+	indexer.flushMutex.Lock()
+	defer indexer.flushMutex.Unlock()
+
+	if !isConnectivityErr(err) {
+		indexer.connFailures = 0
+		return
+	}
+
+	indexer.connFailures++
+	if indexer.connFailures >= defaultElasticsearchIndexerReconnectFailureThreshold && !indexer.reconnecting {
+		log.Warningf("indexer (%v) observed %d consecutive connectivity failures; attempting to reconnect", indexer.identifier, indexer.connFailures)
+		indexer.reconnecting = true
+		go indexer.monitorConn()
+	}
+}
+
+// monitorConn rebuilds the elasticsearch client with exponential backoff, handing it off to
+// the run loop once healthy; the monitor exits early if the indexer is stopped
+func (indexer *Indexer) monitorConn() {
+	if indexer.clientURL == "" {
+		log.Warningf("indexer (%v) unable to reconnect; client url unknown", indexer.identifier)
+		return
+	}
+
+	backoff := elastic.NewExponentialBackoff(
+		time.Millisecond*time.Duration(defaultElasticsearchIndexerReconnectInitialBackoffMillis),
+		time.Millisecond*time.Duration(defaultElasticsearchIndexerReconnectMaxBackoffMillis),
+	)
+
+	for attempt := 1; ; attempt++ {
+		atomic.AddInt64(&indexer.stats.ReconnectAttempts, 1)
+
+		client, err := newElasticClient(indexer.clientURL)
+		if err == nil {
+			log.Infof("indexer (%v) reconnected to elasticsearch after %d attempt(s)", indexer.identifier, attempt)
+			select {
+			case indexer.reconnected <- client:
+			case <-indexer.done:
+				client.Stop()
+			}
+			return
+		}
+
+		wait, _ := backoff.Next(attempt)
+		log.Debugf("indexer (%v) reconnect attempt %d failed; retrying in %v; %s", indexer.identifier, attempt, wait, redactErr(err, indexer.clientURL))
+
+		select {
+		case <-time.After(wait):
+		case <-indexer.done:
+			return
+		}
+	}
+}
+
+// swapClient replaces the indexer client used by subsequent bulk requests; a replaced client previously
+// rebuilt by the connection monitor is stopped, whereas the configured elasticClients are shared by every
+// indexer and helper within the process, and are left running (and in place) when replaced
+func (indexer *Indexer) swapClient(client *elastic.Client) {
+	indexer.flushMutex.Lock()
+	defer indexer.flushMutex.Unlock()
+
+	// batches in flight using the replaced client complete, as stopping a client only stops its monitors
+	if indexer.ownsClient && indexer.client != nil {
+		indexer.client.Stop()
+	}
+
+	indexer.client = client
+	indexer.ownsClient = true
+	indexer.connFailures = 0
+	indexer.reconnecting = false
+
+	atomic.AddInt64(&indexer.stats.Reconnects, 1)
+	log.Debugf("indexer (%v) swapped in reconnected elasticsearch client", indexer.identifier)
+}
+
+// stopOwnedClient stops the client rebuilt by the connection monitor, if any, once the indexer is stopped
+func (indexer *Indexer) stopOwnedClient() {
+	indexer.flushMutex.Lock()
+	defer indexer.flushMutex.Unlock()
+
+	if indexer.ownsClient && indexer.client != nil {
+		indexer.client.Stop()
+	}
+}
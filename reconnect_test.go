@@ -0,0 +1,117 @@
+package elasticsearchutil
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+func TestIsConnectivityErr(t *testing.T) {
+	if isConnectivityErr(nil) {
+		t.Errorf("expected nil not to be a connectivity error")
+	}
+	if !isConnectivityErr(&net.OpError{Op: "dial", Err: errors.New("connection refused")}) {
+		t.Errorf("expected a net.Error to be a connectivity error")
+	}
+	if !isConnectivityErr(elastic.ErrNoClient) {
+		t.Errorf("expected elastic.ErrNoClient to be a connectivity error")
+	}
+	if isConnectivityErr(&elastic.Error{Status: http.StatusBadRequest}) {
+		t.Errorf("expected a bad request not to be a connectivity error")
+	}
+}
+
+func TestTrackFlushErrStartsMonitorAfterConsecutiveFailures(t *testing.T) {
+	indexer, _ := newStubIndexer(t, nil)
+	connErr := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+
+	indexer.trackFlushErr(connErr)
+	indexer.trackFlushErr(connErr)
+	indexer.trackFlushErr(errors.New("bad request"))
+	indexer.trackFlushErr(connErr)
+	if indexer.reconnecting {
+		t.Fatalf("expected non-consecutive failures not to start the monitor")
+	}
+
+	indexer.trackFlushErr(connErr)
+	indexer.trackFlushErr(connErr)
+	if !indexer.reconnecting {
+		t.Errorf("expected the monitor to start after %d consecutive failures", defaultElasticsearchIndexerReconnectFailureThreshold)
+	}
+}
+
+func TestSwapClientStopsOnlyClientsOwnedByIndexer(t *testing.T) {
+	shared, _ := newStubClient(t, nil)
+	indexer, err := newIndexer(shared, "")
+	if err != nil {
+		t.Fatalf("failed to initialize indexer; %s", err.Error())
+	}
+
+	rebuilt, _ := newStubClient(t, nil)
+	indexer.swapClient(rebuilt)
+	if !shared.IsRunning() {
+		t.Errorf("expected the shared client to be left running")
+	}
+
+	replacement, _ := newStubClient(t, nil)
+	indexer.swapClient(replacement)
+	if rebuilt.IsRunning() {
+		t.Errorf("expected the replaced client rebuilt by the monitor to be stopped")
+	}
+	if indexer.client != replacement || !replacement.IsRunning() {
+		t.Errorf("expected the replacement client to be swapped in")
+	}
+	if atomic.LoadInt64(&indexer.stats.Reconnects) != 2 {
+		t.Errorf("expected 2 reconnects; got %d", atomic.LoadInt64(&indexer.stats.Reconnects))
+	}
+}
+
+func TestIndexerReconnectsAfterConnectivityFailures(t *testing.T) {
+	// the rebuilt client is configured using the connection config, directed at a healthy stub
+	healthy := &stubTransport{}
+	healthy.setHandler(okBulkHandler(t))
+	restoreConfig := snapshotConfig()
+	defer restoreConfig()
+	elasticConnectionConfig = &connectionConfig{httpClient: &http.Client{Transport: healthy}}
+
+	unreachable := func(req *stubRequest) (int, string) {
+		if strings.HasSuffix(req.Path, "/_bulk") {
+			return 0, ""
+		}
+		return http.StatusOK, "{}"
+	}
+	client, dropped := newStubClient(t, unreachable)
+	indexer, err := newIndexer(client, mockElasticsearchURL, WithMaxRetries(20), WithRetryBackoff(10*time.Millisecond, 20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("failed to initialize indexer; %s", err.Error())
+	}
+	stop := runIndexer(indexer)
+	defer stop()
+
+	if err := indexer.Q(testMessage("events", "1", `{"a":1}`)); err != nil {
+		t.Fatalf("failed to enqueue message; %s", err.Error())
+	}
+	waitIdle(t, indexer)
+
+	// once its only node is marked dead, the dropped client fails subsequent requests without sending them
+	if len(dropped.bulkRequests()) == 0 {
+		t.Errorf("expected bulk requests to be attempted using the dropped client")
+	}
+	if len(healthy.bulkRequests()) == 0 {
+		t.Fatalf("expected the document to be sent using the reconnected client")
+	}
+
+	stats := indexer.Stats()
+	if stats.Reconnects != 1 || stats.ReconnectAttempts < 1 {
+		t.Errorf("expected 1 reconnect; got %d reconnects of %d attempts", stats.Reconnects, stats.ReconnectAttempts)
+	}
+	if stats.Indexed != 1 {
+		t.Errorf("expected the document to be indexed; got %d indexed", stats.Indexed)
+	}
+}
@@ -0,0 +1,67 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/olivere/elastic/v7"
+)
+
+func TestWithResponseRecorderDoesNotBlockIngestion(t *testing.T) {
+	release := make(chan struct{})
+	recorded := make(chan *elastic.BulkResponse, 2)
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithResponseRecorder(func(ctx context.Context, response *elastic.BulkResponse) {
+		<-release
+		recorded <- response
+	}))
+	stop := runIndexer(indexer)
+
+	for _, id := range []string{"1", "2"} {
+		enqueueAll(t, indexer, 1, testMessage("events", id, `{"a":1}`))
+		waitIdle(t, indexer)
+	}
+	if reqs := len(transport.bulkRequests()); reqs != 2 {
+		t.Fatalf("expected both bulk requests to be sent while recording is blocked; got %d", reqs)
+	}
+
+	var stopped int32
+	var recordedAtStop int
+	go func() {
+		stop()
+		recordedAtStop = len(recorded)
+		atomic.StoreInt32(&stopped, 1)
+	}()
+
+	// the recordings are released only once the indexer is shutting down, such that stopping must await them
+	<-indexer.done
+	close(release)
+	waitFor(t, "the indexer to stop", func() bool { return atomic.LoadInt32(&stopped) == 1 })
+
+	if recordedAtStop != 2 {
+		t.Fatalf("expected stopping the indexer to wait for the 2 pending recordings; got %d", recordedAtStop)
+	}
+	for i := 0; i < 2; i++ {
+		if response := <-recorded; len(response.Items) != 1 {
+			t.Errorf("expected the full bulk response to be recorded; got %d items", len(response.Items))
+		}
+	}
+}
+
+func TestWithResponseRecorderSkipsFailedRequests(t *testing.T) {
+	var recordings int32
+	indexer, _ := newStubIndexer(t, func(req *stubRequest) (int, string) {
+		return 0, ""
+	}, WithResponseRecorder(func(ctx context.Context, response *elastic.BulkResponse) {
+		atomic.AddInt32(&recordings, 1)
+	}), WithMaxRetries(0))
+	stop := runIndexer(indexer)
+
+	enqueueAll(t, indexer, 1, testMessage("events", "1", `{"a":1}`))
+	waitIdle(t, indexer)
+	stop()
+
+	if n := atomic.LoadInt32(&recordings); n != 0 {
+		t.Errorf("expected no recording of a failed bulk request; got %d", n)
+	}
+}
@@ -0,0 +1,80 @@
+package elasticsearchutil
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// RedactionMode determines how fields configured via WithFieldRedactor are redacted
+type RedactionMode int
+
+const (
+	// RedactRemove removes the redacted fields from the indexed document
+	RedactRemove RedactionMode = iota
+
+	// RedactMask replaces the value of the redacted fields with a mask
+	RedactMask
+)
+
+// redactedFieldMask is the value of fields redacted using RedactMask
+const redactedFieldMask = "****"
+
+// fieldRedactor removes or masks the configured fields of json object payloads prior to indexing
+type fieldRedactor struct {
+	paths [][]string
+	mode  RedactionMode
+}
+
+// redact returns the given payload with the configured fields redacted; payloads which are not
+// json objects, or which contain none of the configured fields, are returned unmodified
+func (r *fieldRedactor) redact(payload []byte) ([]byte, error) {
+	redacted := payload
+	for _, path := range r.paths {
+		val, changed, err := r.redactPath(redacted, path)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			redacted = val
+		}
+	}
+	return redacted, nil
+}
+
+// redactPath redacts the field at the given path, descending into nested objects; values are
+// held as raw json such that the remainder of the document is preserved as provided
+func (r *fieldRedactor) redactPath(doc []byte, path []string) ([]byte, bool, error) {
+	trimmed := strings.TrimSpace(string(doc))
+	if !strings.HasPrefix(trimmed, "{") {
+		return doc, false, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := jsonCodec.Unmarshal(doc, &fields); err != nil {
+		return nil, false, err
+	}
+
+	val, ok := fields[path[0]]
+	if !ok {
+		return doc, false, nil
+	}
+
+	if len(path) > 1 {
+		nested, changed, err := r.redactPath(val, path[1:])
+		if err != nil || !changed {
+			return doc, false, err
+		}
+		fields[path[0]] = nested
+	} else if r.mode == RedactMask {
+		mask, _ := jsonCodec.Marshal(redactedFieldMask)
+		fields[path[0]] = mask
+	} else {
+		delete(fields, path[0])
+	}
+
+	redacted, err := jsonCodec.Marshal(fields)
+	if err != nil {
+		return nil, false, err
+	}
+	return redacted, true, nil
+}
@@ -0,0 +1,89 @@
+package elasticsearchutil
+
+import (
+	"reflect"
+	"testing"
+)
+
+// redactedDocument parses the given redacted payload
+func redactedDocument(t *testing.T, payload []byte) map[string]interface{} {
+	t.Helper()
+
+	var doc map[string]interface{}
+	if err := jsonCodec.Unmarshal(payload, &doc); err != nil {
+		t.Fatalf("failed to parse redacted payload %s; %s", payload, err.Error())
+	}
+	return doc
+}
+
+func TestFieldRedactorRemovesFields(t *testing.T) {
+	redactor := &fieldRedactor{paths: [][]string{{"ssn"}, {"user", "email"}, {"missing"}}, mode: RedactRemove}
+
+	redacted, err := redactor.redact([]byte(`{"ssn":"123","user":{"name":"a","email":"a@b.c"},"n":1}`))
+	if err != nil {
+		t.Fatalf("failed to redact payload; %s", err.Error())
+	}
+
+	expected := map[string]interface{}{"user": map[string]interface{}{"name": "a"}, "n": float64(1)}
+	if doc := redactedDocument(t, redacted); !reflect.DeepEqual(doc, expected) {
+		t.Errorf("expected %v; got %v", expected, doc)
+	}
+}
+
+func TestFieldRedactorMasksFields(t *testing.T) {
+	redactor := &fieldRedactor{paths: [][]string{{"user", "email"}}, mode: RedactMask}
+
+	redacted, err := redactor.redact([]byte(`{"user":{"email":"a@b.c"}}`))
+	if err != nil {
+		t.Fatalf("failed to redact payload; %s", err.Error())
+	}
+
+	expected := map[string]interface{}{"user": map[string]interface{}{"email": redactedFieldMask}}
+	if doc := redactedDocument(t, redacted); !reflect.DeepEqual(doc, expected) {
+		t.Errorf("expected %v; got %v", expected, doc)
+	}
+}
+
+func TestFieldRedactorLeavesOtherPayloadsUnmodified(t *testing.T) {
+	redactor := &fieldRedactor{paths: [][]string{{"ssn"}, {"user", "email"}}, mode: RedactRemove}
+
+	for _, payload := range []string{`["ssn"]`, `"ssn"`, `{"n":1,  "user":"a"}`} {
+		redacted, err := redactor.redact([]byte(payload))
+		if err != nil {
+			t.Fatalf("failed to redact payload; %s", err.Error())
+		}
+		if string(redacted) != payload {
+			t.Errorf("expected payload %s to be unmodified; got %s", payload, redacted)
+		}
+	}
+}
+
+func TestWithFieldRedactorRedactsIndexedDocuments(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithFieldRedactor([]string{"user.email"}, RedactMask))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	if err := indexer.Q(testMessage("events", "1", `{"user":{"email":"a@b.c"}}`)); err != nil {
+		t.Fatalf("failed to enqueue message; %s", err.Error())
+	}
+	waitIdle(t, indexer)
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 1 {
+		t.Fatalf("expected 1 bulk action; got %d", len(commands))
+	}
+	if user, _ := redactedDocument(t, commands[0].source)["user"].(map[string]interface{}); user["email"] != redactedFieldMask {
+		t.Errorf("expected the email to be masked; got %s", commands[0].source)
+	}
+}
+
+func TestWithFieldRedactorRejectsInvalidFields(t *testing.T) {
+	for _, field := range []string{"", "user.", ".email", "user..email"} {
+		if _, err := newIndexer(nil, "", WithFieldRedactor([]string{field}, RedactRemove)); err == nil {
+			t.Errorf("expected redacted field %q to be rejected", field)
+		}
+	}
+	if _, err := newIndexer(nil, "", WithFieldRedactor([]string{"ssn"}, RedactionMode(7))); err == nil {
+		t.Errorf("expected invalid redaction mode to be rejected")
+	}
+}
@@ -0,0 +1,46 @@
+package elasticsearchutil
+
+// ShutdownReport lists the documents which failed or remained unflushed once the indexer began to
+// drain or stop, such that callers can persist them rather than silently losing them
+type ShutdownReport struct {
+	Failed []*ShutdownFailure `json:"failed"`
+}
+
+// ShutdownFailure describes a document which was dead-lettered while the indexer drained or stopped,
+// retaining its message such that it can be persisted or enqueued again
+type ShutdownFailure struct {
+	Index   string   `json:"index,omitempty"`
+	ID      string   `json:"id,omitempty"`
+	Reason  string   `json:"reason"`
+	Message *Message `json:"message,omitempty"`
+}
+
+// recordShutdownFailure adds the given dead-lettered message to the shutdown report
+func (indexer *Indexer) recordShutdownFailure(msg *Message, reason error) {
+	failure := &ShutdownFailure{
+		Reason:  reason.Error(),
+		Message: msg,
+	}
+	if msg.Header != nil {
+		if msg.Header.Index != nil {
+			failure.Index = *msg.Header.Index
+		}
+		if msg.Header.ID != nil {
+			failure.ID = *msg.Header.ID
+		}
+	}
+
+	indexer.reportMutex.Lock()
+	defer indexer.reportMutex.Unlock()
+	indexer.shutdownFailures = append(indexer.shutdownFailures, failure)
+}
+
+// shutdownReport returns the report of the documents which failed since the indexer began to drain or stop
+func (indexer *Indexer) shutdownReport() *ShutdownReport {
+	indexer.reportMutex.Lock()
+	defer indexer.reportMutex.Unlock()
+
+	failed := make([]*ShutdownFailure, len(indexer.shutdownFailures))
+	copy(failed, indexer.shutdownFailures)
+	return &ShutdownReport{Failed: failed}
+}
@@ -0,0 +1,185 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// defaultElasticsearchWriteBlockRestoreTimeoutMillis bounds restoring writes to the source of a resize,
+// which is attempted even once the context of the resize is done
+const defaultElasticsearchWriteBlockRestoreTimeoutMillis = 30000
+
+// CloneIndex clones the given source index into the given target index, applying the given settings
+// (if any) to the target; the source is blocked from writes for the duration of the clone, as required
+func CloneIndex(ctx context.Context, source, target string, settings map[string]interface{}) error {
+	client, err := GetClient()
+	if err != nil {
+		return err
+	}
+
+	return resizeIndex(ctx, client, "clone", source, target, settings)
+}
+
+// ShrinkIndex shrinks the given source index into the given target index with the given number of
+// primary shards, which must be a factor of the number of primary shards of the source; a copy of
+// every shard of the source must reside on the same node. The source is blocked from writes for the
+// duration of the shrink, as required.
+func ShrinkIndex(ctx context.Context, source, target string, shards int) error {
+	client, err := GetClient()
+	if err != nil {
+		return err
+	}
+
+	sourceShards, err := primaryShardCount(ctx, client, source)
+	if err != nil {
+		return err
+	}
+
+	if shards < 1 || shards >= sourceShards || sourceShards%shards != 0 {
+		return fmt.Errorf("failed to shrink elasticsearch index %s to %s; %d shards is not a factor of the %d source shards", source, target, shards, sourceShards)
+	}
+
+	return resizeIndex(ctx, client, "shrink", source, target, map[string]interface{}{
+		"index.number_of_shards": shards,
+	})
+}
+
+// SplitIndex splits the given source index into the given target index with the given number of
+// primary shards, which must be a multiple of the number of primary shards of the source; the source
+// is blocked from writes for the duration of the split, as required
+func SplitIndex(ctx context.Context, source, target string, shards int) error {
+	client, err := GetClient()
+	if err != nil {
+		return err
+	}
+
+	sourceShards, err := primaryShardCount(ctx, client, source)
+	if err != nil {
+		return err
+	}
+
+	if shards <= sourceShards || shards%sourceShards != 0 {
+		return fmt.Errorf("failed to split elasticsearch index %s to %s; %d shards is not a multiple of the %d source shards", source, target, shards, sourceShards)
+	}
+
+	return resizeIndex(ctx, client, "split", source, target, map[string]interface{}{
+		"index.number_of_shards": shards,
+	})
+}
+
+// primaryShardCount returns the number of primary shards of the given index
+func primaryShardCount(ctx context.Context, client *elastic.Client, index string) (int, error) {
+	resp, err := client.IndexGetSettings(index).Do(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get settings of elasticsearch index %s; %w", index, err)
+	}
+
+	settings, ok := resp[index]
+	if !ok || settings.Settings == nil {
+		return 0, fmt.Errorf("failed to get settings of elasticsearch index %s; index not found", index)
+	}
+
+	indexSettings, _ := settings.Settings["index"].(map[string]interface{})
+	shards, err := strconv.Atoi(fmt.Sprintf("%v", indexSettings["number_of_shards"]))
+	if err != nil || shards < 1 {
+		return 0, fmt.Errorf("failed to parse number of shards of elasticsearch index %s", index)
+	}
+
+	return shards, nil
+}
+
+// resizeIndex blocks writes to the given source index, performs the given resize op (i.e., clone or shrink)
+// into the given target index and restores writes to the source, regardless of the outcome; a source
+// already blocked from writes prior to the resize remains blocked
+func resizeIndex(ctx context.Context, client *elastic.Client, op, source, target string, settings map[string]interface{}) (err error) {
+	blocked, err := writeBlocked(ctx, client, source)
+	if err != nil {
+		return fmt.Errorf("failed to %s elasticsearch index %s to %s; %w", op, source, target, err)
+	}
+
+	if blocked {
+		log.Debugf("elasticsearch index %s already blocked from writes prior to %s", source, op)
+	} else {
+		if err := putWriteBlock(ctx, client, source, true); err != nil {
+			return fmt.Errorf("failed to %s elasticsearch index %s to %s; %w", op, source, target, err)
+		}
+		defer func() {
+			if restoreErr := restoreWrites(client, source); restoreErr != nil {
+				if err == nil {
+					err = restoreErr
+				}
+				log.Warningf("failed to restore writes to elasticsearch index %s after %s; %s", source, op, restoreErr.Error())
+			}
+		}()
+	}
+
+	// the target inherits the write block of the source unless overridden
+	targetSettings := map[string]interface{}{
+		"index.blocks.write": nil,
+	}
+	for key, val := range settings {
+		targetSettings[key] = val
+	}
+
+	_, err = client.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method: "POST",
+		Path:   fmt.Sprintf("/%s/_%s/%s", url.PathEscape(source), op, url.PathEscape(target)),
+		Body: map[string]interface{}{
+			"settings": targetSettings,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to %s elasticsearch index %s to %s; %w", op, source, target, err)
+	}
+
+	log.Debugf("performed %s of elasticsearch index %s to %s", op, source, target)
+	return nil
+}
+
+// restoreWrites removes the write block of the given index using a fresh context, such that writes
+// are restored even when the resize failed because its context is done
+func restoreWrites(client *elastic.Client, index string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*time.Duration(defaultElasticsearchWriteBlockRestoreTimeoutMillis))
+	defer cancel()
+
+	return putWriteBlock(ctx, client, index, false)
+}
+
+// writeBlocked returns true when writes to the given index are blocked
+func writeBlocked(ctx context.Context, client *elastic.Client, index string) (bool, error) {
+	resp, err := client.IndexGetSettings(index).Name("index.blocks.write").Do(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get write block of elasticsearch index %s; %w", index, err)
+	}
+
+	settings, ok := resp[index]
+	if !ok || settings.Settings == nil {
+		return false, nil
+	}
+
+	indexSettings, _ := settings.Settings["index"].(map[string]interface{})
+	blocks, _ := indexSettings["blocks"].(map[string]interface{})
+	return fmt.Sprintf("%v", blocks["write"]) == "true", nil
+}
+
+// putWriteBlock blocks or restores writes to the given index
+func putWriteBlock(ctx context.Context, client *elastic.Client, index string, blocked bool) error {
+	var val interface{}
+	if blocked {
+		val = true
+	}
+
+	_, err := client.IndexPutSettings(index).BodyJson(map[string]interface{}{
+		"index.blocks.write": val,
+	}).Do(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to set write block of elasticsearch index %s; %w", index, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,204 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// resizeHandler returns a handler responding to settings requests for the source index, reporting
+// whether it is blocked from writes and its number of primary shards, and to resize requests with the given status
+func resizeHandler(blocked bool, shards int, resizeStatus int) stubHandler {
+	return func(req *stubRequest) (int, string) {
+		switch {
+		case req.Method == http.MethodGet && strings.HasSuffix(req.Path, "/_settings/index.blocks.write"):
+			if blocked {
+				return http.StatusOK, `{"logs":{"settings":{"index":{"blocks":{"write":"true"}}}}}`
+			}
+			return http.StatusOK, `{"logs":{"settings":{}}}`
+		case req.Method == http.MethodGet && strings.HasSuffix(req.Path, "/_settings"):
+			return http.StatusOK, fmt.Sprintf(`{"logs":{"settings":{"index":{"number_of_shards":"%d"}}}}`, shards)
+		case req.Method == http.MethodPut && strings.HasSuffix(req.Path, "/_settings"):
+			return http.StatusOK, `{"acknowledged":true}`
+		case req.Method == http.MethodPost:
+			if resizeStatus != http.StatusOK {
+				return resizeStatus, fmt.Sprintf(`{"error":{"type":"illegal_state_exception","reason":"resize failed"},"status":%d}`, resizeStatus)
+			}
+			return http.StatusOK, `{"acknowledged":true,"shards_acknowledged":true,"index":"logs-clone"}`
+		}
+		return http.StatusNotFound, `{}`
+	}
+}
+
+// writeBlocks returns the write block sent by each recorded settings request for the given index, in order
+func writeBlocks(t *testing.T, transport *stubTransport, index string) []interface{} {
+	t.Helper()
+
+	blocks := make([]interface{}, 0)
+	for _, req := range transport.find(http.MethodPut, "/"+index+"/_settings") {
+		var body map[string]interface{}
+		if err := jsonCodec.Unmarshal(req.Body, &body); err != nil {
+			t.Fatalf("failed to parse settings body; %s", err.Error())
+		}
+		blocks = append(blocks, body["index.blocks.write"])
+	}
+	return blocks
+}
+
+// resizeSettings parses the target settings of the given resize request
+func resizeSettings(t *testing.T, req *stubRequest) map[string]interface{} {
+	t.Helper()
+
+	var body map[string]map[string]interface{}
+	if err := jsonCodec.Unmarshal(req.Body, &body); err != nil {
+		t.Fatalf("failed to parse resize body; %s", err.Error())
+	}
+	return body["settings"]
+}
+
+func TestCloneIndexBlocksWritesForDurationOfClone(t *testing.T) {
+	transport, restore := useStubClient(t, resizeHandler(false, 1, http.StatusOK))
+	defer restore()
+
+	if err := CloneIndex(context.Background(), "logs", "logs-clone", map[string]interface{}{"index.number_of_replicas": 0}); err != nil {
+		t.Fatalf("failed to clone index; %s", err.Error())
+	}
+
+	if blocks := writeBlocks(t, transport, "logs"); len(blocks) != 2 || blocks[0] != true || blocks[1] != nil {
+		t.Errorf("expected writes to the source to be blocked then restored; got %v", blocks)
+	}
+
+	clones := transport.find(http.MethodPost, "/logs/_clone/logs-clone")
+	if len(clones) != 1 {
+		t.Fatalf("expected 1 clone request; got %d", len(clones))
+	}
+	settings := resizeSettings(t, clones[0])
+	if val, ok := settings["index.blocks.write"]; !ok || val != nil {
+		t.Errorf("expected the inherited write block to be reset on the target; got %v", settings)
+	}
+	if settings["index.number_of_replicas"] != float64(0) {
+		t.Errorf("expected the given settings to be applied to the target; got %v", settings)
+	}
+}
+
+func TestCloneIndexRestoresWritesWhenCloneFails(t *testing.T) {
+	transport, restore := useStubClient(t, resizeHandler(false, 1, http.StatusBadRequest))
+	defer restore()
+
+	if err := CloneIndex(context.Background(), "logs", "logs-clone", nil); err == nil || !strings.Contains(err.Error(), "failed to clone elasticsearch index logs to logs-clone") {
+		t.Errorf("expected the clone failure to be returned; got %v", err)
+	}
+	if blocks := writeBlocks(t, transport, "logs"); len(blocks) != 2 || blocks[1] != nil {
+		t.Errorf("expected writes to the source to be restored; got %v", blocks)
+	}
+}
+
+func TestCloneIndexRestoresWritesOnceContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var stale int32
+	handler := resizeHandler(false, 1, http.StatusOK)
+	transport, restore := useStubClient(t, func(req *stubRequest) (int, string) {
+		// failing requests whose context is done, as a transport would
+		if req.ctx.Err() != nil {
+			atomic.AddInt32(&stale, 1)
+			return http.StatusServiceUnavailable, `{}`
+		}
+		if req.Method == http.MethodPost {
+			cancel()
+			return http.StatusServiceUnavailable, `{}`
+		}
+		return handler(req)
+	})
+	defer restore()
+
+	if err := CloneIndex(ctx, "logs", "logs-clone", nil); err == nil {
+		t.Errorf("expected the clone failure to be returned")
+	}
+	if blocks := writeBlocks(t, transport, "logs"); len(blocks) != 2 || blocks[1] != nil {
+		t.Errorf("expected writes to the source to be restored; got %v", blocks)
+	}
+	if n := atomic.LoadInt32(&stale); n != 0 {
+		t.Errorf("expected writes to be restored using a fresh context; got %d request(s) sent using the done context", n)
+	}
+}
+
+func TestCloneIndexKeepsPreexistingWriteBlock(t *testing.T) {
+	transport, restore := useStubClient(t, resizeHandler(true, 1, http.StatusOK))
+	defer restore()
+
+	if err := CloneIndex(context.Background(), "logs", "logs-clone", nil); err != nil {
+		t.Fatalf("failed to clone index; %s", err.Error())
+	}
+	if blocks := writeBlocks(t, transport, "logs"); len(blocks) != 0 {
+		t.Errorf("expected the write block of the source to be left in place; got %v", blocks)
+	}
+	if clones := transport.find(http.MethodPost, "/logs/_clone/logs-clone"); len(clones) != 1 {
+		t.Errorf("expected 1 clone request; got %d", len(clones))
+	}
+}
+
+func TestShrinkIndexValidatesTargetShardCount(t *testing.T) {
+	transport, restore := useStubClient(t, resizeHandler(false, 6, http.StatusOK))
+	defer restore()
+
+	for _, shards := range []int{0, 4, 6, 12} {
+		if err := ShrinkIndex(context.Background(), "logs", "logs-shrunk", shards); err == nil || !strings.Contains(err.Error(), "is not a factor of the 6 source shards") {
+			t.Errorf("expected shrinking to %d shards to be rejected; got %v", shards, err)
+		}
+	}
+	if reqs := transport.find(http.MethodPut, "/logs/_settings"); len(reqs) != 0 {
+		t.Fatalf("expected writes not to be blocked for an invalid shrink; got %d settings requests", len(reqs))
+	}
+
+	if err := ShrinkIndex(context.Background(), "logs", "logs-shrunk", 3); err != nil {
+		t.Fatalf("failed to shrink index; %s", err.Error())
+	}
+	shrinks := transport.find(http.MethodPost, "/logs/_shrink/logs-shrunk")
+	if len(shrinks) != 1 {
+		t.Fatalf("expected 1 shrink request; got %d", len(shrinks))
+	}
+	if settings := resizeSettings(t, shrinks[0]); settings["index.number_of_shards"] != float64(3) {
+		t.Errorf("expected the target shard count to be sent; got %s", shrinks[0].Body)
+	}
+	if blocks := writeBlocks(t, transport, "logs"); len(blocks) != 2 || blocks[0] != true || blocks[1] != nil {
+		t.Errorf("expected writes to the source to be blocked then restored; got %v", blocks)
+	}
+}
+
+func TestSplitIndexValidatesTargetShardCount(t *testing.T) {
+	transport, restore := useStubClient(t, resizeHandler(false, 2, http.StatusOK))
+	defer restore()
+
+	for _, shards := range []int{1, 2, 5} {
+		if err := SplitIndex(context.Background(), "logs", "logs-split", shards); err == nil || !strings.Contains(err.Error(), "is not a multiple of the 2 source shards") {
+			t.Errorf("expected splitting to %d shards to be rejected; got %v", shards, err)
+		}
+	}
+
+	if err := SplitIndex(context.Background(), "logs", "logs-split", 8); err != nil {
+		t.Fatalf("failed to split index; %s", err.Error())
+	}
+	splits := transport.find(http.MethodPost, "/logs/_split/logs-split")
+	if len(splits) != 1 {
+		t.Fatalf("expected 1 split request; got %d", len(splits))
+	}
+	if settings := resizeSettings(t, splits[0]); settings["index.number_of_shards"] != float64(8) {
+		t.Errorf("expected the target shard count to be sent; got %s", splits[0].Body)
+	}
+}
+
+func TestPrimaryShardCountRequiresIndexSettings(t *testing.T) {
+	_, restore := useStubClient(t, func(req *stubRequest) (int, string) {
+		return http.StatusOK, `{"other":{"settings":{}}}`
+	})
+	defer restore()
+
+	if err := SplitIndex(context.Background(), "logs", "logs-split", 2); err == nil || !strings.Contains(err.Error(), "index not found") {
+		t.Errorf("expected missing settings to be reported; got %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+const defaultElasticsearchIndexerMaxRetries = 3
+const defaultElasticsearchIndexerRetryBufferSize = 64
+const defaultElasticsearchIndexerRetryBackoffMillis = 100
+const defaultElasticsearchIndexerMaxRetryBackoffMillis = 10000
+
+// DeadLetterHandler is invoked with each message which could not be indexed, along with the reason
+type DeadLetterHandler func(msg *Message, err error)
+
+// RetryClassifier decides whether a failure with the given http status and reason is transient
+// and should be retried; a status of zero indicates no response was received (i.e., network failure)
+type RetryClassifier func(status int, reason string) bool
+
+// DefaultRetryClassifier retries network failures and 429 (too many requests) and 503 (service unavailable) responses
+func DefaultRetryClassifier(status int, reason string) bool {
+	return status == 0 || status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// isRetryableErr consults the configured classifier to decide whether the given bulk request error is transient
+func (indexer *Indexer) isRetryableErr(err error) bool {
+	var esErr *elastic.Error
+	if errors.As(err, &esErr) {
+		reason := esErr.Error()
+		if esErr.Details != nil {
+			reason = esErr.Details.Reason
+		}
+		return indexer.retryClassifier(esErr.Status, reason)
+	}
+	if isConnectivityErr(err) || errors.Is(err, context.DeadlineExceeded) {
+		return indexer.retryClassifier(0, err.Error())
+	}
+	return false
+}
+
+// isRetryableItem consults the configured classifier to decide whether the given failed bulk response item is transient
+func (indexer *Indexer) isRetryableItem(item *elastic.BulkResponseItem) bool {
+	reason := ""
+	if item.Error != nil {
+		reason = item.Error.Reason
+	}
+	return indexer.retryClassifier(item.Status, reason)
+}
+
+// retry places the given message in the bounded retry buffer; messages which have exhausted
+// their retries, or which do not fit in the retry buffer, are routed to the dead-letter handler
+func (indexer *Indexer) retry(msg *Message, reason error) {
+	msg.attempts++
+	if msg.attempts > indexer.maxRetries {
+		indexer.deadLetter(msg, fmt.Errorf("exhausted %d retries; %w", indexer.maxRetries, reason))
+		return
+	}
+
+	// the messages awaiting their backoff count against the retry buffer, such that queueing never blocks
+	if atomic.AddInt64(&indexer.retrying, 1) > int64(cap(indexer.retryQ)) {
+		atomic.AddInt64(&indexer.retrying, -1)
+		indexer.deadLetter(msg, &queueFullError{buffer: "retry buffer", reason: reason})
+		return
+	}
+
+	backoff := indexer.retryDelay(msg.attempts)
+	msg.notBefore = time.Now().Add(backoff)
+	indexer.retryQ <- msg
+	log.Debugf("indexer (%v) queued %d-byte document for retry attempt %d in %v; %s", indexer.identifier, len(msg.Payload), msg.attempts, backoff, reason.Error())
+}
+
+// retryDelay returns the backoff preceding the given retry attempt, doubling with each attempt up to the configured max
+func (indexer *Indexer) retryDelay(attempt int) time.Duration {
+	delay := indexer.retryBackoff
+	for i := 1; i < attempt && delay < indexer.maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > indexer.maxRetryBackoff {
+		delay = indexer.maxRetryBackoff
+	}
+	return delay
+}
+
+// handleRetry indexes the given retried message once its backoff has elapsed, otherwise
+// holding it in the retry backlog
+func (indexer *Indexer) handleRetry(msg *Message) {
+	if time.Now().Before(msg.notBefore) {
+		indexer.retryBacklog = append(indexer.retryBacklog, msg)
+		return
+	}
+
+	atomic.AddInt64(&indexer.retrying, -1)
+	indexer.handle(msg)
+}
+
+// handleDueRetries indexes the messages of the retry backlog whose backoff has elapsed
+func (indexer *Indexer) handleDueRetries() {
+	if len(indexer.retryBacklog) == 0 {
+		return
+	}
+
+	now := time.Now()
+	waiting := indexer.retryBacklog[:0]
+	due := make([]*Message, 0)
+	for _, msg := range indexer.retryBacklog {
+		if now.Before(msg.notBefore) {
+			waiting = append(waiting, msg)
+		} else {
+			due = append(due, msg)
+		}
+	}
+	indexer.retryBacklog = waiting
+
+	for _, msg := range due {
+		atomic.AddInt64(&indexer.retrying, -1)
+		indexer.handle(msg)
+	}
+}
+
+// idleInterval returns the interval the run loop sleeps when idle, shortened such that
+// the retry backlog is handled once the earliest backoff elapses
+func (indexer *Indexer) idleInterval() time.Duration {
+	interval := indexer.sleepInterval
+	for _, msg := range indexer.retryBacklog {
+		if wait := time.Until(msg.notBefore); wait < interval {
+			interval = wait
+		}
+	}
+	if interval < 0 {
+		interval = 0
+	}
+	return interval
+}
+
+// deadLetter hands the given message to the configured dead-letter handler
+func (indexer *Indexer) deadLetter(msg *Message, reason error) {
+	log.Warningf("indexer (%v) dead-lettered %d-byte document; %s", indexer.identifier, len(msg.Payload), reason.Error())
+	if indexer.deadLetterHandler != nil {
+		indexer.deadLetterHandler(msg, reason)
+	}
+	indexer.spoolFailure(msg)
+	if atomic.LoadInt32(&indexer.draining) == 1 {
+		indexer.recordShutdownFailure(msg, reason)
+	}
+	indexer.settle(msg, reason)
+}
@@ -0,0 +1,235 @@
+package elasticsearchutil
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// deadLetters records the messages handed to a DeadLetterHandler
+type deadLetters struct {
+	mutex    sync.Mutex
+	messages []*Message
+	reasons  []error
+}
+
+// handler returns a DeadLetterHandler recording each dead-lettered message
+func (d *deadLetters) handler() DeadLetterHandler {
+	return func(msg *Message, err error) {
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+		d.messages = append(d.messages, msg)
+		d.reasons = append(d.reasons, err)
+	}
+}
+
+// len returns the number of dead-lettered messages
+func (d *deadLetters) len() int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return len(d.messages)
+}
+
+// failingBulkHandler returns a handler failing each bulk action with the given status the given number of times, then acknowledging it
+func failingBulkHandler(t *testing.T, status int, failures int) stubHandler {
+	var mutex sync.Mutex
+	attempts := 0
+	return func(req *stubRequest) (int, string) {
+		if !strings.HasSuffix(req.Path, "/_bulk") {
+			return http.StatusOK, "{}"
+		}
+		mutex.Lock()
+		attempts++
+		failed := attempts <= failures
+		mutex.Unlock()
+
+		return stubBulkResponse(t, req, func(i int, command *bulkCommand) stubItem {
+			if failed {
+				return stubItem{status: status, errType: "es_rejected_execution_exception", reason: "rejected"}
+			}
+			return stubItem{}
+		})
+	}
+}
+
+func TestDefaultRetryClassifier(t *testing.T) {
+	for _, status := range []int{0, http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+		if !DefaultRetryClassifier(status, "") {
+			t.Errorf("expected status %d to be retried", status)
+		}
+	}
+	for _, status := range []int{http.StatusBadRequest, http.StatusConflict, http.StatusInternalServerError} {
+		if DefaultRetryClassifier(status, "") {
+			t.Errorf("expected status %d not to be retried", status)
+		}
+	}
+}
+
+func TestIndexerRetriesTransientFailures(t *testing.T) {
+	var dead deadLetters
+	indexer, transport := newStubIndexer(t, failingBulkHandler(t, http.StatusTooManyRequests, 2),
+		WithDeadLetterHandler(dead.handler()),
+		WithRetryBackoff(20*time.Millisecond, time.Second),
+	)
+	stop := runIndexer(indexer)
+	defer stop()
+
+	startedAt := time.Now()
+	if err := indexer.Q(testMessage("events", "1", `{"a":1}`)); err != nil {
+		t.Fatalf("failed to enqueue message; %s", err.Error())
+	}
+	waitIdle(t, indexer)
+
+	if reqs := len(transport.bulkRequests()); reqs != 3 {
+		t.Errorf("expected 3 bulk requests; got %d", reqs)
+	}
+	// the retries back off 20ms, then 40ms
+	if elapsed := time.Since(startedAt); elapsed < 60*time.Millisecond {
+		t.Errorf("expected the retries to back off; took %v", elapsed)
+	}
+	if dead.len() != 0 {
+		t.Errorf("expected no dead-lettered documents; got %d", dead.len())
+	}
+	if stats := indexer.Stats(); stats.Indexed != 1 {
+		t.Errorf("expected the document to be indexed; got %d indexed", stats.Indexed)
+	}
+}
+
+func TestIndexerDeadLettersDocumentsExhaustingRetries(t *testing.T) {
+	var dead deadLetters
+	indexer, transport := newStubIndexer(t, failingBulkHandler(t, http.StatusTooManyRequests, 100),
+		WithDeadLetterHandler(dead.handler()),
+		WithMaxRetries(2),
+		WithRetryBackoff(time.Millisecond, time.Millisecond),
+	)
+	stop := runIndexer(indexer)
+	defer stop()
+
+	if err := indexer.Q(testMessage("events", "1", `{"a":1}`)); err != nil {
+		t.Fatalf("failed to enqueue message; %s", err.Error())
+	}
+	waitIdle(t, indexer)
+
+	if reqs := len(transport.bulkRequests()); reqs != 3 {
+		t.Errorf("expected the initial attempt and 2 retries; got %d bulk requests", reqs)
+	}
+	if dead.len() != 1 {
+		t.Fatalf("expected 1 dead-lettered document; got %d", dead.len())
+	}
+	if !strings.Contains(dead.reasons[0].Error(), "exhausted 2 retries") {
+		t.Errorf("expected the document to be dead-lettered after exhausting its retries; got %s", dead.reasons[0].Error())
+	}
+}
+
+func TestIndexerDeadLettersPermanentFailuresWithoutRetry(t *testing.T) {
+	var dead deadLetters
+	indexer, transport := newStubIndexer(t, failingBulkHandler(t, http.StatusBadRequest, 100), WithDeadLetterHandler(dead.handler()))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	if err := indexer.Q(testMessage("events", "1", `{"a":1}`)); err != nil {
+		t.Fatalf("failed to enqueue message; %s", err.Error())
+	}
+	waitIdle(t, indexer)
+
+	if reqs := len(transport.bulkRequests()); reqs != 1 {
+		t.Errorf("expected 1 bulk request; got %d", reqs)
+	}
+	if dead.len() != 1 {
+		t.Errorf("expected 1 dead-lettered document; got %d", dead.len())
+	}
+}
+
+func TestRetryDeadLettersDocumentsNotFittingRetryBuffer(t *testing.T) {
+	var dead deadLetters
+	indexer, _ := newStubIndexer(t, nil, WithDeadLetterHandler(dead.handler()), WithRetryBufferSize(1))
+
+	reason := errors.New("rejected")
+	indexer.retry(testMessage("events", "1", `{"a":1}`), reason)
+	indexer.retry(testMessage("events", "2", `{"a":2}`), reason)
+
+	if len(indexer.retryQ) != 1 {
+		t.Errorf("expected 1 document in the retry buffer; got %d", len(indexer.retryQ))
+	}
+	if dead.len() != 1 || *dead.messages[0].Header.ID != "2" {
+		t.Fatalf("expected the document not fitting the retry buffer to be dead-lettered")
+	}
+	if !errors.Is(dead.reasons[0], ErrQueueFull) {
+		t.Errorf("expected ErrQueueFull; got %v", dead.reasons[0])
+	}
+}
+
+func TestRetryDelayDoublesUpToMax(t *testing.T) {
+	indexer, _ := newStubIndexer(t, nil, WithRetryBackoff(100*time.Millisecond, 500*time.Millisecond))
+
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 500 * time.Millisecond, 500 * time.Millisecond}
+	for i, delay := range expected {
+		if actual := indexer.retryDelay(i + 1); actual != delay {
+			t.Errorf("expected %v backoff preceding attempt %d; got %v", delay, i+1, actual)
+		}
+	}
+}
+
+func TestWithRetryClassifierDecidesRetryableFailures(t *testing.T) {
+	var mutex sync.Mutex
+	classified := make([]string, 0)
+	classifier := func(status int, reason string) bool {
+		mutex.Lock()
+		classified = append(classified, reason)
+		mutex.Unlock()
+		return status == http.StatusForbidden
+	}
+
+	var dead deadLetters
+	indexer, transport := newStubIndexer(t, failingBulkHandler(t, http.StatusForbidden, 1),
+		WithRetryClassifier(classifier),
+		WithDeadLetterHandler(dead.handler()),
+		WithRetryBackoff(time.Millisecond, time.Millisecond),
+	)
+	stop := runIndexer(indexer)
+	defer stop()
+
+	if err := indexer.Q(testMessage("events", "1", `{"a":1}`)); err != nil {
+		t.Fatalf("failed to enqueue message; %s", err.Error())
+	}
+	waitIdle(t, indexer)
+
+	if reqs := len(transport.bulkRequests()); reqs != 2 {
+		t.Errorf("expected the failure classified as retryable to be retried; got %d bulk requests", reqs)
+	}
+	if dead.len() != 0 {
+		t.Errorf("expected no dead-lettered documents; got %d", dead.len())
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(classified) != 1 || classified[0] != "rejected" {
+		t.Errorf("expected the classifier to be consulted with the failure reason; got %v", classified)
+	}
+}
+
+func TestWithRetryClassifierRejectsNil(t *testing.T) {
+	if _, err := newIndexer(nil, "", WithRetryClassifier(nil)); err == nil {
+		t.Errorf("expected nil retry classifier to be rejected")
+	}
+}
+
+func TestIsRetryableErrConsultsClassifierForRequestErrors(t *testing.T) {
+	indexer, _ := newStubIndexer(t, nil, WithRetryClassifier(func(status int, reason string) bool {
+		return status == http.StatusBadGateway
+	}))
+
+	if !indexer.isRetryableErr(&elastic.Error{Status: http.StatusBadGateway}) {
+		t.Errorf("expected 502 classified as retryable to be retried")
+	}
+	if indexer.isRetryableErr(&elastic.Error{Status: http.StatusTooManyRequests}) {
+		t.Errorf("expected 429 classified as permanent not to be retried")
+	}
+	if indexer.isRetryableErr(errors.New("unexpected")) {
+		t.Errorf("expected an unclassifiable error not to be retried")
+	}
+}
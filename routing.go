@@ -0,0 +1,43 @@
+package elasticsearchutil
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// payloadField returns the string value of the field at the given path of the json object payload
+// (i.e., a tenant_id); numeric and boolean values are returned as their json representation, and nil
+// is returned if the field is missing, null, an object or an array
+func payloadField(payload []byte, path []string) *string {
+	doc := json.RawMessage(payload)
+	for _, key := range path {
+		if !strings.HasPrefix(strings.TrimSpace(string(doc)), "{") {
+			return nil
+		}
+
+		var fields map[string]json.RawMessage
+		if err := jsonCodec.Unmarshal(doc, &fields); err != nil {
+			return nil
+		}
+
+		val, ok := fields[key]
+		if !ok {
+			return nil
+		}
+		doc = val
+	}
+
+	val := strings.TrimSpace(string(doc))
+	switch {
+	case val == "" || val == "null" || strings.HasPrefix(val, "{") || strings.HasPrefix(val, "["):
+		return nil
+	case strings.HasPrefix(val, "\""):
+		var str string
+		if err := jsonCodec.Unmarshal(doc, &str); err != nil {
+			return nil
+		}
+		return stringOrNil(str)
+	}
+
+	return &val
+}
@@ -0,0 +1,73 @@
+package elasticsearchutil
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPayloadField(t *testing.T) {
+	payload := []byte(`{"tenant":{"id":"acme","shard":7,"active":true,"tags":["a"],"owner":null},"empty":""}`)
+
+	expected := map[string]*string{
+		"tenant.id":     stringOrNil("acme"),
+		"tenant.shard":  stringOrNil("7"),
+		"tenant.active": stringOrNil("true"),
+		"tenant.tags":   nil,
+		"tenant.owner":  nil,
+		"tenant":        nil,
+		"tenant.id.x":   nil,
+		"missing":       nil,
+		"empty":         nil,
+	}
+	for path, want := range expected {
+		got := payloadField(payload, strings.Split(path, "."))
+		if (got == nil) != (want == nil) || (got != nil && *got != *want) {
+			t.Errorf("expected %s to be %v; got %v", path, stringValue(want), stringValue(got))
+		}
+	}
+
+	if payloadField([]byte(`not json`), []string{"tenant"}) != nil {
+		t.Errorf("expected nil for a payload which is not a json object")
+	}
+}
+
+// stringValue returns the value of the given string, or <nil>
+func stringValue(str *string) string {
+	if str == nil {
+		return "<nil>"
+	}
+	return *str
+}
+
+func TestWithRoutingFieldRoutesDocumentsByPayloadField(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithRoutingField("tenant.id"))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	routed := testMessage("orders", "1", `{"tenant":{"id":"acme"}}`)
+	explicit := testMessage("orders", "2", `{"tenant":{"id":"acme"}}`)
+	explicit.Header.Routing = stringOrNil("override")
+	unrouted := testMessage("events", "3", `{"a":1}`)
+	enqueueAll(t, indexer, 3, routed, explicit, unrouted)
+	waitIdle(t, indexer)
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 3 {
+		t.Fatalf("expected 3 bulk actions; got %d", len(commands))
+	}
+	if routing := commands[0].meta["routing"]; routing != "acme" {
+		t.Errorf("expected routing derived from the payload; got %v", routing)
+	}
+	if routing := commands[1].meta["routing"]; routing != "override" {
+		t.Errorf("expected the header routing to take precedence; got %v", routing)
+	}
+	if routing, ok := commands[2].meta["routing"]; ok {
+		t.Errorf("expected a document missing the field not to be routed; got %v", routing)
+	}
+}
+
+func TestWithRoutingFieldRejectsEmptyPath(t *testing.T) {
+	if _, err := newIndexer(nil, "", WithRoutingField("")); err == nil {
+		t.Errorf("expected empty routing field to be rejected")
+	}
+}
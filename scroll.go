@@ -0,0 +1,91 @@
+package elasticsearchutil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+const defaultElasticsearchScrollSize = 1000
+const defaultElasticsearchScrollKeepAliveMillis = 60000
+
+// defaultElasticsearchScrollClearTimeoutMillis bounds clearing the scroll context once scrolling ends,
+// which is attempted even once the context of the scroll is done
+const defaultElasticsearchScrollClearTimeoutMillis = 5000
+
+// Scroll invokes the given callback for each document in the given index matching the given query,
+// scrolling through the results in pages; the scroll is aborted when the callback returns an error
+func Scroll(ctx context.Context, index string, query elastic.Query, fn func(hit *elastic.SearchHit) error) error {
+	client, err := GetClient()
+	if err != nil {
+		return err
+	}
+
+	svc := client.Scroll(index).
+		Size(defaultElasticsearchScrollSize).
+		KeepAlive(formatKeepAlive(time.Millisecond * time.Duration(defaultElasticsearchScrollKeepAliveMillis)))
+	if query != nil {
+		svc.Query(query)
+	}
+	defer func() {
+		clearCtx, cancel := context.WithTimeout(context.Background(), time.Millisecond*time.Duration(defaultElasticsearchScrollClearTimeoutMillis))
+		defer cancel()
+		svc.Clear(clearCtx)
+	}()
+
+	for {
+		result, err := svc.Do(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to scroll elasticsearch index %s; %w", index, err)
+		}
+
+		if result.Hits == nil {
+			return nil
+		}
+
+		for _, hit := range result.Hits.Hits {
+			if err := fn(hit); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ExportIndex writes the source of each document in the given index matching the given query to
+// the given writer as newline-delimited json (i.e., for backup, or ingest using IndexReader),
+// returning the number of documents written
+func ExportIndex(ctx context.Context, index string, query elastic.Query, w io.Writer) (int, error) {
+	exported := 0
+	err := Scroll(ctx, index, query, func(hit *elastic.SearchHit) error {
+		if hit.Source == nil {
+			return nil
+		}
+
+		// compacted as the stored source may span multiple lines
+		var line bytes.Buffer
+		if err := json.Compact(&line, hit.Source); err != nil {
+			return fmt.Errorf("failed to export document %s of elasticsearch index %s; %w", hit.Id, index, err)
+		}
+		line.WriteByte('\n')
+
+		if _, err := w.Write(line.Bytes()); err != nil {
+			return fmt.Errorf("failed to export document %s of elasticsearch index %s; %w", hit.Id, index, err)
+		}
+		exported++
+		return nil
+	})
+	if err != nil {
+		return exported, err
+	}
+
+	log.Debugf("exported %d document(s) from elasticsearch index %s", exported, index)
+	return exported, nil
+}
@@ -0,0 +1,115 @@
+package elasticsearchutil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// scrollHandler returns a handler responding to scroll requests with each of the given pages of
+// hits in turn, followed by an empty page
+func scrollHandler(pages ...string) stubHandler {
+	var mutex sync.Mutex
+	scrolled := 0
+	return func(req *stubRequest) (int, string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		switch {
+		case req.Method == http.MethodDelete && req.Path == "/_search/scroll":
+			return http.StatusOK, `{"succeeded":true,"num_freed":1}`
+		case strings.HasSuffix(req.Path, "/_search") || strings.HasSuffix(req.Path, "/_search/scroll"):
+			hits := `[]`
+			if scrolled < len(pages) {
+				hits = pages[scrolled]
+			}
+			scrolled++
+			return http.StatusOK, `{"_scroll_id":"scroll-1","took":1,"hits":{"total":{"value":3,"relation":"eq"},"hits":` + hits + `}}`
+		}
+		return http.StatusNotFound, `{}`
+	}
+}
+
+func TestScrollVisitsEachPage(t *testing.T) {
+	transport, restore := useStubClient(t, scrollHandler(
+		`[{"_index":"logs","_id":"1","_source":{}},{"_index":"logs","_id":"2","_source":{}}]`,
+		`[{"_index":"logs","_id":"3","_source":{}}]`,
+	))
+	defer restore()
+
+	ids := make([]string, 0)
+	err := Scroll(context.Background(), "logs", elastic.NewTermQuery("level", "warn"), func(hit *elastic.SearchHit) error {
+		ids = append(ids, hit.Id)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to scroll; %s", err.Error())
+	}
+	if strings.Join(ids, ",") != "1,2,3" {
+		t.Errorf("expected each hit in order; got %v", ids)
+	}
+
+	searches := transport.find(http.MethodPost, "/logs/_search")
+	if len(searches) != 1 {
+		t.Fatalf("expected 1 initial search request; got %d", len(searches))
+	}
+	if searches[0].Query.Get("scroll") == "" || searches[0].Query.Get("size") != "1000" {
+		t.Errorf("expected the scroll keep alive and page size to be sent; got %v", searches[0].Query)
+	}
+	if _, ok := searchBody(t, searches[0])["query"]; !ok {
+		t.Errorf("expected the query to be sent")
+	}
+	clears := transport.find(http.MethodDelete, "/_search/scroll")
+	if len(clears) != 1 {
+		t.Fatalf("expected the scroll to be cleared; got %d clear requests", len(clears))
+	}
+	if _, ok := clears[0].ctx.Deadline(); !ok {
+		t.Errorf("expected clearing the scroll to be bounded by a deadline")
+	}
+}
+
+func TestScrollAbortsOnCallbackError(t *testing.T) {
+	transport, restore := useStubClient(t, scrollHandler(
+		`[{"_index":"logs","_id":"1","_source":{}}]`,
+		`[{"_index":"logs","_id":"2","_source":{}}]`,
+	))
+	defer restore()
+
+	abort := errors.New("abort")
+	if err := Scroll(context.Background(), "logs", nil, func(hit *elastic.SearchHit) error { return abort }); err != abort {
+		t.Errorf("expected the callback error to be returned; got %v", err)
+	}
+	if scrolls := transport.find(http.MethodPost, "/_search/scroll"); len(scrolls) != 0 {
+		t.Errorf("expected no further pages to be requested; got %d", len(scrolls))
+	}
+	if clears := transport.find(http.MethodDelete, "/_search/scroll"); len(clears) != 1 {
+		t.Errorf("expected the scroll to be cleared; got %d clear requests", len(clears))
+	}
+}
+
+func TestExportIndexWritesCompactedNDJSON(t *testing.T) {
+	_, restore := useStubClient(t, scrollHandler(
+		`[{"_index":"logs","_id":"1","_source":{ "a" : 1,
+		"b": [1, 2] }},{"_index":"logs","_id":"2"}]`,
+		`[{"_index":"logs","_id":"3","_source":{"a":3}}]`,
+	))
+	defer restore()
+
+	var buf bytes.Buffer
+	exported, err := ExportIndex(context.Background(), "logs", nil, &buf)
+	if err != nil {
+		t.Fatalf("failed to export index; %s", err.Error())
+	}
+	if exported != 2 {
+		t.Errorf("expected the 2 documents with a source to be exported; got %d", exported)
+	}
+	if expected := "{\"a\":1,\"b\":[1,2]}\n{\"a\":3}\n"; buf.String() != expected {
+		t.Errorf("expected %q; got %q", expected, buf.String())
+	}
+}
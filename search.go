@@ -0,0 +1,223 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// SearchOption configures an optional parameter of a search request issued by Search
+type SearchOption func(*elastic.SearchService)
+
+// WithPointInTime searches the given point in time, extending its keep alive; the index
+// passed to Search must be empty as the point in time determines the indices searched
+func WithPointInTime(id string, keepAlive time.Duration) SearchOption {
+	return func(svc *elastic.SearchService) {
+		svc.PointInTime(elastic.NewPointInTimeWithKeepAlive(id, formatKeepAlive(keepAlive)))
+	}
+}
+
+// WithSeqNoPrimaryTerm includes the sequence number and primary term of each hit, which
+// NewUpdateMessageFromHit uses for optimistic concurrency control
+func WithSeqNoPrimaryTerm() SearchOption {
+	return func(svc *elastic.SearchService) {
+		svc.SeqNoAndPrimaryTerm(true)
+	}
+}
+
+// WithPreference routes the search to the shard copies selected by the given preference (i.e., _local,
+// or a custom string such as a session id), such that repeated searches hit the same shard copies
+func WithPreference(preference string) SearchOption {
+	return func(svc *elastic.SearchService) {
+		svc.Preference(preference)
+	}
+}
+
+// Search returns the documents in the given index, or all indices when empty, matching the given query
+func Search(ctx context.Context, index string, query elastic.Query, opts ...SearchOption) (*elastic.SearchResult, error) {
+	client, err := GetClient()
+	if err != nil {
+		return nil, err
+	}
+
+	svc := client.Search()
+	if index != "" {
+		svc.Index(index)
+	}
+	if query != nil {
+		svc.Query(query)
+	}
+	for _, opt := range opts {
+		opt(svc)
+	}
+
+	result, err := svc.Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search elasticsearch index %s; %w", index, err)
+	}
+
+	log.Tracef("search of elasticsearch index %s matched %d document(s) in %dms", index, result.TotalHits(), result.TookInMillis)
+	return result, nil
+}
+
+// SearchAfter returns a page of at most size documents in the given index matching the given query,
+// ordered by the given sort, beginning after the given search_after cursor (or from the start when
+// nil); the cursor for the next page is returned, or nil when the page contains no hits
+func SearchAfter(ctx context.Context, index string, query elastic.Query, sort []elastic.Sorter, after []interface{}, size int, opts ...SearchOption) (*elastic.SearchResult, []interface{}, error) {
+	if len(sort) == 0 {
+		return nil, nil, fmt.Errorf("failed to search elasticsearch index %s; search_after requires a sort", index)
+	}
+
+	opts = append([]SearchOption{func(svc *elastic.SearchService) {
+		svc.SortBy(sort...).Size(size)
+		if len(after) > 0 {
+			svc.SearchAfter(after...)
+		}
+	}}, opts...)
+
+	result, err := Search(ctx, index, query, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if result.Hits == nil || len(result.Hits.Hits) == 0 {
+		return result, nil, nil
+	}
+
+	return result, result.Hits.Hits[len(result.Hits.Hits)-1].Sort, nil
+}
+
+// SearchTerm returns at most size documents in the given index whose field exactly matches the given
+// value; the value is not analyzed, so text fields should be matched using their keyword sub-field
+func SearchTerm(ctx context.Context, index, field string, value interface{}, size int, opts ...SearchOption) (*elastic.SearchResult, error) {
+	opts = append([]SearchOption{func(svc *elastic.SearchService) {
+		svc.Size(size)
+	}}, opts...)
+
+	return Search(ctx, index, elastic.NewTermQuery(field, value), opts...)
+}
+
+// multiMatchTypes are the types of multi_match query supported by elasticsearch
+var multiMatchTypes = map[string]bool{
+	"best_fields":   true,
+	"most_fields":   true,
+	"cross_fields":  true,
+	"phrase":        true,
+	"phrase_prefix": true,
+	"bool_prefix":   true,
+}
+
+// SearchMultiMatch returns at most size documents in the given index matching the given query text in
+// any of the given fields, scored by the best matching field (i.e., for a simple search box)
+func SearchMultiMatch(ctx context.Context, index string, query string, fields []string, size int, opts ...SearchOption) (*elastic.SearchResult, error) {
+	return SearchMultiMatchType(ctx, index, query, fields, "best_fields", size, opts...)
+}
+
+// SearchMultiMatchType returns at most size documents in the given index matching the given query text
+// in the given fields using the given multi_match type, i.e., phrase to match the text as a phrase
+func SearchMultiMatchType(ctx context.Context, index string, query string, fields []string, matchType string, size int, opts ...SearchOption) (*elastic.SearchResult, error) {
+	if !multiMatchTypes[matchType] {
+		return nil, fmt.Errorf("failed to search elasticsearch index %s; invalid multi_match type %s", index, matchType)
+	}
+
+	opts = append([]SearchOption{func(svc *elastic.SearchService) {
+		svc.Size(size)
+	}}, opts...)
+
+	return Search(ctx, index, elastic.NewMultiMatchQuery(query, fields...).Type(matchType), opts...)
+}
+
+// OpenPIT opens a point in time against the given index, returning its id; the point in time is
+// retained for the given keep alive, which each search against it extends
+func OpenPIT(ctx context.Context, index string, keepAlive time.Duration) (string, error) {
+	client, err := GetClient()
+	if err != nil {
+		return "", err
+	}
+
+	response, err := client.OpenPointInTime(index).KeepAlive(formatKeepAlive(keepAlive)).Do(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to open point in time for elasticsearch index %s; %w", index, err)
+	}
+
+	return response.Id, nil
+}
+
+// ClosePIT closes the given point in time, releasing its resources
+func ClosePIT(ctx context.Context, id string) error {
+	client, err := GetClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = client.ClosePointInTime(id).Do(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to close elasticsearch point in time; %w", err)
+	}
+
+	return nil
+}
+
+// formatKeepAlive formats the given duration as an elasticsearch time unit
+func formatKeepAlive(keepAlive time.Duration) string {
+	return fmt.Sprintf("%dms", keepAlive.Milliseconds())
+}
+
+// PutSearchTemplate stores the given mustache search template source (i.e., a query with {{params}})
+// under the given id for use with SearchTemplate
+func PutSearchTemplate(ctx context.Context, id, source string) error {
+	client, err := GetClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = client.PutScript().Id(id).BodyJson(map[string]interface{}{
+		"script": map[string]interface{}{
+			"lang":   "mustache",
+			"source": source,
+		},
+	}).Do(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to put elasticsearch search template %s; %w", id, err)
+	}
+
+	log.Debugf("put elasticsearch search template %s", id)
+	return nil
+}
+
+// SearchTemplate returns the documents in the given index, or all indices when empty, matching the
+// query rendered from the stored search template with the given id using the given params
+func SearchTemplate(ctx context.Context, index, id string, params map[string]interface{}) (*elastic.SearchResult, error) {
+	client, err := GetClient()
+	if err != nil {
+		return nil, err
+	}
+
+	path := "/_search/template"
+	if index != "" {
+		path = fmt.Sprintf("/%s/_search/template", url.PathEscape(index))
+	}
+
+	resp, err := client.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method: "POST",
+		Path:   path,
+		Body: map[string]interface{}{
+			"id":     id,
+			"params": params,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search elasticsearch index %s using template %s; %w", index, id, err)
+	}
+
+	result := &elastic.SearchResult{}
+	if err := jsonCodec.Unmarshal(resp.Body, result); err != nil {
+		return nil, fmt.Errorf("failed to parse search of elasticsearch index %s using template %s; %w", index, id, err)
+	}
+
+	log.Tracef("templated search of elasticsearch index %s matched %d document(s) in %dms", index, result.TotalHits(), result.TookInMillis)
+	return result, nil
+}
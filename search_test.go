@@ -0,0 +1,287 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// searchHandler returns a handler responding to search requests with the given hits, and to point in time requests
+func searchHandler(hits string) stubHandler {
+	return func(req *stubRequest) (int, string) {
+		switch {
+		case strings.HasSuffix(req.Path, "/_search"):
+			return http.StatusOK, `{"took":1,"hits":{"total":{"value":2,"relation":"eq"},"hits":` + hits + `}}`
+		case req.Method == http.MethodPost && strings.HasSuffix(req.Path, "/_pit"):
+			return http.StatusOK, `{"id":"pit-1"}`
+		case req.Method == http.MethodDelete && req.Path == "/_pit":
+			return http.StatusOK, `{"succeeded":true,"num_freed":1}`
+		}
+		return http.StatusNotFound, `{}`
+	}
+}
+
+// searchBody parses the body of the given search request
+func searchBody(t *testing.T, req *stubRequest) map[string]interface{} {
+	t.Helper()
+
+	var body map[string]interface{}
+	if err := jsonCodec.Unmarshal(req.Body, &body); err != nil {
+		t.Fatalf("failed to parse search body; %s", err.Error())
+	}
+	return body
+}
+
+func TestSearchIndex(t *testing.T) {
+	transport, restore := useStubClient(t, searchHandler(`[{"_index":"logs","_id":"1","_source":{}},{"_index":"logs","_id":"2","_source":{}}]`))
+	defer restore()
+
+	result, err := Search(context.Background(), "logs", elastic.NewTermQuery("level", "warn"))
+	if err != nil {
+		t.Fatalf("failed to search; %s", err.Error())
+	}
+	if result.TotalHits() != 2 {
+		t.Errorf("expected 2 hits; got %d", result.TotalHits())
+	}
+
+	reqs := transport.find(http.MethodPost, "/logs/_search")
+	if len(reqs) != 1 {
+		t.Fatalf("expected 1 search request; got %d", len(reqs))
+	}
+	if _, ok := searchBody(t, reqs[0])["query"]; !ok {
+		t.Errorf("expected the query to be sent")
+	}
+}
+
+func TestSearchWithPointInTime(t *testing.T) {
+	transport, restore := useStubClient(t, searchHandler(`[]`))
+	defer restore()
+
+	id, err := OpenPIT(context.Background(), "logs", time.Minute)
+	if err != nil {
+		t.Fatalf("failed to open point in time; %s", err.Error())
+	}
+	if id != "pit-1" {
+		t.Errorf("expected point in time pit-1; got %s", id)
+	}
+	opens := transport.find(http.MethodPost, "/logs/_pit")
+	if len(opens) != 1 || opens[0].Query.Get("keep_alive") != "60000ms" {
+		t.Errorf("expected the point in time to be opened with a 60000ms keep alive")
+	}
+
+	if _, err := Search(context.Background(), "", nil, WithPointInTime(id, time.Minute)); err != nil {
+		t.Fatalf("failed to search; %s", err.Error())
+	}
+	reqs := transport.find(http.MethodPost, "/_search")
+	if len(reqs) != 1 || reqs[0].Path != "/_search" {
+		t.Fatalf("expected 1 search request without an index")
+	}
+	pit, _ := searchBody(t, reqs[0])["pit"].(map[string]interface{})
+	if pit["id"] != "pit-1" || pit["keep_alive"] != "60000ms" {
+		t.Errorf("expected the point in time to be searched; got %v", pit)
+	}
+
+	if err := ClosePIT(context.Background(), id); err != nil {
+		t.Fatalf("failed to close point in time; %s", err.Error())
+	}
+	if len(transport.find(http.MethodDelete, "/_pit")) != 1 {
+		t.Errorf("expected the point in time to be closed")
+	}
+}
+
+func TestSearchAfterReturnsCursorOfLastHit(t *testing.T) {
+	transport, restore := useStubClient(t, searchHandler(`[{"_index":"logs","_id":"1","sort":[1,"a"]},{"_index":"logs","_id":"2","sort":[2,"b"]}]`))
+	defer restore()
+
+	sort := []elastic.Sorter{elastic.NewFieldSort("n").Asc()}
+	_, cursor, err := SearchAfter(context.Background(), "logs", nil, sort, []interface{}{0, "z"}, 2)
+	if err != nil {
+		t.Fatalf("failed to search; %s", err.Error())
+	}
+	if len(cursor) != 2 || cursor[1] != "b" {
+		t.Errorf("expected the sort values of the last hit; got %v", cursor)
+	}
+
+	body := searchBody(t, transport.find(http.MethodPost, "/logs/_search")[0])
+	if body["size"] != float64(2) {
+		t.Errorf("expected size 2; got %v", body["size"])
+	}
+	if after, _ := body["search_after"].([]interface{}); len(after) != 2 || after[1] != "z" {
+		t.Errorf("expected the search_after cursor to be sent; got %v", body["search_after"])
+	}
+}
+
+func TestSearchAfterReturnsNilCursorWithoutHits(t *testing.T) {
+	_, restore := useStubClient(t, searchHandler(`[]`))
+	defer restore()
+
+	sort := []elastic.Sorter{elastic.NewFieldSort("n").Asc()}
+	_, cursor, err := SearchAfter(context.Background(), "logs", nil, sort, nil, 10)
+	if err != nil {
+		t.Fatalf("failed to search; %s", err.Error())
+	}
+	if cursor != nil {
+		t.Errorf("expected nil cursor for an empty page; got %v", cursor)
+	}
+}
+
+func TestSearchAfterRequiresSort(t *testing.T) {
+	if _, _, err := SearchAfter(context.Background(), "logs", nil, nil, nil, 10); err == nil {
+		t.Errorf("expected search_after without a sort to be rejected")
+	}
+}
+
+func TestSearchWithPreference(t *testing.T) {
+	transport, restore := useStubClient(t, searchHandler(`[]`))
+	defer restore()
+
+	if _, err := Search(context.Background(), "logs", nil, WithPreference("session-1")); err != nil {
+		t.Fatalf("failed to search; %s", err.Error())
+	}
+
+	reqs := transport.find(http.MethodPost, "/logs/_search")
+	if len(reqs) != 1 {
+		t.Fatalf("expected 1 search request; got %d", len(reqs))
+	}
+	if preference := reqs[0].Query.Get("preference"); preference != "session-1" {
+		t.Errorf("expected the preference to be sent; got %q", preference)
+	}
+}
+
+func TestPutSearchTemplate(t *testing.T) {
+	transport, restore := useStubClient(t, func(req *stubRequest) (int, string) {
+		return http.StatusOK, `{"acknowledged":true}`
+	})
+	defer restore()
+
+	if err := PutSearchTemplate(context.Background(), "by-level", `{"query":{"term":{"level":"{{level}}"}}}`); err != nil {
+		t.Fatalf("failed to put search template; %s", err.Error())
+	}
+
+	reqs := transport.find(http.MethodPut, "/_scripts/by-level")
+	if len(reqs) != 1 {
+		t.Fatalf("expected 1 put script request; got %d", len(reqs))
+	}
+	script, _ := searchBody(t, reqs[0])["script"].(map[string]interface{})
+	if script["lang"] != "mustache" || script["source"] != `{"query":{"term":{"level":"{{level}}"}}}` {
+		t.Errorf("expected the mustache template source to be sent; got %s", reqs[0].Body)
+	}
+}
+
+func TestSearchTemplate(t *testing.T) {
+	transport, restore := useStubClient(t, func(req *stubRequest) (int, string) {
+		if strings.HasSuffix(req.Path, "/_search/template") {
+			return http.StatusOK, `{"took":1,"hits":{"total":{"value":1,"relation":"eq"},"hits":[{"_index":"logs","_id":"1","_source":{}}]}}`
+		}
+		return http.StatusNotFound, `{}`
+	})
+	defer restore()
+
+	result, err := SearchTemplate(context.Background(), "logs", "by-level", map[string]interface{}{"level": "warn"})
+	if err != nil {
+		t.Fatalf("failed to search using template; %s", err.Error())
+	}
+	if result.TotalHits() != 1 {
+		t.Errorf("expected 1 hit; got %d", result.TotalHits())
+	}
+
+	reqs := transport.find(http.MethodPost, "/logs/_search/template")
+	if len(reqs) != 1 {
+		t.Fatalf("expected 1 templated search request; got %d", len(reqs))
+	}
+	body := searchBody(t, reqs[0])
+	if params, _ := body["params"].(map[string]interface{}); body["id"] != "by-level" || params["level"] != "warn" {
+		t.Errorf("expected the template id and params to be sent; got %s", reqs[0].Body)
+	}
+
+	if _, err := SearchTemplate(context.Background(), "", "by-level", nil); err != nil {
+		t.Fatalf("failed to search all indices using template; %s", err.Error())
+	}
+	if reqs := transport.find(http.MethodPost, "/_search/template"); len(reqs) != 2 || reqs[1].Path != "/_search/template" {
+		t.Errorf("expected all indices to be searched when no index is given")
+	}
+}
+
+func TestSearchTermSendsTermQueryAndSize(t *testing.T) {
+	transport, restore := useStubClient(t, searchHandler(`[{"_index":"logs","_id":"1","_source":{}}]`))
+	defer restore()
+
+	if _, err := SearchTerm(context.Background(), "logs", "level.keyword", "warn", 5, WithPreference("session-1")); err != nil {
+		t.Fatalf("failed to search term; %s", err.Error())
+	}
+
+	reqs := transport.find(http.MethodPost, "/logs/_search")
+	if len(reqs) != 1 {
+		t.Fatalf("expected 1 search request; got %d", len(reqs))
+	}
+	body := searchBody(t, reqs[0])
+	query, _ := body["query"].(map[string]interface{})
+	term, _ := query["term"].(map[string]interface{})
+	if term["level.keyword"] != "warn" {
+		t.Errorf("expected a term query of the given field and value; got %s", reqs[0].Body)
+	}
+	if body["size"] != float64(5) {
+		t.Errorf("expected the given size; got %s", reqs[0].Body)
+	}
+	if preference := reqs[0].Query.Get("preference"); preference != "session-1" {
+		t.Errorf("expected the given options to be applied; got preference %q", preference)
+	}
+}
+
+// multiMatchQuery returns the multi_match query of the given search request
+func multiMatchQuery(t *testing.T, req *stubRequest) map[string]interface{} {
+	t.Helper()
+
+	query, _ := searchBody(t, req)["query"].(map[string]interface{})
+	multiMatch, _ := query["multi_match"].(map[string]interface{})
+	return multiMatch
+}
+
+func TestSearchMultiMatchScoresBestFields(t *testing.T) {
+	transport, restore := useStubClient(t, searchHandler(`[]`))
+	defer restore()
+
+	if _, err := SearchMultiMatch(context.Background(), "products", "red shoes", []string{"title", "description"}, 10); err != nil {
+		t.Fatalf("failed to search; %s", err.Error())
+	}
+
+	reqs := transport.find(http.MethodPost, "/products/_search")
+	if len(reqs) != 1 {
+		t.Fatalf("expected 1 search request; got %d", len(reqs))
+	}
+	multiMatch := multiMatchQuery(t, reqs[0])
+	fields, _ := multiMatch["fields"].([]interface{})
+	if multiMatch["query"] != "red shoes" || len(fields) != 2 || fields[0] != "title" || fields[1] != "description" {
+		t.Errorf("expected a multi_match query of the given text and fields; got %s", reqs[0].Body)
+	}
+	if matchType := multiMatch["type"]; matchType != "best_fields" {
+		t.Errorf("expected best_fields type; got %v", matchType)
+	}
+	if size := searchBody(t, reqs[0])["size"]; size != float64(10) {
+		t.Errorf("expected the given size; got %v", size)
+	}
+}
+
+func TestSearchMultiMatchTypeValidatesType(t *testing.T) {
+	transport, restore := useStubClient(t, searchHandler(`[]`))
+	defer restore()
+
+	if _, err := SearchMultiMatchType(context.Background(), "products", "red sh", []string{"title"}, "phrase_prefix", 10); err != nil {
+		t.Fatalf("failed to search; %s", err.Error())
+	}
+	reqs := transport.find(http.MethodPost, "/products/_search")
+	if len(reqs) != 1 || multiMatchQuery(t, reqs[0])["type"] != "phrase_prefix" {
+		t.Errorf("expected the given multi_match type to be sent")
+	}
+
+	if _, err := SearchMultiMatchType(context.Background(), "products", "red", []string{"title"}, "fuzzy", 10); err == nil || !strings.Contains(err.Error(), "invalid multi_match type fuzzy") {
+		t.Errorf("expected an invalid multi_match type to be rejected; got %v", err)
+	}
+	if reqs := transport.find(http.MethodPost, "/products/_search"); len(reqs) != 1 {
+		t.Errorf("expected no search request for an invalid type")
+	}
+}
@@ -0,0 +1,20 @@
+package elasticsearchutil
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// shardIndex returns the physical index to which the given message targeting a sharded logical index
+// is written, i.e., `base-2`, by hashing its id such that every op for a document targets the same
+// index; messages without an id are distributed by hashing their payload
+func shardIndex(base string, shards int, msg *Message) string {
+	hash := fnv.New32a()
+	if msg.Header.ID != nil {
+		hash.Write([]byte(*msg.Header.ID))
+	} else {
+		hash.Write(msg.Payload)
+	}
+
+	return fmt.Sprintf("%s-%d", base, hash.Sum32()%uint32(shards))
+}
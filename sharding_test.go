@@ -0,0 +1,60 @@
+package elasticsearchutil
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestShardIndexIsStablePerDocument(t *testing.T) {
+	indices := map[string]bool{}
+	for i := 0; i < 64; i++ {
+		msg := testMessage("events", fmt.Sprintf("%d", i), `{"a":1}`)
+		index := shardIndex("events", 4, msg)
+		if index != shardIndex("events", 4, testMessage("events", fmt.Sprintf("%d", i), `{"b":2}`)) {
+			t.Fatalf("expected every op for document %d to target the same index", i)
+		}
+		if !strings.HasPrefix(index, "events-") {
+			t.Fatalf("expected a physical index of the base; got %s", index)
+		}
+		indices[index] = true
+	}
+	if len(indices) != 4 {
+		t.Errorf("expected documents to be spread across the 4 physical indices; got %v", indices)
+	}
+	for shard := 0; shard < 4; shard++ {
+		if !indices[fmt.Sprintf("events-%d", shard)] {
+			t.Errorf("expected physical index events-%d", shard)
+		}
+	}
+}
+
+func TestWithIndexShardingRewritesTargetIndex(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithIndexSharding("events", 4))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	sharded := testMessage("events", "1", `{"a":1}`)
+	enqueueAll(t, indexer, 2, sharded, testMessage("logs", "1", `{"a":1}`))
+	waitIdle(t, indexer)
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 2 {
+		t.Fatalf("expected 2 bulk actions; got %d", len(commands))
+	}
+	if index := commands[0].meta["_index"]; index != shardIndex("events", 4, testMessage("events", "1", "")) {
+		t.Errorf("expected the document to target its physical index; got %v", index)
+	}
+	if index := commands[1].meta["_index"]; index != "logs" {
+		t.Errorf("expected an unsharded index not to be rewritten; got %v", index)
+	}
+}
+
+func TestWithIndexShardingValidatesShards(t *testing.T) {
+	if _, err := newIndexer(nil, "", WithIndexSharding("", 4)); err == nil {
+		t.Errorf("expected an empty sharded index to be rejected")
+	}
+	if _, err := newIndexer(nil, "", WithIndexSharding("events", 0)); err == nil {
+		t.Errorf("expected non-positive index shards to be rejected")
+	}
+}
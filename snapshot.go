@@ -0,0 +1,74 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"fmt"
+)
+
+// CreateSnapshot snapshots the given indices to the given registered repository, blocking until the
+// snapshot completes; an error is returned unless every shard of the indices is snapshotted
+func CreateSnapshot(ctx context.Context, repo, snapshot string, indices []string) error {
+	return createSnapshot(ctx, repo, snapshot, indices, true)
+}
+
+// CreateSnapshotAsync starts a snapshot of the given indices to the given registered repository,
+// returning once the snapshot is accepted rather than when it completes
+func CreateSnapshotAsync(ctx context.Context, repo, snapshot string, indices []string) error {
+	return createSnapshot(ctx, repo, snapshot, indices, false)
+}
+
+func createSnapshot(ctx context.Context, repo, snapshot string, indices []string, waitForCompletion bool) error {
+	client, err := GetClient()
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.SnapshotCreate(repo, snapshot).
+		BodyJson(map[string]interface{}{
+			"indices": indices,
+		}).
+		WaitForCompletion(waitForCompletion).
+		Do(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create elasticsearch snapshot %s in repository %s; %w", snapshot, repo, err)
+	}
+
+	if waitForCompletion && resp.Snapshot != nil && resp.Snapshot.State != "SUCCESS" {
+		return fmt.Errorf("failed to create elasticsearch snapshot %s in repository %s; snapshot completed with state %s; %s", snapshot, repo, resp.Snapshot.State, resp.Snapshot.Reason)
+	}
+
+	return nil
+}
+
+// RestoreSnapshot restores the given indices from the snapshot in the given registered repository,
+// blocking until the restore completes; the indices must not exist or must be closed
+func RestoreSnapshot(ctx context.Context, repo, snapshot string, indices []string) error {
+	return restoreSnapshot(ctx, repo, snapshot, indices, true)
+}
+
+// RestoreSnapshotAsync starts a restore of the given indices from the snapshot in the given registered
+// repository, returning once the restore is accepted rather than when it completes
+func RestoreSnapshotAsync(ctx context.Context, repo, snapshot string, indices []string) error {
+	return restoreSnapshot(ctx, repo, snapshot, indices, false)
+}
+
+func restoreSnapshot(ctx context.Context, repo, snapshot string, indices []string, waitForCompletion bool) error {
+	client, err := GetClient()
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.SnapshotRestore(repo, snapshot).
+		Indices(indices...).
+		WaitForCompletion(waitForCompletion).
+		Do(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to restore elasticsearch snapshot %s from repository %s; %w", snapshot, repo, err)
+	}
+
+	if waitForCompletion && resp.Snapshot != nil && resp.Snapshot.Shards.Failed > 0 {
+		return fmt.Errorf("failed to restore elasticsearch snapshot %s from repository %s; %d of %d shards failed", snapshot, repo, resp.Snapshot.Shards.Failed, resp.Snapshot.Shards.Total)
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// snapshotHandler returns a handler responding to snapshot create and restore requests; requests
+// waiting for completion are answered with the given snapshot state and number of failed shards
+func snapshotHandler(state string, failedShards int) stubHandler {
+	return func(req *stubRequest) (int, string) {
+		wait := req.Query.Get("wait_for_completion") == "true"
+		switch {
+		case req.Method == http.MethodPost && strings.HasSuffix(req.Path, "/_restore"):
+			if !wait {
+				return http.StatusOK, `{"accepted":true}`
+			}
+			if failedShards > 0 {
+				return http.StatusOK, `{"snapshot":{"snapshot":"snap-1","indices":["logs"],"shards":{"total":2,"failed":1,"successful":1}}}`
+			}
+			return http.StatusOK, `{"snapshot":{"snapshot":"snap-1","indices":["logs"],"shards":{"total":2,"failed":0,"successful":2}}}`
+		case req.Method == http.MethodPut && strings.HasPrefix(req.Path, "/_snapshot/"):
+			if !wait {
+				return http.StatusOK, `{"accepted":true}`
+			}
+			return http.StatusOK, `{"snapshot":{"snapshot":"snap-1","state":"` + state + `","reason":"shard failure"}}`
+		}
+		return http.StatusNotFound, `{}`
+	}
+}
+
+func TestCreateSnapshotWaitsForCompletion(t *testing.T) {
+	transport, restore := useStubClient(t, snapshotHandler("SUCCESS", 0))
+	defer restore()
+
+	if err := CreateSnapshot(context.Background(), "backups", "snap-1", []string{"logs", "events"}); err != nil {
+		t.Fatalf("failed to create snapshot; %s", err.Error())
+	}
+
+	reqs := transport.find(http.MethodPut, "/_snapshot/backups/snap-1")
+	if len(reqs) != 1 {
+		t.Fatalf("expected 1 snapshot request; got %d", len(reqs))
+	}
+	if reqs[0].Query.Get("wait_for_completion") != "true" {
+		t.Errorf("expected the snapshot to wait for completion")
+	}
+	var body map[string][]string
+	if err := jsonCodec.Unmarshal(reqs[0].Body, &body); err != nil {
+		t.Fatalf("failed to parse snapshot body; %s", err.Error())
+	}
+	if indices := body["indices"]; len(indices) != 2 || indices[0] != "logs" || indices[1] != "events" {
+		t.Errorf("expected the given indices to be snapshotted; got %s", reqs[0].Body)
+	}
+
+	if err := CreateSnapshotAsync(context.Background(), "backups", "snap-1", []string{"logs"}); err != nil {
+		t.Fatalf("failed to start snapshot; %s", err.Error())
+	}
+	if reqs := transport.find(http.MethodPut, "/_snapshot/backups/snap-1"); len(reqs) != 2 || reqs[1].Query.Get("wait_for_completion") != "false" {
+		t.Errorf("expected the async snapshot not to wait for completion")
+	}
+}
+
+func TestCreateSnapshotReportsIncompleteSnapshot(t *testing.T) {
+	_, restore := useStubClient(t, snapshotHandler("PARTIAL", 0))
+	defer restore()
+
+	if err := CreateSnapshot(context.Background(), "backups", "snap-1", []string{"logs"}); err == nil || !strings.Contains(err.Error(), "completed with state PARTIAL") {
+		t.Errorf("expected the partial snapshot to be reported; got %v", err)
+	}
+}
+
+func TestRestoreSnapshot(t *testing.T) {
+	transport, restore := useStubClient(t, snapshotHandler("SUCCESS", 0))
+	defer restore()
+
+	if err := RestoreSnapshot(context.Background(), "backups", "snap-1", []string{"logs"}); err != nil {
+		t.Fatalf("failed to restore snapshot; %s", err.Error())
+	}
+	if err := RestoreSnapshotAsync(context.Background(), "backups", "snap-1", []string{"logs"}); err != nil {
+		t.Fatalf("failed to start restore; %s", err.Error())
+	}
+
+	reqs := transport.find(http.MethodPost, "/_snapshot/backups/snap-1/_restore")
+	if len(reqs) != 2 {
+		t.Fatalf("expected 2 restore requests; got %d", len(reqs))
+	}
+	if reqs[0].Query.Get("wait_for_completion") != "true" || reqs[1].Query.Get("wait_for_completion") != "false" {
+		t.Errorf("expected only the blocking restore to wait for completion")
+	}
+	if !strings.Contains(string(reqs[0].Body), `"logs"`) {
+		t.Errorf("expected the given indices to be restored; got %s", reqs[0].Body)
+	}
+}
+
+func TestRestoreSnapshotReportsFailedShards(t *testing.T) {
+	_, restore := useStubClient(t, snapshotHandler("SUCCESS", 1))
+	defer restore()
+
+	if err := RestoreSnapshot(context.Background(), "backups", "snap-1", []string{"logs"}); err == nil || !strings.Contains(err.Error(), "1 of 2 shards failed") {
+		t.Errorf("expected the failed shards to be reported; got %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+package elasticsearchutil
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// defaultElasticsearchIndexerFailureSpoolMaxBytes is the size at which the failure spool is rotated
+const defaultElasticsearchIndexerFailureSpoolMaxBytes = 64 * 1024 * 1024
+
+// failureSpool appends dead-lettered messages as ndjson to a local file from which they can be replayed;
+// once the file would exceed its max size it is rotated to <path>.1, replacing any previous rotation
+type failureSpool struct {
+	mutex    *sync.Mutex
+	path     string
+	maxBytes int64
+	file     *os.File
+	size     int64
+}
+
+func newFailureSpool(path string) *failureSpool {
+	return &failureSpool{
+		mutex:    &sync.Mutex{},
+		path:     path,
+		maxBytes: defaultElasticsearchIndexerFailureSpoolMaxBytes,
+	}
+}
+
+// append writes the given message to the spool, opening or rotating the file as needed
+func (spool *failureSpool) append(msg *Message) error {
+	line, err := jsonCodec.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	spool.mutex.Lock()
+	defer spool.mutex.Unlock()
+
+	if spool.file != nil && spool.size > 0 && spool.size+int64(len(line)) > spool.maxBytes {
+		if err := spool.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if spool.file == nil {
+		if err := spool.open(); err != nil {
+			return err
+		}
+	}
+
+	n, err := spool.file.Write(line)
+	spool.size += int64(n)
+	return err
+}
+
+// open opens the spool file for appending; the file may contain documents, so it is not world-readable
+func (spool *failureSpool) open() error {
+	file, err := os.OpenFile(spool.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	spool.file = file
+	spool.size = info.Size()
+	return nil
+}
+
+// rotate closes the spool file and renames it to <path>.1; the next append opens a new file
+func (spool *failureSpool) rotate() error {
+	err := spool.file.Close()
+	spool.file = nil
+	spool.size = 0
+	if err != nil {
+		return err
+	}
+	return os.Rename(spool.path, spool.path+".1")
+}
+
+// close closes the spool file, if open; a subsequent append reopens it
+func (spool *failureSpool) close() error {
+	spool.mutex.Lock()
+	defer spool.mutex.Unlock()
+
+	if spool.file == nil {
+		return nil
+	}
+
+	err := spool.file.Close()
+	spool.file = nil
+	spool.size = 0
+	return err
+}
+
+// truncate discards the first n bytes of the spool file matching the given file info, i.e., once they have
+// been replayed; the spool file is closed first, such that the next append reopens the truncated file
+func (spool *failureSpool) truncate(info os.FileInfo, n int64) error {
+	spool.mutex.Lock()
+	defer spool.mutex.Unlock()
+
+	if spool.file != nil {
+		err := spool.file.Close()
+		spool.file = nil
+		spool.size = 0
+		if err != nil {
+			return err
+		}
+	}
+
+	// the spool may have been rotated while its messages were replayed
+	for _, path := range []string{spool.path, spool.path + ".1"} {
+		if current, err := os.Stat(path); err == nil && os.SameFile(info, current) {
+			return truncateSpoolFile(path, n)
+		}
+	}
+	return nil
+}
+
+// truncateSpoolFile discards the first n bytes of the spool file at the given path, keeping any messages
+// appended after them
+func truncateSpoolFile(path string, n int64) error {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if int64(len(raw)) <= n {
+		return os.Truncate(path, 0)
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, raw[n:], 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// spoolFailure appends the given dead-lettered message to the failure spool, if configured
+func (indexer *Indexer) spoolFailure(msg *Message) {
+	if indexer.failureSpool == nil {
+		return
+	}
+
+	if err := indexer.failureSpool.append(msg); err != nil {
+		log.Warningf("indexer (%v) failed to spool %d-byte dead-lettered document to %s; %s", indexer.identifier, len(msg.Payload), indexer.failureSpool.path, err.Error())
+	}
+}
+
+// ReplaySpool enqueues each message of the failure spool at the given path (i.e., once the cause of the
+// failures is resolved), returning the number of messages enqueued; only the messages spooled when the
+// replay begins are replayed, such that messages failing again are spooled rather than replayed twice;
+// once every message is enqueued, the replayed messages are removed from the spool
+func (indexer *Indexer) ReplaySpool(ctx context.Context, path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open failure spool %s; %w", path, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to open failure spool %s; %w", path, err)
+	}
+
+	reader := bufio.NewReader(io.LimitReader(file, info.Size()))
+	replayed := 0
+	for line := 1; ; line++ {
+		if err := ctx.Err(); err != nil {
+			return replayed, err
+		}
+
+		raw, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(raw) == 0 {
+			break
+		} else if err != nil && err != io.EOF {
+			return replayed, fmt.Errorf("failed to read failure spool %s; %w", path, err)
+		}
+
+		msg := &Message{}
+		if err := jsonCodec.Unmarshal(raw, msg); err != nil {
+			return replayed, fmt.Errorf("failed to parse message at line %d of failure spool %s; %w", line, path, err)
+		}
+
+		// the cursor of a spooled message was acknowledged when it was dead-lettered
+		if msg.Header != nil {
+			msg.Header.Cursor = nil
+		}
+
+		if err := indexer.Q(msg); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+
+	if indexer.failureSpool != nil && filepath.Clean(indexer.failureSpool.path) == filepath.Clean(path) {
+		err = indexer.failureSpool.truncate(info, info.Size())
+	} else {
+		err = truncateSpoolFile(path, info.Size())
+	}
+	if err != nil {
+		return replayed, fmt.Errorf("failed to truncate failure spool %s; %w", path, err)
+	}
+	return replayed, nil
+}
@@ -0,0 +1,173 @@
+package elasticsearchutil
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tempSpoolPath returns the path of a failure spool within a new temporary directory, and a func removing it
+func tempSpoolPath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "elasticsearchutil-spool")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory; %s", err.Error())
+	}
+	return filepath.Join(dir, "failures.ndjson"), func() { os.RemoveAll(dir) }
+}
+
+// spooledMessages parses the messages of the failure spool at the given path
+func spooledMessages(t *testing.T, path string) []*Message {
+	t.Helper()
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read failure spool; %s", err.Error())
+	}
+
+	msgs := make([]*Message, 0)
+	for _, line := range bytes.Split(bytes.TrimSpace(raw), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		msg := &Message{}
+		if err := jsonCodec.Unmarshal(line, msg); err != nil {
+			t.Fatalf("failed to parse spooled message %s; %s", line, err.Error())
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+func TestWithFailureSpoolSpoolsDeadLetteredMessages(t *testing.T) {
+	path, cleanup := tempSpoolPath(t)
+	defer cleanup()
+
+	indexer, _ := newStubIndexer(t, rejectingBulkHandler(t, "1"), WithFailureSpool(path))
+	stop := runIndexer(indexer)
+
+	enqueueAll(t, indexer, 2, testMessage("events", "1", `{"a":1}`), testMessage("events", "2", `{"a":2}`))
+	waitIdle(t, indexer)
+	stop()
+
+	msgs := spooledMessages(t, path)
+	if len(msgs) != 1 || *msgs[0].Header.ID != "1" || *msgs[0].Header.Index != "events" || string(msgs[0].Payload) != `{"a":1}` {
+		t.Fatalf("expected only the dead-lettered message to be spooled; got %v", msgs)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected the spool not to be world-readable; got %v", info.Mode())
+	}
+}
+
+func TestReplaySpoolEnqueuesSpooledMessagesAndTruncatesSpool(t *testing.T) {
+	path, cleanup := tempSpoolPath(t)
+	defer cleanup()
+
+	indexer, transport := newStubIndexer(t, rejectingBulkHandler(t, "1"), WithFailureSpool(path))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueAll(t, indexer, 1, cursorMessage("events", "1", 1))
+	waitIdle(t, indexer)
+	if checkpoint := indexer.Checkpoint(); checkpoint != 1 {
+		t.Fatalf("expected the dead-lettered message to be checkpointed; got %d", checkpoint)
+	}
+
+	// the cause of the failure is resolved
+	transport.setHandler(okBulkHandler(t))
+	replayed, err := indexer.ReplaySpool(context.Background(), path)
+	if err != nil {
+		t.Fatalf("failed to replay spool; %s", err.Error())
+	}
+	if replayed != 1 {
+		t.Errorf("expected 1 replayed message; got %d", replayed)
+	}
+	waitIdle(t, indexer)
+
+	// the replayed message would be skipped as checkpointed had its cursor not been cleared
+	reqs := transport.bulkRequests()
+	if len(reqs) != 2 {
+		t.Fatalf("expected the replayed message to be sent; got %d bulk requests", len(reqs))
+	}
+	if commands := parseBulkBody(t, reqs[1].Body); len(commands) != 1 || commands[0].meta["_id"] != "1" {
+		t.Errorf("expected document 1 to be replayed; got %v", commands)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != 0 {
+		t.Errorf("expected the spool to be truncated once replayed; got %v", info)
+	}
+}
+
+func TestReplaySpoolReportsUnparseableLines(t *testing.T) {
+	path, cleanup := tempSpoolPath(t)
+	defer cleanup()
+
+	spooled, _ := jsonCodec.Marshal(testMessage("events", "1", `{"a":1}`))
+	if err := ioutil.WriteFile(path, append(append(spooled, '\n'), []byte("not json\n")...), 0600); err != nil {
+		t.Fatalf("failed to write spool; %s", err.Error())
+	}
+
+	indexer, _ := newStubIndexer(t, okBulkHandler(t))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	replayed, err := indexer.ReplaySpool(context.Background(), path)
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected the unparseable line to be reported; got %v", err)
+	}
+	if replayed != 1 {
+		t.Errorf("expected the messages preceding the unparseable line to be replayed; got %d", replayed)
+	}
+	if info, _ := os.Stat(path); info.Size() == 0 {
+		t.Errorf("expected the spool not to be truncated unless every message is replayed")
+	}
+
+	if _, err := indexer.ReplaySpool(context.Background(), path+".missing"); err == nil {
+		t.Errorf("expected a missing spool to be reported")
+	}
+}
+
+func TestTruncateSpoolFileKeepsMessagesAppendedDuringReplay(t *testing.T) {
+	path, cleanup := tempSpoolPath(t)
+	defer cleanup()
+
+	if err := ioutil.WriteFile(path, []byte("replayed\nappended\n"), 0600); err != nil {
+		t.Fatalf("failed to write spool; %s", err.Error())
+	}
+	if err := truncateSpoolFile(path, int64(len("replayed\n"))); err != nil {
+		t.Fatalf("failed to truncate spool; %s", err.Error())
+	}
+	if raw, _ := ioutil.ReadFile(path); string(raw) != "appended\n" {
+		t.Errorf("expected only the appended message to be kept; got %q", raw)
+	}
+}
+
+func TestFailureSpoolRotatesAtMaxBytes(t *testing.T) {
+	path, cleanup := tempSpoolPath(t)
+	defer cleanup()
+
+	spool := newFailureSpool(path)
+	spool.maxBytes = 64
+	defer spool.close()
+
+	for _, id := range []string{"1", "2"} {
+		if err := spool.append(testMessage("events", id, `{"a":"`+strings.Repeat("a", 32)+`"}`)); err != nil {
+			t.Fatalf("failed to append to spool; %s", err.Error())
+		}
+	}
+
+	if rotated := spooledMessages(t, path+".1"); len(rotated) != 1 || *rotated[0].Header.ID != "1" {
+		t.Errorf("expected the first message to be rotated; got %v", rotated)
+	}
+	if current := spooledMessages(t, path); len(current) != 1 || *current[0].Header.ID != "2" {
+		t.Errorf("expected the second message in the new spool; got %v", current)
+	}
+}
+
+func TestWithFailureSpoolRejectsEmptyPath(t *testing.T) {
+	if _, err := newIndexer(nil, "", WithFailureSpool("")); err == nil {
+		t.Errorf("expected empty failure spool path to be rejected")
+	}
+}
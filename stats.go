@@ -0,0 +1,57 @@
+package elasticsearchutil
+
+import (
+	"sync/atomic"
+)
+
+// Stats contains counters describing the activity of an `Indexer` instance
+type Stats struct {
+	Flushes           int64 `json:"flushes"`
+	FailedFlushes     int64 `json:"failed_flushes"`
+	Indexed           int64 `json:"indexed"`
+	Failed            int64 `json:"failed"`
+	ReconnectAttempts int64 `json:"reconnect_attempts"`
+	Reconnects        int64 `json:"reconnects"`
+	Deduplicated      int64 `json:"deduplicated"`       // buffered actions collapsed, i.e., the reduction in bulk actions sent
+	DeduplicatedBytes int64 `json:"deduplicated_bytes"` // payload bytes of the collapsed actions
+
+	InFlightBytes          int64 `json:"in_flight_bytes"`
+	AdaptiveBatchSizeBytes int64 `json:"adaptive_batch_size_bytes"` // current batch size in adaptive mode; see WithAdaptiveBatchSize
+}
+
+// Stats returns a snapshot of the indexer counters
+func (indexer *Indexer) Stats() Stats {
+	return Stats{
+		Flushes:           atomic.LoadInt64(&indexer.stats.Flushes),
+		FailedFlushes:     atomic.LoadInt64(&indexer.stats.FailedFlushes),
+		Indexed:           atomic.LoadInt64(&indexer.stats.Indexed),
+		Failed:            atomic.LoadInt64(&indexer.stats.Failed),
+		ReconnectAttempts: atomic.LoadInt64(&indexer.stats.ReconnectAttempts),
+		Reconnects:        atomic.LoadInt64(&indexer.stats.Reconnects),
+		Deduplicated:      atomic.LoadInt64(&indexer.stats.Deduplicated),
+		DeduplicatedBytes: atomic.LoadInt64(&indexer.stats.DeduplicatedBytes),
+
+		InFlightBytes:          atomic.LoadInt64(&indexer.stats.InFlightBytes),
+		AdaptiveBatchSizeBytes: atomic.LoadInt64(&indexer.stats.AdaptiveBatchSizeBytes),
+	}
+}
+
+// StatsAndReset returns a snapshot of the indexer counters, resetting each accumulating counter to
+// zero such that consecutive snapshots reflect only the activity between them (i.e., to compute
+// per-interval rates); gauges such as InFlightBytes are not reset. Each counter is swapped atomically,
+// so no activity is lost between snapshots.
+func (indexer *Indexer) StatsAndReset() Stats {
+	return Stats{
+		Flushes:           atomic.SwapInt64(&indexer.stats.Flushes, 0),
+		FailedFlushes:     atomic.SwapInt64(&indexer.stats.FailedFlushes, 0),
+		Indexed:           atomic.SwapInt64(&indexer.stats.Indexed, 0),
+		Failed:            atomic.SwapInt64(&indexer.stats.Failed, 0),
+		ReconnectAttempts: atomic.SwapInt64(&indexer.stats.ReconnectAttempts, 0),
+		Reconnects:        atomic.SwapInt64(&indexer.stats.Reconnects, 0),
+		Deduplicated:      atomic.SwapInt64(&indexer.stats.Deduplicated, 0),
+		DeduplicatedBytes: atomic.SwapInt64(&indexer.stats.DeduplicatedBytes, 0),
+
+		InFlightBytes:          atomic.LoadInt64(&indexer.stats.InFlightBytes),
+		AdaptiveBatchSizeBytes: atomic.LoadInt64(&indexer.stats.AdaptiveBatchSizeBytes),
+	}
+}
@@ -0,0 +1,38 @@
+package elasticsearchutil
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestStatsAndResetResetsCounters(t *testing.T) {
+	indexer, _ := newStubIndexer(t, okBulkHandler(t), WithDeduplication())
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueAll(t, indexer, 2, testMessage("events", "1", `{"v":1}`), testMessage("events", "2", `{"v":1}`), testMessage("events", "1", `{"v":2}`))
+	waitIdle(t, indexer)
+	atomic.StoreInt64(&indexer.stats.InFlightBytes, 64)
+
+	stats := indexer.StatsAndReset()
+	if stats.Indexed != 2 || stats.Flushes == 0 || stats.Deduplicated != 1 || stats.DeduplicatedBytes != 7 {
+		t.Errorf("expected the accumulated counters; got %+v", stats)
+	}
+	if stats.InFlightBytes != 64 {
+		t.Errorf("expected the in-flight bytes gauge; got %d", stats.InFlightBytes)
+	}
+
+	stats = indexer.Stats()
+	if stats.Indexed != 0 || stats.Flushes != 0 || stats.Deduplicated != 0 || stats.DeduplicatedBytes != 0 {
+		t.Errorf("expected the accumulated counters to be reset; got %+v", stats)
+	}
+	if stats.InFlightBytes != 64 {
+		t.Errorf("expected the in-flight bytes gauge not to be reset; got %d", stats.InFlightBytes)
+	}
+
+	enqueueAll(t, indexer, 1, testMessage("events", "3", `{"v":1}`))
+	waitIdle(t, indexer)
+	if stats := indexer.StatsAndReset(); stats.Indexed != 1 {
+		t.Errorf("expected only the activity since the previous snapshot; got %d indexed", stats.Indexed)
+	}
+}
@@ -0,0 +1,390 @@
+package elasticsearchutil
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+const stubWaitTimeout = 5 * time.Second
+
+// stubRequest is a request received by a stubTransport; the body is decompressed when gzip-encoded
+type stubRequest struct {
+	ctx      context.Context
+	Method   string
+	Path     string
+	Query    url.Values
+	Header   http.Header
+	Body     []byte
+	Encoding string
+}
+
+// stubHandler returns the status and body of the response to the given request
+type stubHandler func(req *stubRequest) (int, string)
+
+// stubTransport is an http.RoundTripper responding to each request using its handler, and recording it
+type stubTransport struct {
+	mutex    sync.Mutex
+	handler  stubHandler
+	requests []*stubRequest
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *stubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorded := &stubRequest{
+		ctx:      req.Context(),
+		Method:   req.Method,
+		Path:     req.URL.Path,
+		Query:    req.URL.Query(),
+		Header:   req.Header.Clone(),
+		Encoding: req.Header.Get("Content-Encoding"),
+	}
+
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if recorded.Encoding == "gzip" {
+			reader, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				return nil, err
+			}
+			body, err = ioutil.ReadAll(reader)
+			if err != nil {
+				return nil, err
+			}
+		}
+		recorded.Body = body
+	}
+
+	t.mutex.Lock()
+	t.requests = append(t.requests, recorded)
+	handler := t.handler
+	t.mutex.Unlock()
+
+	status, body := http.StatusOK, "{}"
+	if handler != nil {
+		status, body = handler(recorded)
+	}
+	if status == 0 {
+		return nil, fmt.Errorf("connection refused by stub transport")
+	}
+
+	return &http.Response{
+		StatusCode:    status,
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// setHandler replaces the handler of the transport
+func (t *stubTransport) setHandler(handler stubHandler) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.handler = handler
+}
+
+// find returns the recorded requests using the given method whose path has the given suffix
+func (t *stubTransport) find(method, pathSuffix string) []*stubRequest {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	found := make([]*stubRequest, 0)
+	for _, req := range t.requests {
+		if req.Method == method && strings.HasSuffix(req.Path, pathSuffix) {
+			found = append(found, req)
+		}
+	}
+	return found
+}
+
+// bulkRequests returns the recorded bulk requests
+func (t *stubTransport) bulkRequests() []*stubRequest {
+	return t.find(http.MethodPost, "/_bulk")
+}
+
+// newStubClient returns an elasticsearch client sending its requests to a stubTransport using the given handler
+func newStubClient(t *testing.T, handler stubHandler) (*elastic.Client, *stubTransport) {
+	transport := &stubTransport{handler: handler}
+	client, err := elastic.NewClient(
+		elastic.SetHttpClient(&http.Client{Transport: &contentTypeTransport{transport: transport}}),
+		elastic.SetURL(mockElasticsearchURL),
+		elastic.SetSniff(false),
+		elastic.SetHealthcheck(false),
+	)
+	if err != nil {
+		t.Fatalf("failed to initialize stub elasticsearch client; %s", err.Error())
+	}
+	return client, transport
+}
+
+// useStubClient configures a stub client as the elasticsearch client returned by GetClient,
+// returning a func restoring the previously configured clients
+func useStubClient(t *testing.T, handler stubHandler) (*stubTransport, func()) {
+	client, transport := newStubClient(t, handler)
+
+	clients, urls, health := elasticClients, elasticURLs, elasticClientHealth
+	elasticClients = []*elastic.Client{client}
+	elasticURLs = []string{mockElasticsearchURL}
+	elasticClientHealth = nil
+
+	return transport, func() {
+		elasticClients, elasticURLs, elasticClientHealth = clients, urls, health
+	}
+}
+
+// requireStubElasticsearch calls RequireElasticsearch with the given environment, sending every request to
+// a stubTransport, and returns a func restoring the environment and the package configuration
+func requireStubElasticsearch(t *testing.T, env map[string]string, handler stubHandler, opts ...ConnectionOption) (*stubTransport, func()) {
+	transport := &stubTransport{handler: handler}
+
+	previous := map[string]*string{}
+	for key, val := range env {
+		if current, ok := os.LookupEnv(key); ok {
+			previous[key] = &current
+		} else {
+			previous[key] = nil
+		}
+		os.Setenv(key, val)
+	}
+
+	restoreConfig := snapshotConfig()
+	restore := func() {
+		startClientHealthChecks(0)
+		restoreConfig()
+		for key, val := range previous {
+			if val == nil {
+				os.Unsetenv(key)
+			} else {
+				os.Setenv(key, *val)
+			}
+		}
+	}
+
+	opts = append([]ConnectionOption{WithHTTPClient(&http.Client{Transport: transport})}, opts...)
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				restore()
+				t.Fatalf("failed to require elasticsearch; %v", r)
+			}
+		}()
+		RequireElasticsearch(opts...)
+	}()
+
+	return transport, restore
+}
+
+// snapshotConfig returns a func restoring the package configuration read from the environment
+func snapshotConfig() func() {
+	clients, urls, connConfig, health, hosts := elasticClients, elasticURLs, elasticConnectionConfig, elasticClientHealth, elasticHosts
+	scheme, selfSigned, docTypes, pipeline := elasticAPIScheme, elasticAcceptSelfSignedCertificate, elasticDocumentTypesSupported, elasticDefaultPipeline
+	gzipEnabled, gzipThreshold, gzipLevel := elasticGzipEnabled, elasticGzipThresholdBytes, elasticGzipLevel
+	idleConns, idleConnsPerHost, idleConnTimeout, workers := elasticMaxIdleConns, elasticMaxIdleConnsPerHost, elasticIdleConnTimeout, elasticFlushWorkers
+	username, password := elasticUsername, elasticPassword
+
+	return func() {
+		elasticClients, elasticURLs, elasticConnectionConfig, elasticClientHealth, elasticHosts = clients, urls, connConfig, health, hosts
+		elasticAPIScheme, elasticAcceptSelfSignedCertificate, elasticDocumentTypesSupported, elasticDefaultPipeline = scheme, selfSigned, docTypes, pipeline
+		elasticGzipEnabled, elasticGzipThresholdBytes, elasticGzipLevel = gzipEnabled, gzipThreshold, gzipLevel
+		elasticMaxIdleConns, elasticMaxIdleConnsPerHost, elasticIdleConnTimeout, elasticFlushWorkers = idleConns, idleConnsPerHost, idleConnTimeout, workers
+		elasticUsername, elasticPassword = username, password
+	}
+}
+
+// newStubIndexer returns an indexer sending its requests to a stubTransport using the given handler
+func newStubIndexer(t *testing.T, handler stubHandler, opts ...IndexerOption) (*Indexer, *stubTransport) {
+	client, transport := newStubClient(t, handler)
+	indexer, err := newIndexer(client, "", opts...)
+	if err != nil {
+		t.Fatalf("failed to initialize stub indexer; %s", err.Error())
+	}
+	return indexer, transport
+}
+
+// runIndexer runs the given indexer with a short idle interval, returning a func stopping it
+func runIndexer(indexer *Indexer) func() *ShutdownReport {
+	indexer.sleepInterval = time.Millisecond
+	go indexer.Run()
+	return indexer.Stop
+}
+
+// waitIdle waits for every message enqueued to the given indexer to be settled, failing the test otherwise
+func waitIdle(t *testing.T, indexer *Indexer) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), stubWaitTimeout)
+	defer cancel()
+
+	if err := indexer.WaitIdle(ctx); err != nil {
+		t.Fatalf("indexer did not become idle; %s", err.Error())
+	}
+}
+
+// waitFor polls the given condition until it holds, failing the test once the wait times out
+func waitFor(t *testing.T, desc string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(stubWaitTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", desc)
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+}
+
+// testMessage returns a message for the given index and id (omitted when empty) with the given json payload
+func testMessage(index, id, payload string) *Message {
+	return &Message{
+		Header: &MessageHeader{
+			Index: stringOrNil(index),
+			ID:    stringOrNil(id),
+		},
+		Payload: []byte(payload),
+	}
+}
+
+// stubItem is the outcome of an action within a stubbed bulk response; the zero value succeeds
+type stubItem struct {
+	status  int
+	errType string
+	reason  string
+}
+
+// bulkCommand is the parsed action line of a bulk request, along with its source line, if any
+type bulkCommand struct {
+	op     string
+	meta   map[string]interface{}
+	source []byte
+}
+
+// parseBulkBody parses the action and source lines of the given ndjson bulk request body
+func parseBulkBody(t *testing.T, body []byte) []*bulkCommand {
+	t.Helper()
+
+	commands := make([]*bulkCommand, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(body)+1)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var command map[string]map[string]interface{}
+		if err := jsonCodec.Unmarshal(line, &command); err != nil {
+			t.Fatalf("failed to parse bulk action line %s; %s", line, err.Error())
+		}
+
+		for op, meta := range command {
+			parsed := &bulkCommand{op: op, meta: meta}
+			if op != OpDelete {
+				if !scanner.Scan() {
+					t.Fatalf("bulk %s action missing source", op)
+				}
+				parsed.source = append([]byte{}, scanner.Bytes()...)
+			}
+			commands = append(commands, parsed)
+		}
+	}
+
+	return commands
+}
+
+// stubBulkResponse returns a bulk response to the given request with an item for each of its actions
+// having the outcome returned by the given func
+func stubBulkResponse(t *testing.T, req *stubRequest, outcome func(i int, command *bulkCommand) stubItem) (int, string) {
+	commands := parseBulkBody(t, req.Body)
+
+	items := make([]map[string]interface{}, 0, len(commands))
+	failed := false
+	for i, command := range commands {
+		index, _ := command.meta["_index"].(string)
+		id, _ := command.meta["_id"].(string)
+		if id == "" {
+			id = fmt.Sprintf("generated-%d", i)
+		}
+
+		result := stubItem{}
+		if outcome != nil {
+			result = outcome(i, command)
+		}
+		if result.status == 0 {
+			result.status = http.StatusOK
+			if command.op == OpCreate || command.op == OpIndex {
+				result.status = http.StatusCreated
+			}
+		}
+
+		item := map[string]interface{}{
+			"_index": index,
+			"_id":    id,
+			"status": result.status,
+		}
+		if result.status >= 300 {
+			failed = true
+			errType := result.errType
+			if errType == "" {
+				errType = "mapper_parsing_exception"
+			}
+			item["error"] = map[string]interface{}{
+				"type":   errType,
+				"reason": result.reason,
+			}
+		}
+		items = append(items, map[string]interface{}{command.op: item})
+	}
+
+	body, err := jsonCodec.Marshal(map[string]interface{}{
+		"took":   1,
+		"errors": failed,
+		"items":  items,
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal stub bulk response; %s", err.Error())
+	}
+	return http.StatusOK, string(body)
+}
+
+// okBulkHandler returns a handler acknowledging every bulk action, and responding to any other request with an empty object
+func okBulkHandler(t *testing.T) stubHandler {
+	return func(req *stubRequest) (int, string) {
+		if strings.HasSuffix(req.Path, "/_bulk") {
+			return stubBulkResponse(t, req, nil)
+		}
+		return http.StatusOK, "{}"
+	}
+}
+
+// sentCommands returns the commands of every bulk request recorded by the given transport, in order
+func sentCommands(t *testing.T, transport *stubTransport) []*bulkCommand {
+	t.Helper()
+
+	commands := make([]*bulkCommand, 0)
+	for _, req := range transport.bulkRequests() {
+		commands = append(commands, parseBulkBody(t, req.Body)...)
+	}
+	return commands
+}
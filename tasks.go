@@ -0,0 +1,99 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// taskResponse is the tasks api response, including the result of the completed task, which lists
+// the failed documents or shard searches of a reindex, update or delete by query
+type taskResponse struct {
+	elastic.TasksGetTaskResponse
+	Response *struct {
+		Failures []*taskFailure `json:"failures,omitempty"`
+	} `json:"response,omitempty"`
+}
+
+// taskFailure describes a failed document (with its cause) or shard search (with its reason) of a task
+type taskFailure struct {
+	Index  string                `json:"index,omitempty"`
+	ID     string                `json:"id,omitempty"`
+	Status int                   `json:"status,omitempty"`
+	Cause  *elastic.ErrorDetails `json:"cause,omitempty"`
+	Reason *elastic.ErrorDetails `json:"reason,omitempty"`
+}
+
+// Error implements error
+func (f *taskFailure) Error() string {
+	if f.Reason != nil {
+		return fmt.Sprintf("shard search of index %s failed; %s: %s", f.Index, f.Reason.Type, f.Reason.Reason)
+	}
+
+	msg := fmt.Sprintf("document %s in index %s failed with status %d", f.ID, f.Index, f.Status)
+	if f.Cause != nil {
+		msg = fmt.Sprintf("%s; %s: %s", msg, f.Cause.Type, f.Cause.Reason)
+	}
+	return msg
+}
+
+// WaitForTask polls the tasks api every pollInterval until the task with the given id (i.e., as returned
+// by an asynchronous reindex or delete by query) completes or the given context is done; an error is
+// returned when the completed task reports a failure, or any failed documents or shard searches
+func WaitForTask(ctx context.Context, taskID string, pollInterval time.Duration) (*elastic.TasksGetTaskResponse, error) {
+	client, err := GetClient()
+	if err != nil {
+		return nil, err
+	}
+
+	if pollInterval <= 0 {
+		return nil, errors.New("failed to wait for elasticsearch task; poll interval must be positive")
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// the raw response is parsed, as the typed response omits the result of the task
+		raw, err := client.PerformRequest(ctx, elastic.PerformRequestOptions{
+			Method: "GET",
+			Path:   fmt.Sprintf("/_tasks/%s", url.PathEscape(taskID)),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get elasticsearch task %s; %w", taskID, err)
+		}
+
+		task := &taskResponse{}
+		if err := jsonCodec.Unmarshal(raw.Body, task); err != nil {
+			return nil, fmt.Errorf("failed to parse elasticsearch task %s; %w", taskID, err)
+		}
+		resp := &task.TasksGetTaskResponse
+		resp.Header = raw.Header
+
+		if resp.Completed {
+			if resp.Error != nil {
+				return resp, fmt.Errorf("elasticsearch task %s failed; %s: %s", taskID, resp.Error.Type, resp.Error.Reason)
+			}
+
+			if task.Response != nil && len(task.Response.Failures) > 0 {
+				failures := task.Response.Failures
+				return resp, fmt.Errorf("elasticsearch task %s completed with %d failure(s); %w", taskID, len(failures), failures[0])
+			}
+
+			log.Debugf("elasticsearch task %s completed", taskID)
+			return resp, nil
+		}
+
+		log.Tracef("elasticsearch task %s has not completed; polling again in %v", taskID, pollInterval)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to wait for elasticsearch task %s; %w", taskID, ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// taskHandler returns a handler responding to task requests with each of the given responses in turn,
+// repeating the last
+func taskHandler(responses ...string) stubHandler {
+	var mutex sync.Mutex
+	polls := 0
+	return func(req *stubRequest) (int, string) {
+		if req.Method != http.MethodGet || !strings.HasPrefix(req.Path, "/_tasks/") {
+			return http.StatusNotFound, `{}`
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		response := responses[len(responses)-1]
+		if polls < len(responses) {
+			response = responses[polls]
+		}
+		polls++
+		return http.StatusOK, response
+	}
+}
+
+const runningTask = `{"completed":false,"task":{"node":"n1","id":1}}`
+
+func TestWaitForTaskPollsUntilCompleted(t *testing.T) {
+	transport, restore := useStubClient(t, taskHandler(runningTask, runningTask, `{"completed":true,"task":{"node":"n1","id":1},"response":{"created":2,"failures":[]}}`))
+	defer restore()
+
+	resp, err := WaitForTask(context.Background(), "n1:1", time.Millisecond)
+	if err != nil {
+		t.Fatalf("failed to wait for task; %s", err.Error())
+	}
+	if !resp.Completed {
+		t.Errorf("expected the completed task to be returned")
+	}
+	if polls := len(transport.find(http.MethodGet, "/_tasks/n1:1")); polls != 3 {
+		t.Errorf("expected 3 polls; got %d", polls)
+	}
+}
+
+func TestWaitForTaskReturnsFailures(t *testing.T) {
+	_, restore := useStubClient(t, taskHandler(`{"completed":true,"task":{"node":"n1","id":1},"response":{"created":1,"failures":[{"index":"logs","id":"2","status":400,"cause":{"type":"mapper_parsing_exception","reason":"failed to parse"}}]}}`))
+	defer restore()
+
+	resp, err := WaitForTask(context.Background(), "n1:1", time.Millisecond)
+	if resp == nil || err == nil {
+		t.Fatalf("expected the completed task to be returned along with its failures; got %v, %v", resp, err)
+	}
+
+	var failure *taskFailure
+	if !errors.As(err, &failure) || failure.ID != "2" || failure.Status != http.StatusBadRequest {
+		t.Fatalf("expected the failed document to be wrapped; got %v", err)
+	}
+	if !strings.Contains(err.Error(), "1 failure(s)") || !strings.Contains(err.Error(), "mapper_parsing_exception: failed to parse") {
+		t.Errorf("expected the error to describe the failure; got %s", err.Error())
+	}
+}
+
+func TestWaitForTaskReturnsTaskError(t *testing.T) {
+	_, restore := useStubClient(t, taskHandler(`{"completed":true,"task":{"node":"n1","id":1},"error":{"type":"search_phase_execution_exception","reason":"all shards failed"}}`))
+	defer restore()
+
+	if _, err := WaitForTask(context.Background(), "n1:1", time.Millisecond); err == nil || !strings.Contains(err.Error(), "all shards failed") {
+		t.Errorf("expected the task error to be returned; got %v", err)
+	}
+}
+
+func TestWaitForTaskIsBoundedByContext(t *testing.T) {
+	_, restore := useStubClient(t, taskHandler(runningTask))
+	defer restore()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := WaitForTask(ctx, "n1:1", time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded; got %v", err)
+	}
+	if _, err := WaitForTask(context.Background(), "n1:1", 0); err == nil {
+		t.Errorf("expected a non-positive poll interval to be rejected")
+	}
+}
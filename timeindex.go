@@ -0,0 +1,55 @@
+package elasticsearchutil
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeBasedIndex resolves a dated index name, i.e., `logs-{2006.01.02}`, from a timestamp field of the payload
+type timeBasedIndex struct {
+	field  []string
+	prefix string
+	layout string // go time layout between the braces of the pattern
+	suffix string
+}
+
+// newTimeBasedIndex parses the given pattern, which must contain a single go time layout enclosed in braces
+func newTimeBasedIndex(field, pattern string) (*timeBasedIndex, error) {
+	start := strings.Index(pattern, "{")
+	end := strings.LastIndex(pattern, "}")
+	if start == -1 || end < start+2 || strings.Count(pattern, "{") != 1 || strings.Count(pattern, "}") != 1 {
+		return nil, fmt.Errorf("invalid time-based index pattern %s; a single time layout must be enclosed in braces, i.e., logs-{2006.01.02}", pattern)
+	}
+
+	return &timeBasedIndex{
+		field:  strings.Split(field, "."),
+		prefix: pattern[:start],
+		layout: pattern[start+1 : end],
+		suffix: pattern[end+1:],
+	}, nil
+}
+
+// resolve returns the dated index for the timestamp of the given payload, which may be an rfc3339 string
+// or epoch milliseconds; the current time is used if the timestamp is missing or cannot be parsed
+func (tbi *timeBasedIndex) resolve(payload []byte) string {
+	timestamp := time.Now()
+	if val := payloadField(payload, tbi.field); val != nil {
+		if parsed, err := parseTimestamp(*val); err == nil {
+			timestamp = parsed
+		} else {
+			log.Debugf("failed to parse timestamp field %s for time-based index %s{%s}%s; using current time; %s", strings.Join(tbi.field, "."), tbi.prefix, tbi.layout, tbi.suffix, err.Error())
+		}
+	}
+
+	return tbi.prefix + timestamp.UTC().Format(tbi.layout) + tbi.suffix
+}
+
+// parseTimestamp parses the given rfc3339 or epoch milliseconds timestamp
+func parseTimestamp(val string) (time.Time, error) {
+	if millis, err := strconv.ParseInt(val, 10, 64); err == nil {
+		return time.Unix(0, millis*int64(time.Millisecond)), nil
+	}
+	return time.Parse(time.RFC3339Nano, val)
+}
@@ -0,0 +1,80 @@
+package elasticsearchutil
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewTimeBasedIndexValidatesPattern(t *testing.T) {
+	for _, pattern := range []string{"logs", "logs-{}", "logs-{2006}-{01}", "logs-}2006{", "logs-{2006"} {
+		if _, err := newTimeBasedIndex("@timestamp", pattern); err == nil || !strings.Contains(err.Error(), "invalid time-based index pattern") {
+			t.Errorf("expected pattern %s to be rejected; got %v", pattern, err)
+		}
+	}
+
+	tbi, err := newTimeBasedIndex("event.created", "logs-{2006.01.02}-v1")
+	if err != nil {
+		t.Fatalf("failed to parse pattern; %s", err.Error())
+	}
+	if tbi.prefix != "logs-" || tbi.layout != "2006.01.02" || tbi.suffix != "-v1" || strings.Join(tbi.field, "|") != "event|created" {
+		t.Errorf("expected the pattern and dotted field to be parsed; got %+v", tbi)
+	}
+}
+
+func TestTimeBasedIndexResolvesTimestampOfPayload(t *testing.T) {
+	tbi, err := newTimeBasedIndex("event.created", "logs-{2006.01.02}")
+	if err != nil {
+		t.Fatalf("failed to parse pattern; %s", err.Error())
+	}
+
+	for payload, expected := range map[string]string{
+		`{"event":{"created":"2021-03-04T23:30:00-02:00"}}`: "logs-2021.03.05",
+		`{"event":{"created":1614816000000}}`:               "logs-2021.03.04",
+		`{"event":{"created":"1614816000000"}}`:             "logs-2021.03.04",
+	} {
+		if index := tbi.resolve([]byte(payload)); index != expected {
+			t.Errorf("expected %s to resolve to %s; got %s", payload, expected, index)
+		}
+	}
+
+	for _, payload := range []string{`{"event":{}}`, `{"event":{"created":"yesterday"}}`, `not json`} {
+		before := "logs-" + time.Now().UTC().Format("2006.01.02")
+		index := tbi.resolve([]byte(payload))
+		if after := "logs-" + time.Now().UTC().Format("2006.01.02"); index != before && index != after {
+			t.Errorf("expected %s to resolve to the index of the current time %s; got %s", payload, after, index)
+		}
+	}
+}
+
+func TestWithTimeBasedIndexRewritesTargetIndex(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithTimeBasedIndex("@timestamp", "logs-{2006.01}"))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueAll(t, indexer, 2,
+		testMessage("logs-{2006.01}", "1", `{"@timestamp":"2020-12-31T12:00:00Z"}`),
+		testMessage("metrics", "2", `{"@timestamp":"2020-12-31T12:00:00Z"}`),
+	)
+	waitIdle(t, indexer)
+
+	commands := sentCommands(t, transport)
+	if len(commands) != 2 {
+		t.Fatalf("expected 2 bulk actions; got %d", len(commands))
+	}
+	if index := commands[0].meta["_index"]; index != "logs-2020.12" {
+		t.Errorf("expected the document to target the index of its timestamp; got %v", index)
+	}
+	if index := commands[1].meta["_index"]; index != "metrics" {
+		t.Errorf("expected an index not matching the pattern not to be rewritten; got %v", index)
+	}
+}
+
+func TestWithTimeBasedIndexValidatesOptions(t *testing.T) {
+	if _, err := newIndexer(nil, "", WithTimeBasedIndex("", "logs-{2006.01.02}")); err == nil {
+		t.Errorf("expected an empty timestamp field to be rejected")
+	}
+	if _, err := newIndexer(nil, "", WithTimeBasedIndex("@timestamp", "logs")); err == nil {
+		t.Errorf("expected a pattern without a time layout to be rejected")
+	}
+}
@@ -0,0 +1,48 @@
+package elasticsearchutil
+
+import (
+	"fmt"
+	"path"
+	"time"
+)
+
+// indexTimeoutRule binds a bulk request timeout to the index pattern (i.e., `archive-*`) to which it applies
+type indexTimeoutRule struct {
+	pattern string
+	timeout time.Duration
+}
+
+// bulkTimeout returns the bulk request timeout for the given index, formatted as an elasticsearch
+// time unit; the first matching rule applies, or ELASTICSEARCH_TIMEOUT when no rule matches
+func (indexer *Indexer) bulkTimeout(index string) string {
+	if timeout, ok := indexer.indexTimeout(index); ok {
+		return formatKeepAlive(timeout)
+	}
+
+	return fmt.Sprintf("%ds", elasticTimeout)
+}
+
+// indexTimeout returns the bulk request timeout of the first rule matching the given index, if any
+func (indexer *Indexer) indexTimeout(index string) (time.Duration, bool) {
+	for _, rule := range indexer.indexTimeouts {
+		if matched, _ := path.Match(rule.pattern, index); matched {
+			return rule.timeout, true
+		}
+	}
+
+	return 0, false
+}
+
+// flushDeadline returns the client-side deadline for sending the given batch; the flush timeout is
+// added to the elasticsearch timeout of the batch, such that the cluster reports the timeout where it can
+func (indexer *Indexer) flushDeadline(batch *bulkBatch) time.Duration {
+	timeout := time.Duration(elasticTimeout) * time.Second
+	if len(batch.pending) > 0 {
+		// the timeout of the first action applies to the batch, as it does to its bulk request
+		if indexTimeout, ok := indexer.indexTimeout(*batch.pending[0].msg.Header.Index); ok {
+			timeout = indexTimeout
+		}
+	}
+
+	return timeout + indexer.flushTimeout
+}
@@ -0,0 +1,93 @@
+package elasticsearchutil
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestWithIndexTimeoutSendsIndicesWithDifferingTimeoutsSeparately(t *testing.T) {
+	indexer, transport := newStubIndexer(t, okBulkHandler(t), WithIndexTimeout("archive-*", 90*time.Second))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	for i, index := range []string{"events", "archive-1", "archive-2", "events"} {
+		if err := indexer.Q(testMessage(index, fmt.Sprintf("%d", i), `{"a":1}`)); err != nil {
+			t.Fatalf("failed to enqueue message; %s", err.Error())
+		}
+	}
+	waitIdle(t, indexer)
+
+	reqs := transport.bulkRequests()
+	if len(reqs) != 3 {
+		t.Fatalf("expected a bulk request for each run of indices sharing a timeout; got %d", len(reqs))
+	}
+	defaultTimeout := fmt.Sprintf("%ds", elasticTimeout)
+	for i, expected := range []string{defaultTimeout, "90000ms", defaultTimeout} {
+		if timeout := reqs[i].Query.Get("timeout"); timeout != expected {
+			t.Errorf("expected bulk request %d to be sent with timeout %s; got %s", i, expected, timeout)
+		}
+	}
+	if commands := parseBulkBody(t, reqs[1].Body); len(commands) != 2 {
+		t.Errorf("expected the archive documents to be batched together; got %d", len(commands))
+	}
+}
+
+func TestBulkTimeoutAppliesFirstMatchingRule(t *testing.T) {
+	indexer, _ := newStubIndexer(t, nil,
+		WithIndexTimeout("archive-2020-*", time.Minute),
+		WithIndexTimeout("archive-*", 2*time.Minute),
+	)
+
+	if timeout := indexer.bulkTimeout("archive-2020-01"); timeout != "60000ms" {
+		t.Errorf("expected the first matching rule to apply; got %s", timeout)
+	}
+	if timeout := indexer.bulkTimeout("archive-2021-01"); timeout != "120000ms" {
+		t.Errorf("expected the matching rule to apply; got %s", timeout)
+	}
+	if timeout := indexer.bulkTimeout("events"); timeout != fmt.Sprintf("%ds", elasticTimeout) {
+		t.Errorf("expected the default timeout without a matching rule; got %s", timeout)
+	}
+}
+
+func TestWithIndexTimeoutValidatesRule(t *testing.T) {
+	if _, err := newIndexer(nil, "", WithIndexTimeout("archive-[", time.Minute)); err == nil {
+		t.Errorf("expected invalid index timeout pattern to be rejected")
+	}
+	if _, err := newIndexer(nil, "", WithIndexTimeout("archive-*", 0)); err == nil {
+		t.Errorf("expected non-positive index timeout to be rejected")
+	}
+}
+
+func TestIndexerBoundsBulkRequestsByFlushDeadline(t *testing.T) {
+	indexer, _ := newStubIndexer(t, func(req *stubRequest) (int, string) {
+		// unresponsive until the request is abandoned
+		<-req.ctx.Done()
+		return 0, ""
+	})
+	indexer.flushTimeout = 50 * time.Millisecond
+
+	if err := indexer.index(testMessage("events", "1", `{"a":1}`)); err != nil {
+		t.Fatalf("failed to index message; %s", err.Error())
+	}
+	if _, err := indexer.esBulkServiceFlush(indexer.flushCtx); err == nil {
+		t.Fatalf("expected the unresponsive bulk request to fail once its deadline passed")
+	}
+	if len(indexer.retryQ) != 1 {
+		t.Errorf("expected the abandoned document to be retried; got %d in the retry buffer", len(indexer.retryQ))
+	}
+}
+
+func TestFlushDeadlineExceedsIndexTimeout(t *testing.T) {
+	indexer, _ := newStubIndexer(t, nil, WithIndexTimeout("archive-*", time.Minute))
+	indexer.flushTimeout = time.Second
+
+	archive := &bulkBatch{pending: []*queuedAction{{msg: testMessage("archive-1", "1", `{"a":1}`)}}}
+	if deadline := indexer.flushDeadline(archive); deadline != time.Minute+time.Second {
+		t.Errorf("expected the flush timeout to be added to the timeout of the index; got %v", deadline)
+	}
+	events := &bulkBatch{pending: []*queuedAction{{msg: testMessage("events", "1", `{"a":1}`)}}}
+	if deadline := indexer.flushDeadline(events); deadline != time.Duration(elasticTimeout)*time.Second+time.Second {
+		t.Errorf("expected the flush timeout to be added to the default timeout; got %v", deadline)
+	}
+}
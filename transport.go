@@ -0,0 +1,82 @@
+package elasticsearchutil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+const defaultElasticsearchGzipThresholdBytes = 1024
+const defaultElasticsearchGzipLevel = gzip.DefaultCompression
+
+// gzipTransport compresses request bodies which meet or exceed the configured threshold,
+// leaving smaller bodies uncompressed to avoid wasting cpu on tiny requests
+type gzipTransport struct {
+	level          int
+	thresholdBytes int
+	transport      http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *gzipTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || req.ContentLength < int64(t.thresholdBytes) || req.Header.Get("Content-Encoding") != "" {
+		return t.transport.RoundTrip(req)
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writer, err := gzip.NewWriterLevel(&buf, t.level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(body); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	compressed := buf.Bytes()
+	log.Tracef("compressed %d-byte elasticsearch request body to %d bytes", len(body), len(compressed))
+
+	gzreq := req.Clone(req.Context())
+	gzreq.Body = ioutil.NopCloser(bytes.NewReader(compressed))
+	gzreq.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(compressed)), nil
+	}
+	gzreq.ContentLength = int64(len(compressed))
+	gzreq.Header.Set("Content-Encoding", "gzip")
+
+	return t.transport.RoundTrip(gzreq)
+}
+
+// contentTypeOverrideHeader carries the content type with which to replace that set by the elasticsearch
+// client for a request, i.e., for bulk requests of indexers configured using WithBulkContentType
+const contentTypeOverrideHeader = "X-Elasticsearchutil-Content-Type"
+
+// contentTypeTransport replaces the content type of requests carrying the content type override header,
+// as the elasticsearch client adds provided headers to, rather than replacing, its own content type
+type contentTypeTransport struct {
+	transport http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *contentTypeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	contentType := req.Header.Get(contentTypeOverrideHeader)
+	if contentType == "" {
+		return t.transport.RoundTrip(req)
+	}
+
+	overridden := req.Clone(req.Context())
+	overridden.Header.Del(contentTypeOverrideHeader)
+	overridden.Header.Set("Content-Type", contentType)
+
+	return t.transport.RoundTrip(overridden)
+}
@@ -0,0 +1,142 @@
+package elasticsearchutil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func newTransportTestRequest(t *testing.T, body string) *http.Request {
+	req, err := http.NewRequest(http.MethodPost, mockElasticsearchURL+"/_bulk", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to build request; %s", err.Error())
+	}
+	return req
+}
+
+func TestGzipTransportCompressesBodiesMeetingThreshold(t *testing.T) {
+	stub := &stubTransport{}
+	transport := &gzipTransport{level: gzip.BestSpeed, thresholdBytes: 16, transport: stub}
+
+	body := strings.Repeat("a", 64)
+	if _, err := transport.RoundTrip(newTransportTestRequest(t, body)); err != nil {
+		t.Fatalf("failed to round trip request; %s", err.Error())
+	}
+
+	reqs := stub.bulkRequests()
+	if len(reqs) != 1 {
+		t.Fatalf("expected 1 request; got %d", len(reqs))
+	}
+	if reqs[0].Encoding != "gzip" {
+		t.Errorf("expected gzip content encoding; got %q", reqs[0].Encoding)
+	}
+	if string(reqs[0].Body) != body {
+		t.Errorf("expected decompressed body to match the original")
+	}
+}
+
+func TestGzipTransportSkipsBodiesBelowThreshold(t *testing.T) {
+	stub := &stubTransport{}
+	transport := &gzipTransport{level: gzip.BestSpeed, thresholdBytes: 1024, transport: stub}
+
+	if _, err := transport.RoundTrip(newTransportTestRequest(t, `{"a":1}`)); err != nil {
+		t.Fatalf("failed to round trip request; %s", err.Error())
+	}
+
+	reqs := stub.bulkRequests()
+	if len(reqs) != 1 {
+		t.Fatalf("expected 1 request; got %d", len(reqs))
+	}
+	if reqs[0].Encoding != "" {
+		t.Errorf("expected no content encoding; got %q", reqs[0].Encoding)
+	}
+	if !bytes.Equal(reqs[0].Body, []byte(`{"a":1}`)) {
+		t.Errorf("expected body to be sent unmodified; got %s", reqs[0].Body)
+	}
+}
+
+func TestGzipTransportLeavesEncodedBodies(t *testing.T) {
+	stub := &stubTransport{}
+	transport := &gzipTransport{level: gzip.BestSpeed, thresholdBytes: 1, transport: stub}
+
+	req := newTransportTestRequest(t, "already encoded")
+	req.Header.Set("Content-Encoding", "identity")
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatalf("failed to round trip request; %s", err.Error())
+	}
+
+	if reqs := stub.bulkRequests(); len(reqs) != 1 || reqs[0].Encoding != "identity" {
+		t.Errorf("expected the provided content encoding to be retained")
+	}
+}
+
+func TestGzipTransportAppliesCompressionLevel(t *testing.T) {
+	body := strings.Repeat("abcdefgh", 512)
+	sizes := make(map[int]int)
+	for _, level := range []int{gzip.NoCompression, gzip.BestCompression} {
+		var sent *http.Request
+		transport := &gzipTransport{level: level, thresholdBytes: 1, transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			sent = req
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		})}
+		if _, err := transport.RoundTrip(newTransportTestRequest(t, body)); err != nil {
+			t.Fatalf("failed to round trip request; %s", err.Error())
+		}
+		sizes[level] = int(sent.ContentLength)
+	}
+
+	if sizes[gzip.BestCompression] >= sizes[gzip.NoCompression] {
+		t.Errorf("expected the configured level to be applied; got %d bytes at best compression and %d bytes uncompressed", sizes[gzip.BestCompression], sizes[gzip.NoCompression])
+	}
+}
+
+func TestGzipTransportRejectsInvalidLevel(t *testing.T) {
+	transport := &gzipTransport{level: 42, thresholdBytes: 1, transport: &stubTransport{}}
+	if _, err := transport.RoundTrip(newTransportTestRequest(t, "body")); err == nil {
+		t.Errorf("expected an invalid compression level to be rejected")
+	}
+}
+
+// roundTripFunc adapts the given func to an http.RoundTripper
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestContentTypeTransportReplacesContentType(t *testing.T) {
+	stub := &stubTransport{}
+	transport := &contentTypeTransport{transport: stub}
+
+	req := newTransportTestRequest(t, "{}\n")
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set(contentTypeOverrideHeader, "application/json")
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatalf("failed to round trip request; %s", err.Error())
+	}
+
+	plain := newTransportTestRequest(t, "{}\n")
+	plain.Header.Set("Content-Type", "application/x-ndjson")
+	if _, err := transport.RoundTrip(plain); err != nil {
+		t.Fatalf("failed to round trip request; %s", err.Error())
+	}
+
+	reqs := stub.bulkRequests()
+	if len(reqs) != 2 {
+		t.Fatalf("expected 2 requests; got %d", len(reqs))
+	}
+	if contentType := reqs[0].Header.Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("expected the overridden content type; got %q", contentType)
+	}
+	if reqs[0].Header.Get(contentTypeOverrideHeader) != "" {
+		t.Errorf("expected the override header not to be sent")
+	}
+	if req.Header.Get(contentTypeOverrideHeader) == "" {
+		t.Errorf("expected the original request not to be modified")
+	}
+	if contentType := reqs[1].Header.Get("Content-Type"); contentType != "application/x-ndjson" {
+		t.Errorf("expected the content type of a request without override to be retained; got %q", contentType)
+	}
+}
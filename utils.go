@@ -1,5 +1,36 @@
 package elasticsearchutil
 
+import (
+	"net/url"
+	"strings"
+)
+
+// redactURL returns the given URL or host with any userinfo (i.e., basic auth credentials) replaced with ****
+func redactURL(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+	if err == nil && parsedURL.User != nil && parsedURL.Host != "" {
+		// the userinfo is replaced following serialization, as url.User escapes the asterisks
+		parsedURL.User = nil
+		return strings.Replace(parsedURL.String(), "://", "://****@", 1)
+	}
+
+	// fallback for hosts which do not parse as a url, i.e., user:pass@host:port
+	if i := strings.LastIndex(rawURL, "@"); i != -1 {
+		prefix := ""
+		if j := strings.Index(rawURL, "://"); j != -1 && j < i {
+			prefix = rawURL[:j+3]
+		}
+		return prefix + "****" + rawURL[i:]
+	}
+
+	return rawURL
+}
+
+// redactErr returns the message of the given error with any occurrence of the given url redacted
+func redactErr(err error, rawURL string) string {
+	return strings.Replace(err.Error(), rawURL, redactURL(rawURL), -1)
+}
+
 // stringOrNil returns the given string or nil when empty
 func stringOrNil(str string) *string {
 	if str == "" {
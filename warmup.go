@@ -0,0 +1,34 @@
+package elasticsearchutil
+
+import (
+	"context"
+	"time"
+)
+
+const defaultElasticsearchWarmUpTimeoutMillis = 5000
+
+// WithWarmUp pings each configured host upon initialization, resolving it and establishing a
+// keep-alive connection such that the first real request (i.e., the first flush) does not incur
+// the latency of a cold start; hosts failing the ping are logged but do not prevent initialization
+func WithWarmUp() ConnectionOption {
+	return func(config *connectionConfig) {
+		config.warmUp = true
+	}
+}
+
+// warmUpClients pings the host of each configured client, leaving an idle connection to each
+func warmUpClients() {
+	for i, client := range elasticClients {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*time.Duration(defaultElasticsearchWarmUpTimeoutMillis))
+		started := time.Now()
+		_, code, err := client.Ping(elasticURLs[i]).Do(ctx)
+		cancel()
+
+		if err != nil {
+			log.Warningf("failed to warm up elasticsearch connection to %s; %s", redactURL(elasticURLs[i]), redactErr(err, elasticURLs[i]))
+			continue
+		}
+
+		log.Debugf("warmed up elasticsearch connection to %s in %v; ping returned status %d", redactURL(elasticURLs[i]), time.Since(started), code)
+	}
+}
@@ -0,0 +1,39 @@
+package elasticsearchutil
+
+import (
+	"net/http"
+	"testing"
+)
+
+// requirePings returns the number of pings sent upon requiring elasticsearch with the given hosts and options
+func requirePings(t *testing.T, hosts string, handler stubHandler, opts ...ConnectionOption) int {
+	transport, restore := requireStubElasticsearch(t, map[string]string{
+		"ELASTICSEARCH_HOSTS": hosts,
+	}, handler, opts...)
+	defer restore()
+
+	return len(transport.find(http.MethodGet, "/"))
+}
+
+func TestWithWarmUpPingsEachHost(t *testing.T) {
+	hosts := "es-1.local:9200,es-2.local:9200"
+	if pings, baseline := requirePings(t, hosts, nil, WithWarmUp()), requirePings(t, hosts, nil); pings != baseline+2 {
+		t.Errorf("expected a warm-up ping of each host; got %d pings, %d without warm-up", pings, baseline)
+	}
+}
+
+func TestWithWarmUpToleratesFailedPings(t *testing.T) {
+	_, restore := requireStubElasticsearch(t, map[string]string{
+		"ELASTICSEARCH_HOSTS": "es.local:9200",
+	}, func(req *stubRequest) (int, string) {
+		if req.Method == http.MethodGet && req.Path == "/" {
+			return http.StatusServiceUnavailable, ""
+		}
+		return http.StatusOK, `{}`
+	}, WithWarmUp())
+	defer restore()
+
+	if _, err := GetClient(); err != nil {
+		t.Errorf("expected the failed ping not to prevent initialization; got %s", err.Error())
+	}
+}
@@ -0,0 +1,102 @@
+package elasticsearchutil
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// defaultElasticsearchFlushWorkers preserves serial flushing, with bulk requests sent inline by the run loop
+const defaultElasticsearchFlushWorkers = 1
+
+// startFlushWorkers starts the pool of workers sending detached batches, when more than one worker is configured
+func (indexer *Indexer) startFlushWorkers() {
+	if indexer.flushWorkers <= 1 {
+		return
+	}
+
+	indexer.flushQ = make(chan *bulkBatch)
+	for i := 0; i < indexer.flushWorkers; i++ {
+		indexer.flushWG.Add(1)
+		go func() {
+			defer indexer.flushWG.Done()
+			for batch := range indexer.flushQ {
+				indexer.sendBatch(indexer.flushCtx, batch)
+			}
+		}()
+	}
+
+	log.Debugf("started %d flush workers for indexer (%v)", indexer.flushWorkers, indexer.identifier)
+}
+
+// stopFlushWorkers waits, up to the configured shutdown flush timeout, for in-flight batches to be sent;
+// the batches still in flight are then cancelled, and the workers awaited such that the actions of the
+// cancelled batches are retried or dead-lettered (and reported) before the indexer stops
+func (indexer *Indexer) stopFlushWorkers() {
+	defer indexer.cancelFlush()
+
+	if indexer.flushQ == nil {
+		return
+	}
+
+	close(indexer.flushQ)
+
+	stopped := make(chan struct{})
+	go func() {
+		indexer.flushWG.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		log.Debugf("stopped flush workers for indexer (%v)", indexer.identifier)
+	case <-time.After(indexer.shutdownFlushTimeout):
+		log.Warningf("indexer (%v) flush workers did not finish in-flight bulk requests within %v; cancelling", indexer.identifier, indexer.shutdownFlushTimeout)
+		indexer.cancelFlush()
+		<-stopped
+	}
+}
+
+// dispatchFlush sends the queued actions inline when flushing serially, or otherwise hands the
+// detached batch to the next available flush worker, blocking while all workers are busy
+func (indexer *Indexer) dispatchFlush() {
+	if indexer.flushQ == nil {
+		indexer.esBulkServiceFlush(indexer.flushCtx)
+		return
+	}
+
+	batch := indexer.detachBatch()
+	if batch == nil {
+		log.Tracef("indexer (%v) attempted to dispatch Elasticsearch bulk index request, but nothing was queued", indexer.identifier)
+		return
+	}
+
+	indexer.flushQ <- batch
+}
+
+// acquireInFlight blocks until sending a batch of the given size would not exceed the configured max
+// in-flight bytes across all flush workers; a batch is always permitted when nothing is in flight
+func (indexer *Indexer) acquireInFlight(size int) {
+	indexer.inFlightCond.L.Lock()
+	defer indexer.inFlightCond.L.Unlock()
+
+	if indexer.maxInFlightBytes > 0 {
+		for {
+			inFlight := atomic.LoadInt64(&indexer.stats.InFlightBytes)
+			if inFlight == 0 || inFlight+int64(size) <= indexer.maxInFlightBytes {
+				break
+			}
+			log.Tracef("indexer (%v) waiting to send %d-byte batch; %d bytes in flight", indexer.identifier, size, inFlight)
+			indexer.inFlightCond.Wait()
+		}
+	}
+
+	atomic.AddInt64(&indexer.stats.InFlightBytes, int64(size))
+}
+
+// releaseInFlight frees the in-flight capacity held by a batch of the given size
+func (indexer *Indexer) releaseInFlight(size int) {
+	indexer.inFlightCond.L.Lock()
+	atomic.AddInt64(&indexer.stats.InFlightBytes, -int64(size))
+	indexer.inFlightCond.L.Unlock()
+	indexer.inFlightCond.Broadcast()
+}
@@ -0,0 +1,153 @@
+package elasticsearchutil
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// blockingBulkHandler acknowledges bulk requests once released, recording the number sent concurrently
+type blockingBulkHandler struct {
+	t        *testing.T
+	release  chan struct{}
+	mutex    sync.Mutex
+	inFlight int
+	peak     int
+}
+
+func newBlockingBulkHandler(t *testing.T) *blockingBulkHandler {
+	return &blockingBulkHandler{t: t, release: make(chan struct{})}
+}
+
+func (h *blockingBulkHandler) handle(req *stubRequest) (int, string) {
+	if !strings.HasSuffix(req.Path, "/_bulk") {
+		return http.StatusOK, "{}"
+	}
+
+	h.mutex.Lock()
+	h.inFlight++
+	if h.inFlight > h.peak {
+		h.peak = h.inFlight
+	}
+	h.mutex.Unlock()
+
+	<-h.release
+
+	h.mutex.Lock()
+	h.inFlight--
+	h.mutex.Unlock()
+	return stubBulkResponse(h.t, req, nil)
+}
+
+// concurrent returns the number of bulk requests currently blocked, and the peak number blocked at once
+func (h *blockingBulkHandler) concurrent() (int, int) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.inFlight, h.peak
+}
+
+// useFlushWorkers configures the given number of flush workers, returning a func restoring the previous number
+func useFlushWorkers(workers int) func() {
+	previous := elasticFlushWorkers
+	elasticFlushWorkers = workers
+	return func() { elasticFlushWorkers = previous }
+}
+
+func TestFlushWorkersSendBatchesConcurrently(t *testing.T) {
+	restoreWorkers := useFlushWorkers(3)
+	defer restoreWorkers()
+
+	handler := newBlockingBulkHandler(t)
+	indexer, transport := newStubIndexer(t, handler.handle, WithFlushThresholds(0, 1, 0))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueN(t, indexer, 4)
+	waitFor(t, "3 concurrent bulk requests", func() bool {
+		inFlight, _ := handler.concurrent()
+		return inFlight == 3
+	})
+	close(handler.release)
+	waitIdle(t, indexer)
+
+	if _, peak := handler.concurrent(); peak != 3 {
+		t.Errorf("expected at most 3 concurrent bulk requests; got %d", peak)
+	}
+	if commands := sentCommands(t, transport); len(commands) != 4 {
+		t.Errorf("expected 4 bulk actions; got %d", len(commands))
+	}
+	if stats := indexer.Stats(); stats.Indexed != 4 {
+		t.Errorf("expected 4 documents indexed; got %d", stats.Indexed)
+	}
+}
+
+func TestSingleFlushWorkerSendsBatchesSerially(t *testing.T) {
+	restoreWorkers := useFlushWorkers(1)
+	defer restoreWorkers()
+
+	indexer, _ := newStubIndexer(t, nil)
+	indexer.startFlushWorkers()
+	if indexer.flushQ != nil {
+		t.Errorf("expected no flush workers to be started")
+	}
+}
+
+func TestRequireElasticsearchParsesFlushWorkers(t *testing.T) {
+	_, restore := requireStubElasticsearch(t, map[string]string{
+		"ELASTICSEARCH_HOSTS":         "es.local:9200",
+		"ELASTICSEARCH_FLUSH_WORKERS": "4",
+	}, nil)
+	defer restore()
+
+	if elasticFlushWorkers != 4 {
+		t.Errorf("expected 4 flush workers; got %d", elasticFlushWorkers)
+	}
+}
+
+func TestWithMaxInFlightBytesCapsConcurrentBatches(t *testing.T) {
+	restoreWorkers := useFlushWorkers(3)
+	defer restoreWorkers()
+
+	handler := newBlockingBulkHandler(t)
+	indexer, _ := newStubIndexer(t, handler.handle, WithFlushThresholds(0, 1, 0), WithMaxInFlightBytes(10))
+	stop := runIndexer(indexer)
+	defer stop()
+
+	enqueueN(t, indexer, 3)
+	waitFor(t, "bulk request", func() bool {
+		inFlight, _ := handler.concurrent()
+		return inFlight == 1
+	})
+	// each batch is detached as it is handed to a worker, such that the remaining batches await the cap
+	waitFor(t, "batches to be handed to the flush workers", func() bool {
+		return len(indexer.q) == 0 && atomic.LoadInt64(&indexer.bufferedActions) == 0
+	})
+	if inFlight, _ := handler.concurrent(); inFlight != 1 {
+		t.Errorf("expected a single 7-byte batch in flight under the 10-byte cap; got %d", inFlight)
+	}
+	if inFlightBytes := indexer.Stats().InFlightBytes; inFlightBytes != 7 {
+		t.Errorf("expected 7 bytes in flight; got %d", inFlightBytes)
+	}
+
+	close(handler.release)
+	waitIdle(t, indexer)
+
+	if _, peak := handler.concurrent(); peak != 1 {
+		t.Errorf("expected batches to be sent one at a time; got %d concurrently", peak)
+	}
+	if inFlightBytes := indexer.Stats().InFlightBytes; inFlightBytes != 0 {
+		t.Errorf("expected no bytes in flight once idle; got %d", inFlightBytes)
+	}
+}
+
+func TestAcquireInFlightPermitsOversizedBatchWhenNothingInFlight(t *testing.T) {
+	indexer, _ := newStubIndexer(t, nil, WithMaxInFlightBytes(10))
+
+	indexer.acquireInFlight(100)
+	if inFlightBytes := indexer.Stats().InFlightBytes; inFlightBytes != 100 {
+		t.Errorf("expected the oversized batch to be permitted; got %d bytes in flight", inFlightBytes)
+	}
+	indexer.releaseInFlight(100)
+}